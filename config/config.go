@@ -2,20 +2,22 @@ package config
 
 import "time"
 
-const (
+//以下为各配置项的默认值，启动时调用Init方法，按 配置文件 -> 环境变量 -> 命令行参数 的顺序覆盖
+//配置项的key、环境变量名以及是否必填定义在load.go的options中
+var (
 	//监听端口
 	ListenAddr = "0.0.0.0:9093"
-	//权限文件地址
-	//if os = Windows
-	Kubeconfig = "C:\\Users\\13358\\.kube\\config"
-	//else if os = linux
-	//Kubeconfig = "/root/.kube/config"
+	//多集群权限文件地址，json格式，key为集群名，value为kubeconfig文件路径
+	//如：{"default":"/root/.kube/config"}
+	Kubeconfigs = ""
+	//请求中未携带cluster参数时使用的默认集群
+	DefaultCluster = "default"
 	//数据库配置
 	DbType = "mysql"
 	DbUser = "root"
-	DbPwd  = "123456"
+	DbPwd  = ""
 	DbHost = "127.0.0.1"
-	DbPort = 31157
+	DbPort = 3306
 	DbName = "platform"
 	//连接池的配置
 	MaxIdleConns = 10               //最大空闲连接
@@ -23,7 +25,83 @@ const (
 	MaxLifeTime  = 30 * time.Second //最大生存时间
 	//日志显示行数
 	PodLogTailLine = 2000
-	//登录账户名和密码
+	//流式日志写入客户端的超时时间，客户端消费过慢超过该时间时断开连接
+	PodLogWriteTimeout = 10 * time.Second
+	//聚合日志最多同时推送的pod数量
+	PodLogAggregateMaxPods = 50
+	//上传、下载容器文件的大小上限，单位MB
+	PodFileMaxSize = 1024
+	//允许建立WebSocket连接的页面Origin，逗号分隔，如https://k8s.example.com
+	//为空时只允许与平台同域的页面，*表示允许所有
+	WsAllowedOrigins = ""
+	//打开终端时依次尝试的shell，逗号分隔，命令参数用空格分隔，前一个在容器中不存在时尝试下一个
+	TerminalShells = "bash,sh,ash,busybox sh"
+	//终端录像的保存目录，录像为asciicast v2格式，按日期分目录保存，为空时不录像
+	TerminalRecordDir = "./recordings"
+	//同时打开的终端数量上限，分为全局和单个用户，0表示不限制
+	TerminalMaxSessions     = 100
+	TerminalMaxUserSessions = 5
+	//终端无输入超过该时间自动断开，0表示不限制
+	TerminalIdleTimeout = 30 * time.Minute
+	//单个终端会话的最长时间，0表示不限制
+	TerminalMaxDuration = 8 * time.Hour
+	//临时调试容器的镜像，用于调试没有shell的容器，镜像的默认命令需要是shell
+	DebugImage = "busybox:1.36"
+	//等待调试容器启动的超时时间
+	DebugStartTimeout = 60 * time.Second
+	//单个端口转发连接的最长时间，0表示不限制
+	PortForwardMaxDuration = time.Hour
+	//同时进行的端口转发连接数量上限，分为全局和单个用户，0表示不限制
+	PortForwardMaxSessions     = 200
+	PortForwardMaxUserSessions = 10
+	//集群缓存的同步超时时间，超时后未同步完成的资源直接请求apiserver，不再影响就绪检查
+	CacheSyncTimeout = 2 * time.Minute
+	//加密集群kubeconfig等敏感数据的密钥，长度必须为16、24或32字节
+	EncryptKey = ""
+	//jwt签名密钥，json数组格式，支持HS256、RS256、ES256，如：
+	//[{"kid":"k1","alg":"HS256","secret":"xxx"},{"kid":"k2","alg":"RS256","private_key":"/path/to/private.pem"}]
+	JWTKeys = ""
+	//签发token使用的密钥kid，其他密钥只用于校验，轮换密钥时新增密钥并修改此项即可
+	JWTActiveKid = ""
+	//access token和refresh token的有效期
+	JWTExpire        = 2 * time.Hour
+	JWTRefreshExpire = 7 * 24 * time.Hour
+	//初始管理员账户名和密码，用户表为空时自动创建
+	//之后的用户通过/api/user接口管理
 	AdminUser = "admin"
-	AdminPwd  = "qwer1234"
+	AdminPwd  = ""
+	//OIDC单点登录配置，OIDCIssuer为空时不启用
+	//OIDCRedirectURL为平台的回调地址，即<平台地址>/api/oidc/callback，需要在身份提供方处登记
+	OIDCIssuer       = ""
+	OIDCClientID     = ""
+	OIDCClientSecret = ""
+	OIDCRedirectURL  = ""
+	OIDCScopes       = "openid profile email groups"
+	//id_token中用户名和用户组对应的claim
+	OIDCUsernameClaim = "preferred_username"
+	OIDCGroupsClaim   = "groups"
+	//用户组与平台角色的对应关系，json数组格式，每次登录时根据用户组重新生成角色绑定，如：
+	//[{"group":"k8s-admin","role":"admin"},{"group":"dev","role":"developer","cluster":"default","namespace":"dev"}]
+	OIDCGroupRoles = ""
+	//登录成功后跳转的前端地址，token通过url的fragment传递，为空时回调接口直接返回json
+	OIDCSuccessURL = ""
+	//用户名密码登录的认证后端，逗号分隔，按顺序依次尝试，支持local和ldap
+	AuthBackends = "local"
+	//LDAP配置，ldap_url支持ldap://和ldaps://
+	//先使用LDAPBindDN搜索用户，再使用用户的DN和密码bind校验密码
+	LDAPURL     = ""
+	LDAPBindDN  = ""
+	LDAPBindPwd = ""
+	LDAPBaseDN  = ""
+	//搜索用户的过滤条件，%s替换为转义后的用户名
+	LDAPUserFilter = "(uid=%s)"
+	//用户条目中表示所属用户组DN的属性
+	LDAPGroupAttr = "memberOf"
+	//不支持memberOf的服务器可以配置用户组搜索，%s替换为转义后的用户DN，如(member=%s)
+	LDAPGroupBaseDN = ""
+	LDAPGroupFilter = ""
+	//用户组DN与平台角色的对应关系，格式同OIDCGroupRoles，group为用户组DN，不区分大小写
+	LDAPGroupRoles = ""
+	//连接LDAP服务器的超时时间
+	LDAPTimeout = 10 * time.Second
 )
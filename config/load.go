@@ -0,0 +1,281 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+//环境变量前缀，如listen_addr对应的环境变量为K8S_PLATFORM_LISTEN_ADDR
+const envPrefix = "K8S_PLATFORM_"
+
+//option定义单个配置项
+//key是配置文件中的key，也是命令行参数名（下划线换成中划线）
+//value是配置项变量的指针，支持*string、*int和*time.Duration
+type option struct {
+	key      string
+	value    interface{}
+	required bool
+	usage    string
+}
+
+var options = []*option{
+	{key: "listen_addr", value: &ListenAddr, required: true, usage: "监听地址"},
+	{key: "kubeconfigs", value: &Kubeconfigs, usage: "多集群kubeconfig文件路径，json格式，key为集群名"},
+	{key: "default_cluster", value: &DefaultCluster, required: true, usage: "默认集群名"},
+	{key: "db_type", value: &DbType, required: true, usage: "数据库类型，目前只支持mysql"},
+	{key: "db_user", value: &DbUser, required: true, usage: "数据库用户名"},
+	{key: "db_pwd", value: &DbPwd, usage: "数据库密码"},
+	{key: "db_host", value: &DbHost, required: true, usage: "数据库地址"},
+	{key: "db_port", value: &DbPort, required: true, usage: "数据库端口"},
+	{key: "db_name", value: &DbName, required: true, usage: "数据库名"},
+	{key: "max_idle_conns", value: &MaxIdleConns, required: true, usage: "连接池最大空闲连接数"},
+	{key: "max_open_conns", value: &MaxOpenConns, required: true, usage: "连接池最大连接数"},
+	{key: "max_life_time", value: &MaxLifeTime, required: true, usage: "连接最大生存时间，如30s"},
+	{key: "pod_log_tail_line", value: &PodLogTailLine, required: true, usage: "Pod日志显示行数"},
+	{key: "pod_log_write_timeout", value: &PodLogWriteTimeout, required: true, usage: "流式日志写入客户端的超时时间，如10s"},
+	{key: "pod_log_aggregate_max_pods", value: &PodLogAggregateMaxPods, required: true, usage: "聚合日志最多同时推送的pod数量"},
+	{key: "pod_file_max_size", value: &PodFileMaxSize, required: true, usage: "上传、下载容器文件的大小上限，单位MB"},
+	{key: "ws_allowed_origins", value: &WsAllowedOrigins, usage: "允许建立WebSocket连接的页面Origin，逗号分隔，为空时只允许同域页面"},
+	{key: "terminal_shells", value: &TerminalShells, required: true, usage: "终端依次尝试的shell，逗号分隔"},
+	{key: "terminal_record_dir", value: &TerminalRecordDir, usage: "终端录像保存目录，为空时不录像"},
+	{key: "terminal_max_sessions", value: &TerminalMaxSessions, usage: "同时打开的终端数量上限，0表示不限制"},
+	{key: "terminal_max_user_sessions", value: &TerminalMaxUserSessions, usage: "单个用户同时打开的终端数量上限，0表示不限制"},
+	{key: "terminal_idle_timeout", value: &TerminalIdleTimeout, usage: "终端无输入自动断开的时间，如30m，0表示不限制"},
+	{key: "terminal_max_duration", value: &TerminalMaxDuration, usage: "单个终端会话的最长时间，如8h，0表示不限制"},
+	{key: "debug_image", value: &DebugImage, required: true, usage: "临时调试容器的镜像"},
+	{key: "debug_start_timeout", value: &DebugStartTimeout, required: true, usage: "等待调试容器启动的超时时间，如60s"},
+	{key: "port_forward_max_duration", value: &PortForwardMaxDuration, usage: "单个端口转发连接的最长时间，如1h，0表示不限制"},
+	{key: "port_forward_max_sessions", value: &PortForwardMaxSessions, usage: "同时进行的端口转发连接数量上限，0表示不限制"},
+	{key: "port_forward_max_user_sessions", value: &PortForwardMaxUserSessions, usage: "单个用户同时进行的端口转发连接数量上限，0表示不限制"},
+	{key: "cache_sync_timeout", value: &CacheSyncTimeout, required: true, usage: "集群缓存的同步超时时间，如2m"},
+	{key: "encrypt_key", value: &EncryptKey, required: true, usage: "敏感数据加密密钥，长度必须为16、24或32字节"},
+	{key: "jwt_keys", value: &JWTKeys, required: true, usage: "jwt签名密钥，json数组格式"},
+	{key: "jwt_active_kid", value: &JWTActiveKid, required: true, usage: "签发token使用的密钥kid"},
+	{key: "jwt_expire", value: &JWTExpire, required: true, usage: "access token有效期，如2h"},
+	{key: "jwt_refresh_expire", value: &JWTRefreshExpire, required: true, usage: "refresh token有效期，如168h"},
+	{key: "admin_user", value: &AdminUser, required: true, usage: "初始管理员账户名"},
+	{key: "admin_pwd", value: &AdminPwd, usage: "初始管理员密码，用户表为空时必填"},
+	{key: "oidc_issuer", value: &OIDCIssuer, usage: "OIDC身份提供方地址，为空时不启用单点登录"},
+	{key: "oidc_client_id", value: &OIDCClientID, usage: "OIDC client id"},
+	{key: "oidc_client_secret", value: &OIDCClientSecret, usage: "OIDC client secret"},
+	{key: "oidc_redirect_url", value: &OIDCRedirectURL, usage: "OIDC回调地址，即<平台地址>/api/oidc/callback"},
+	{key: "oidc_scopes", value: &OIDCScopes, usage: "OIDC申请的scope，空格分隔"},
+	{key: "oidc_username_claim", value: &OIDCUsernameClaim, usage: "id_token中作为用户名的claim"},
+	{key: "oidc_groups_claim", value: &OIDCGroupsClaim, usage: "id_token中作为用户组的claim"},
+	{key: "oidc_group_roles", value: &OIDCGroupRoles, usage: "用户组与平台角色的对应关系，json数组格式"},
+	{key: "oidc_success_url", value: &OIDCSuccessURL, usage: "OIDC登录成功后跳转的前端地址"},
+	{key: "auth_backends", value: &AuthBackends, required: true, usage: "用户名密码登录的认证后端，逗号分隔，支持local和ldap"},
+	{key: "ldap_url", value: &LDAPURL, usage: "LDAP服务器地址，如ldap://127.0.0.1:389"},
+	{key: "ldap_bind_dn", value: &LDAPBindDN, usage: "搜索用户使用的DN"},
+	{key: "ldap_bind_pwd", value: &LDAPBindPwd, usage: "搜索用户使用的密码"},
+	{key: "ldap_base_dn", value: &LDAPBaseDN, usage: "搜索用户的base DN"},
+	{key: "ldap_user_filter", value: &LDAPUserFilter, usage: "搜索用户的过滤条件，%s替换为用户名"},
+	{key: "ldap_group_attr", value: &LDAPGroupAttr, usage: "用户条目中表示所属用户组DN的属性"},
+	{key: "ldap_group_base_dn", value: &LDAPGroupBaseDN, usage: "搜索用户组的base DN"},
+	{key: "ldap_group_filter", value: &LDAPGroupFilter, usage: "搜索用户组的过滤条件，%s替换为用户DN"},
+	{key: "ldap_group_roles", value: &LDAPGroupRoles, usage: "用户组DN与平台角色的对应关系，json数组格式"},
+	{key: "ldap_timeout", value: &LDAPTimeout, required: true, usage: "连接LDAP服务器的超时时间，如10s"},
+}
+
+func (o *option) env() string {
+	return envPrefix + strings.ToUpper(o.key)
+}
+
+func (o *option) flag() string {
+	return strings.ReplaceAll(o.key, "_", "-")
+}
+
+//将字符串形式的值转换后写入配置项变量
+func (o *option) set(value string) error {
+	switch p := o.value.(type) {
+	case *string:
+		*p = value
+	case *int:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("配置项%s必须为整数，当前值：%s", o.key, value)
+		}
+		*p = v
+	case *time.Duration:
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("配置项%s必须为时长（如30s），当前值：%s", o.key, value)
+		}
+		*p = v
+	}
+	return nil
+}
+
+//判断配置项是否为空值
+func (o *option) empty() bool {
+	switch p := o.value.(type) {
+	case *string:
+		return *p == ""
+	case *int:
+		return *p <= 0
+	case *time.Duration:
+		return *p <= 0
+	}
+	return false
+}
+
+//Init加载配置，优先级从低到高为：默认值、配置文件、环境变量、命令行参数
+//配置文件通过-config参数或K8S_PLATFORM_CONFIG环境变量指定，支持yaml和toml格式
+func Init(args []string) (err error) {
+	fs := flag.NewFlagSet("k8s-platform", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "配置文件路径，支持yaml和toml格式")
+	for _, o := range options {
+		fs.String(o.flag(), "", fmt.Sprintf("%s（环境变量%s）", o.usage, o.env()))
+	}
+	if err = fs.Parse(args); err != nil {
+		return err
+	}
+	//配置文件
+	if *configFile != "" {
+		if err = loadFile(*configFile); err != nil {
+			return err
+		}
+	}
+	//环境变量
+	for _, o := range options {
+		if value, ok := os.LookupEnv(o.env()); ok {
+			if err = o.set(value); err != nil {
+				return err
+			}
+		}
+	}
+	//命令行参数，只处理显式传入的参数，避免空的默认值覆盖前面的配置
+	fs.Visit(func(f *flag.Flag) {
+		for _, o := range options {
+			if err == nil && o.flag() == f.Name {
+				err = o.set(f.Value.String())
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return validate()
+}
+
+//读取配置文件，根据扩展名选择yaml或toml解析
+func loadFile(path string) (err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return errors.New("读取配置文件失败，" + err.Error())
+	}
+	values := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &values)
+	case ".toml":
+		err = toml.Unmarshal(content, &values)
+	default:
+		return errors.New("不支持的配置文件格式：" + path)
+	}
+	if err != nil {
+		return errors.New("解析配置文件失败，" + err.Error())
+	}
+	for key, value := range values {
+		o := findOption(key)
+		if o == nil {
+			return errors.New("配置文件中存在未知的配置项：" + key)
+		}
+		var str string
+		switch v := value.(type) {
+		case string:
+			str = v
+		case map[string]interface{}, []interface{}:
+			//kubeconfigs等配置在文件中可以直接写成map，这里统一转为json字符串
+			b, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("配置项%s格式错误，%s", key, err.Error())
+			}
+			str = string(b)
+		default:
+			str = fmt.Sprint(v)
+		}
+		if err = o.set(str); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func findOption(key string) *option {
+	for _, o := range options {
+		if o.key == key {
+			return o
+		}
+	}
+	return nil
+}
+
+//校验配置，将所有不合法的配置项一次性返回
+func validate() error {
+	var msgs []string
+	for _, o := range options {
+		if o.required && o.empty() {
+			msgs = append(msgs, fmt.Sprintf("缺少必填配置项%s（环境变量%s或命令行参数-%s）", o.key, o.env(), o.flag()))
+		}
+	}
+	if DbType != "mysql" {
+		msgs = append(msgs, "db_type目前只支持mysql")
+	}
+	if EncryptKey != "" {
+		if l := len(EncryptKey); l != 16 && l != 24 && l != 32 {
+			msgs = append(msgs, "encrypt_key长度必须为16、24或32字节")
+		}
+	}
+	if Kubeconfigs != "" {
+		kubeconfigs := map[string]string{}
+		if err := json.Unmarshal([]byte(Kubeconfigs), &kubeconfigs); err != nil {
+			msgs = append(msgs, "kubeconfigs格式错误，"+err.Error())
+		}
+	}
+	if OIDCIssuer != "" {
+		if OIDCClientID == "" || OIDCRedirectURL == "" {
+			msgs = append(msgs, "启用OIDC时oidc_client_id和oidc_redirect_url不能为空")
+		}
+		if OIDCGroupRoles != "" {
+			var groupRoles []map[string]string
+			if err := json.Unmarshal([]byte(OIDCGroupRoles), &groupRoles); err != nil {
+				msgs = append(msgs, "oidc_group_roles格式错误，"+err.Error())
+			}
+		}
+	}
+	for _, backend := range strings.Split(AuthBackends, ",") {
+		switch strings.TrimSpace(backend) {
+		case "local":
+		case "ldap":
+			if LDAPURL == "" || LDAPBaseDN == "" {
+				msgs = append(msgs, "启用ldap认证时ldap_url和ldap_base_dn不能为空")
+			}
+			if !strings.Contains(LDAPUserFilter, "%s") {
+				msgs = append(msgs, "ldap_user_filter中必须包含%s")
+			}
+			if LDAPGroupRoles != "" {
+				var groupRoles []map[string]string
+				if err := json.Unmarshal([]byte(LDAPGroupRoles), &groupRoles); err != nil {
+					msgs = append(msgs, "ldap_group_roles格式错误，"+err.Error())
+				}
+			}
+		default:
+			msgs = append(msgs, "auth_backends中存在不支持的认证后端："+backend)
+		}
+	}
+	if len(msgs) > 0 {
+		return errors.New("配置校验失败：\n" + strings.Join(msgs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"fmt"
+	"k8s-platform/dao"
+	"k8s-platform/service"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wonderivan/logger"
+)
+
+var Audit audit
+
+type audit struct{}
+
+//获取审计日志列表，支持过滤、分页
+func (a *audit) GetAudits(ctx *gin.Context) {
+	params := new(struct {
+		dao.AuditFilter
+		Page  int `form:"page"`
+		Limit int `form:"limit"`
+	})
+	if err := ctx.Bind(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.Audit.GetAudits(&params.AuditFilter, params.Page, params.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "获取审计日志成功",
+		"data": data,
+	})
+}
+
+//按条件导出审计日志为csv文件
+func (a *audit) ExportAudits(ctx *gin.Context) {
+	filter := new(dao.AuditFilter)
+	if err := ctx.Bind(filter); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit-%s.csv", time.Now().Format("20060102150405")))
+	//导出过程中出错时响应头已经写出，只能记录错误日志
+	if err := service.Audit.Export(filter, ctx.Writer); err != nil {
+		logger.Error("导出审计日志失败，" + err.Error())
+	}
+}
@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"k8s-platform/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wonderivan/logger"
+)
+
+var Cluster cluster
+
+type cluster struct{}
+
+//获取集群列表
+func (c *cluster) GetClusters(ctx *gin.Context) {
+	data := service.Cluster.GetClusters()
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "获取集群列表成功",
+		"data": data,
+	})
+}
+
+//添加集群
+func (c *cluster) AddCluster(ctx *gin.Context) {
+	var (
+		clusterCreate = new(service.ClusterCreate)
+		err           error
+	)
+	if err = ctx.ShouldBindJSON(clusterCreate); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if err = service.Cluster.AddCluster(clusterCreate); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "添加集群成功",
+		"data": nil,
+	})
+}
+
+//更新集群kubeconfig
+func (c *cluster) UpdateCluster(ctx *gin.Context) {
+	var (
+		clusterCreate = new(service.ClusterCreate)
+		err           error
+	)
+	if err = ctx.ShouldBindJSON(clusterCreate); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if err = service.Cluster.UpdateCluster(clusterCreate); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "更新集群成功",
+		"data": nil,
+	})
+}
+
+//测试集群连通性
+func (c *cluster) TestCluster(ctx *gin.Context) {
+	params := new(struct {
+		Name string `form:"name"`
+	})
+	if err := ctx.Bind(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.Cluster.TestCluster(params.Name)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "集群连接成功",
+		"data": data,
+	})
+}
+
+//删除集群
+func (c *cluster) DeleteCluster(ctx *gin.Context) {
+	params := new(struct {
+		Name string `json:"name"`
+	})
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if err := service.Cluster.DeleteCluster(params.Name); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "删除集群成功",
+		"data": nil,
+	})
+}
+
+//就绪检查，所有集群的缓存同步完成或同步超时前返回503，供k8s的readinessProbe使用
+//该接口免登录，不返回集群信息，具体状态通过/api/k8s/cluster/cache查看
+func (c *cluster) Ready(ctx *gin.Context) {
+	if ready, _ := service.K8s.Ready(); !ready {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"msg":  "集群缓存同步中",
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "就绪",
+		"data": nil,
+	})
+}
+
+//获取集群缓存状态
+func (c *cluster) GetCacheStatus(ctx *gin.Context) {
+	params := new(struct {
+		Cluster string `form:"cluster"`
+	})
+	if err := ctx.Bind(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "获取集群缓存状态成功",
+		"data": service.K8s.GetCacheStatus(params.Cluster),
+	})
+}
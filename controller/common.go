@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+//各资源列表接口共用的方法
+
+//获取RBAC中间件传入的有权限的namespace，返回nil表示不限制
+func allowedNamespaces(ctx *gin.Context) []string {
+	if namespaces, ok := ctx.Get("allowed_namespaces"); ok {
+		return namespaces.([]string)
+	}
+	return nil
+}
+
+//校验列表接口的namespace参数，查询所有namespace时必须显式传all_namespaces=true，不能与namespace同时传
+func checkListNamespace(namespace string, allNamespaces bool) error {
+	if allNamespaces && namespace != "" {
+		return errors.New("all_namespaces和namespace不能同时传")
+	}
+	if !allNamespaces && namespace == "" {
+		return errors.New("namespace不能为空，查询所有namespace时传all_namespaces=true")
+	}
+	return nil
+}
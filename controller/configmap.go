@@ -19,10 +19,16 @@ var ConfigMap configMap
 //获取configmap列表，支持过滤、排序、分页
 func (c *configMap) GetConfigMaps(ctx *gin.Context) {
 	params := new(struct {
-		FilterName string `form:"filter_name"`
-		Namespace  string `form:"namespace"`
-		Page       int    `form:"page"`
-		Limit      int    `form:"limit"`
+		Cluster       string `form:"cluster"`
+		FilterName    string `form:"filter_name"`
+		LabelSelector string `form:"label_selector"`
+		FieldSelector string `form:"field_selector"`
+		SortBy        string `form:"sort_by"`
+		Order         string `form:"order"`
+		Namespace     string `form:"namespace"`
+		AllNamespaces bool   `form:"all_namespaces"`
+		Page          int    `form:"page"`
+		Limit         int    `form:"limit"`
 	})
 	if err := ctx.Bind(params); err != nil {
 		logger.Error("Bind请求参数失败，" + err.Error())
@@ -32,7 +38,40 @@ func (c *configMap) GetConfigMaps(ctx *gin.Context) {
 		})
 		return
 	}
-	data, err := service.ConfigMap.GetConfigMaps(params.FilterName, params.Namespace, params.Limit, params.Page)
+	filter, err := service.NewFilterQuery(params.FilterName, params.LabelSelector, params.FieldSelector, service.ConfigMapFieldColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	sort, err := service.NewSortQuery(params.SortBy, params.Order, service.ConfigMapSortColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if err = checkListNamespace(params.Namespace, params.AllNamespaces); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	//跨namespace查询时只返回有权限的namespace中的资源
+	filter.Namespaces = allowedNamespaces(ctx)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.ConfigMap.GetConfigMaps(client, filter, sort, params.Namespace, params.Limit, params.Page)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -49,6 +88,7 @@ func (c *configMap) GetConfigMaps(ctx *gin.Context) {
 //获取configmap详情
 func (c *configMap) GetConfigMapDetail(ctx *gin.Context) {
 	params := new(struct {
+		Cluster       string `form:"cluster"`
 		ConfigMapName string `form:"configmap_name"`
 		Namespace     string `form:"namespace"`
 	})
@@ -60,7 +100,15 @@ func (c *configMap) GetConfigMapDetail(ctx *gin.Context) {
 		})
 		return
 	}
-	data, err := service.ConfigMap.GetConfigMapDetail(params.ConfigMapName, params.Namespace)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.ConfigMap.GetConfigMapDetail(client, params.ConfigMapName, params.Namespace)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -77,6 +125,7 @@ func (c *configMap) GetConfigMapDetail(ctx *gin.Context) {
 //删除configmap
 func (c *configMap) DeleteConfigMap(ctx *gin.Context) {
 	params := new(struct {
+		Cluster       string `json:"cluster"`
 		ConfigMapName string `json:"configmap_name"`
 		Namespace     string `json:"namespace"`
 	})
@@ -89,7 +138,15 @@ func (c *configMap) DeleteConfigMap(ctx *gin.Context) {
 		})
 		return
 	}
-	err := service.ConfigMap.DeleteConfigMap(params.ConfigMapName, params.Namespace)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	err = service.ConfigMap.DeleteConfigMap(client, params.ConfigMapName, params.Namespace)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -106,6 +163,7 @@ func (c *configMap) DeleteConfigMap(ctx *gin.Context) {
 //更新configmap
 func (c *configMap) UpdateConfigMap(ctx *gin.Context) {
 	params := new(struct {
+		Cluster   string `json:"cluster"`
 		Namespace string `json:"namespace"`
 		Content   string `json:"content"`
 	})
@@ -118,7 +176,15 @@ func (c *configMap) UpdateConfigMap(ctx *gin.Context) {
 		})
 		return
 	}
-	err := service.ConfigMap.UpdateConfigMap(params.Namespace, params.Content)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	err = service.ConfigMap.UpdateConfigMap(client, params.Namespace, params.Content)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
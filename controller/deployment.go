@@ -20,10 +20,16 @@ var Deployment deployment
 //获取deployment列表，支持过滤、排序、分页
 func (d *deployment) GetDeployments(ctx *gin.Context) {
 	params := new(struct {
-		FilterName string `form:"filter_name"`
-		Namespace  string `form:"namespace"`
-		Page       int    `form:"page"`
-		Limit      int    `form:"limit"`
+		Cluster       string `form:"cluster"`
+		FilterName    string `form:"filter_name"`
+		LabelSelector string `form:"label_selector"`
+		FieldSelector string `form:"field_selector"`
+		SortBy        string `form:"sort_by"`
+		Order         string `form:"order"`
+		Namespace     string `form:"namespace"`
+		AllNamespaces bool   `form:"all_namespaces"`
+		Page          int    `form:"page"`
+		Limit         int    `form:"limit"`
 	})
 	if err := ctx.Bind(params); err != nil {
 		logger.Error("Bind请求参数失败，" + err.Error())
@@ -33,7 +39,40 @@ func (d *deployment) GetDeployments(ctx *gin.Context) {
 		})
 		return
 	}
-	data, err := service.Deployment.GetDeployments(params.FilterName, params.Namespace, params.Limit, params.Page)
+	filter, err := service.NewFilterQuery(params.FilterName, params.LabelSelector, params.FieldSelector, service.DeploymentFieldColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	sort, err := service.NewSortQuery(params.SortBy, params.Order, service.DeploymentSortColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if err = checkListNamespace(params.Namespace, params.AllNamespaces); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	//跨namespace查询时只返回有权限的namespace中的资源
+	filter.Namespaces = allowedNamespaces(ctx)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.Deployment.GetDeployments(client, filter, sort, params.Namespace, params.Limit, params.Page)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -50,6 +89,7 @@ func (d *deployment) GetDeployments(ctx *gin.Context) {
 //获取deployment详情
 func (d *deployment) GetDeploymentDetail(ctx *gin.Context) {
 	params := new(struct {
+		Cluster        string `form:"cluster"`
 		DeploymentName string `form:"deployment_name"`
 		Namespace      string `form:"namespace"`
 	})
@@ -61,7 +101,15 @@ func (d *deployment) GetDeploymentDetail(ctx *gin.Context) {
 		})
 		return
 	}
-	data, err := service.Deployment.GetDeploymentDetail(params.DeploymentName, params.Namespace)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.Deployment.GetDeploymentDetail(client, params.DeploymentName, params.Namespace)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -90,8 +138,16 @@ func (d *deployment) CreateDeployment(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(deployCreate.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 	fmt.Println(deployCreate)
-	if err = service.Deployment.CreateDeployment(deployCreate); err != nil {
+	if err = service.Deployment.CreateDeployment(client, deployCreate); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
 			"data": nil,
@@ -107,6 +163,7 @@ func (d *deployment) CreateDeployment(ctx *gin.Context) {
 func (d *deployment) ScaleDeployment(ctx *gin.Context) {
 	fmt.Println("ctx", ctx)
 	params := new(struct {
+		Cluster        string `json:"cluster"`
 		DeploymentName string `json:"deployment_name"`
 		Namespace      string `json:"namespace"`
 		ScaleNum       int    `json:"scale_num"`
@@ -120,8 +177,16 @@ func (d *deployment) ScaleDeployment(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 	fmt.Println("params", params)
-	data, err := service.Deployment.ScaleDeployment(params.DeploymentName, params.Namespace, params.ScaleNum)
+	data, err := service.Deployment.ScaleDeployment(client, params.DeploymentName, params.Namespace, params.ScaleNum)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -138,6 +203,7 @@ func (d *deployment) ScaleDeployment(ctx *gin.Context) {
 //删除deployment
 func (d *deployment) DeleteDeployment(ctx *gin.Context) {
 	params := new(struct {
+		Cluster        string `json:"cluster"`
 		DeploymentName string `json:"deployment_name"`
 		Namespace      string `json:"namespace"`
 	})
@@ -150,7 +216,15 @@ func (d *deployment) DeleteDeployment(ctx *gin.Context) {
 		})
 		return
 	}
-	err := service.Deployment.DeleteDeployment(params.DeploymentName, params.Namespace)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	err = service.Deployment.DeleteDeployment(client, params.DeploymentName, params.Namespace)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -167,6 +241,7 @@ func (d *deployment) DeleteDeployment(ctx *gin.Context) {
 //重启deployment
 func (d *deployment) RestartDeployment(ctx *gin.Context) {
 	params := new(struct {
+		Cluster        string `json:"cluster"`
 		DeploymentName string `json:"deployment_name"`
 		Namespace      string `json:"namespace"`
 		ImageName      string `json:"image_name"`
@@ -181,7 +256,15 @@ func (d *deployment) RestartDeployment(ctx *gin.Context) {
 		})
 		return
 	}
-	err := service.Deployment.RestartDeployment(params.DeploymentName, params.Namespace, params.ImageName, params.Image)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	err = service.Deployment.RestartDeployment(client, params.DeploymentName, params.Namespace, params.ImageName, params.Image)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -198,6 +281,7 @@ func (d *deployment) RestartDeployment(ctx *gin.Context) {
 //更新deployment
 func (d *deployment) UpdateDeployment(ctx *gin.Context) {
 	params := new(struct {
+		Cluster   string `json:"cluster"`
 		Namespace string `json:"namespace"`
 		Content   string `json:"content"`
 	})
@@ -210,7 +294,15 @@ func (d *deployment) UpdateDeployment(ctx *gin.Context) {
 		})
 		return
 	}
-	err := service.Deployment.UpdateDeployment(params.Namespace, params.Content)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	err = service.Deployment.UpdateDeployment(client, params.Namespace, params.Content)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -226,7 +318,26 @@ func (d *deployment) UpdateDeployment(ctx *gin.Context) {
 
 //获取每个namespace的pod数量
 func (d *deployment) GetDeployNumPerNp(ctx *gin.Context) {
-	data, err := service.Deployment.GetDeployNumPerNp()
+	params := new(struct {
+		Cluster string `form:"cluster"`
+	})
+	if err := ctx.Bind(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.Deployment.GetDeployNumPerNp(client, allowedNamespaces(ctx))
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -15,10 +15,16 @@ type ingress struct{}
 //获取ingress列表，支持过滤、排序、分页
 func (i *ingress) GetIngresses(ctx *gin.Context) {
 	params := new(struct {
-		FilterName string `form:"filter_name"`
-		Namespace  string `form:"namespace"`
-		Page       int    `form:"page"`
-		Limit      int    `form:"limit"`
+		Cluster       string `form:"cluster"`
+		FilterName    string `form:"filter_name"`
+		LabelSelector string `form:"label_selector"`
+		FieldSelector string `form:"field_selector"`
+		SortBy        string `form:"sort_by"`
+		Order         string `form:"order"`
+		Namespace     string `form:"namespace"`
+		AllNamespaces bool   `form:"all_namespaces"`
+		Page          int    `form:"page"`
+		Limit         int    `form:"limit"`
 	})
 	if err := ctx.Bind(params); err != nil {
 		logger.Error("Bind请求参数失败, " + err.Error())
@@ -28,8 +34,41 @@ func (i *ingress) GetIngresses(ctx *gin.Context) {
 		})
 		return
 	}
+	filter, err := service.NewFilterQuery(params.FilterName, params.LabelSelector, params.FieldSelector, service.IngressFieldColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	sort, err := service.NewSortQuery(params.SortBy, params.Order, service.IngressSortColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if err = checkListNamespace(params.Namespace, params.AllNamespaces); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	//跨namespace查询时只返回有权限的namespace中的资源
+	filter.Namespaces = allowedNamespaces(ctx)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	data, err := service.Ingress.GetIngresses(params.FilterName, params.Namespace, params.Limit, params.Page)
+	data, err := service.Ingress.GetIngresses(client, filter, sort, params.Namespace, params.Limit, params.Page)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -47,6 +86,7 @@ func (i *ingress) GetIngresses(ctx *gin.Context) {
 //获取ingress详情
 func (i *ingress) GetIngressDetail(ctx *gin.Context) {
 	params := new(struct {
+		Cluster     string `form:"cluster"`
 		IngressName string `form:"ingress_name"`
 		Namespace   string `form:"namespace"`
 	})
@@ -58,8 +98,16 @@ func (i *ingress) GetIngressDetail(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	data, err := service.Ingress.GetIngressDetail(params.IngressName, params.Namespace)
+	data, err := service.Ingress.GetIngressDetail(client, params.IngressName, params.Namespace)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -77,6 +125,7 @@ func (i *ingress) GetIngressDetail(ctx *gin.Context) {
 //删除ingress
 func (i *ingress) DeleteIngress(ctx *gin.Context) {
 	params := new(struct {
+		Cluster     string `json:"cluster"`
 		IngressName string `json:"ingress_name"`
 		Namespace   string `json:"namespace"`
 	})
@@ -89,8 +138,16 @@ func (i *ingress) DeleteIngress(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	err := service.Ingress.DeleteIngress(params.IngressName, params.Namespace)
+	err = service.Ingress.DeleteIngress(client, params.IngressName, params.Namespace)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -119,8 +176,16 @@ func (i *ingress) CreateIngress(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(ingressCreate.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	if err = service.Ingress.CreateIngress(ingressCreate); err != nil {
+	if err = service.Ingress.CreateIngress(client, ingressCreate); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
 			"data": nil,
@@ -137,6 +202,7 @@ func (i *ingress) CreateIngress(ctx *gin.Context) {
 //更新ingress
 func (i *ingress) UpdateIngress(ctx *gin.Context) {
 	params := new(struct {
+		Cluster   string `json:"cluster"`
 		Namespace string `json:"namespace"`
 		Content   string `json:"content"`
 	})
@@ -149,8 +215,16 @@ func (i *ingress) UpdateIngress(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	err := service.Ingress.UpdateIngress(params.Namespace, params.Content)
+	err = service.Ingress.UpdateIngress(client, params.Namespace, params.Content)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
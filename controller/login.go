@@ -1,8 +1,13 @@
 package controller
 
 import (
+	"k8s-platform/config"
 	"k8s-platform/service"
+	"k8s-platform/utils"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/wonderivan/logger"
@@ -27,7 +32,7 @@ func (l *login) Auth(ctx *gin.Context) {
 		return
 	}
 
-	err := service.Login.Auth(params.UserName, params.Password)
+	data, err := service.Login.Auth(params.UserName, params.Password)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -38,6 +43,138 @@ func (l *login) Auth(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"msg":  "登录成功",
+		"data": data,
+	})
+}
+
+//使用refresh token换取新的token
+func (l *login) Refresh(ctx *gin.Context) {
+	params := new(struct {
+		RefreshToken string `json:"refresh_token"`
+	})
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error("Bind请求参数失败, " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.Token.Refresh(params.RefreshToken)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "刷新token成功",
+		"data": data,
+	})
+}
+
+//退出登录，注销当前token，body中可以传入refresh_token一并注销
+func (l *login) Logout(ctx *gin.Context) {
+	params := new(struct {
+		RefreshToken string `json:"refresh_token"`
+	})
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error("Bind请求参数失败, " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	claims := ctx.MustGet("claims").(*utils.CustomClaims)
+	if err := service.Token.Logout(claims, params.RefreshToken); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "退出登录成功",
 		"data": nil,
 	})
 }
+
+//保存OIDC登录state的cookie，回调时校验是同一个浏览器发起的登录
+const (
+	oidcStateCookie = "oidc_state"
+	oidcCookiePath  = "/api/oidc"
+)
+
+//设置或清除保存state的cookie，maxAge小于0时清除
+//身份提供方回调是跳转过来的GET请求，SameSite=Lax的cookie会被带上
+func setOIDCStateCookie(ctx *gin.Context, state string, maxAge int) {
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	secure := strings.HasPrefix(config.OIDCRedirectURL, "https://")
+	ctx.SetCookie(oidcStateCookie, state, maxAge, oidcCookiePath, "", secure, true)
+}
+
+//跳转到OIDC身份提供方登录
+func (l *login) OIDCLogin(ctx *gin.Context) {
+	loginURL, state, err := service.OIDC.LoginURL()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	setOIDCStateCookie(ctx, state, int(service.OIDCStateExpire.Seconds()))
+	ctx.Redirect(http.StatusFound, loginURL)
+}
+
+//OIDC身份提供方登录后的回调，签发平台自己的token
+//配置了oidc_success_url时跳转到前端，token放在fragment中，避免出现在服务端访问日志里
+func (l *login) OIDCCallback(ctx *gin.Context) {
+	params := new(struct {
+		Code             string `form:"code"`
+		State            string `form:"state"`
+		Error            string `form:"error"`
+		ErrorDescription string `form:"error_description"`
+	})
+	if err := ctx.Bind(params); err != nil {
+		logger.Error("Bind请求参数失败, " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if params.Error != "" {
+		ctx.JSON(http.StatusUnauthorized, gin.H{
+			"msg":  "OIDC登录失败，" + params.Error + " " + params.ErrorDescription,
+			"data": nil,
+		})
+		return
+	}
+	//cookie只用于本次回调，读取后清除
+	cookieState, _ := ctx.Cookie(oidcStateCookie)
+	setOIDCStateCookie(ctx, "", -1)
+	data, err := service.OIDC.Callback(params.Code, params.State, cookieState)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if config.OIDCSuccessURL != "" {
+		fragment := url.Values{}
+		fragment.Set("username", data.Username)
+		fragment.Set("token", data.Token)
+		fragment.Set("refresh_token", data.RefreshToken)
+		fragment.Set("expires_at", strconv.FormatInt(data.ExpiresAt, 10))
+		ctx.Redirect(http.StatusFound, config.OIDCSuccessURL+"#"+fragment.Encode())
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "登录成功",
+		"data": data,
+	})
+}
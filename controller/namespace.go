@@ -19,9 +19,14 @@ var Namespace namespace
 //获取namespace列表，支持过滤、排序、分页
 func (n *namespace) GetNamespaces(ctx *gin.Context) {
 	params := new(struct {
-		FilterName string `form:"filter_name"`
-		Page       int    `form:"page"`
-		Limit      int    `form:"limit"`
+		Cluster       string `form:"cluster"`
+		FilterName    string `form:"filter_name"`
+		LabelSelector string `form:"label_selector"`
+		FieldSelector string `form:"field_selector"`
+		SortBy        string `form:"sort_by"`
+		Order         string `form:"order"`
+		Page          int    `form:"page"`
+		Limit         int    `form:"limit"`
 	})
 	if err := ctx.Bind(params); err != nil {
 		logger.Error("Bind请求参数失败，" + err.Error())
@@ -31,7 +36,31 @@ func (n *namespace) GetNamespaces(ctx *gin.Context) {
 		})
 		return
 	}
-	data, err := service.Namespace.GetNamespaces(params.FilterName, params.Limit, params.Page)
+	filter, err := service.NewFilterQuery(params.FilterName, params.LabelSelector, params.FieldSelector, service.NamespaceFieldColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	sort, err := service.NewSortQuery(params.SortBy, params.Order, service.NamespaceSortColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.Namespace.GetNamespaces(client, filter, sort, allowedNamespaces(ctx), params.Limit, params.Page)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -48,6 +77,7 @@ func (n *namespace) GetNamespaces(ctx *gin.Context) {
 //获取namespace详情
 func (n *namespace) GetNamespaceDetail(ctx *gin.Context) {
 	params := new(struct {
+		Cluster       string `form:"cluster"`
 		NamespaceName string `form:"namespace_name"`
 	})
 	if err := ctx.Bind(params); err != nil {
@@ -58,8 +88,16 @@ func (n *namespace) GetNamespaceDetail(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	data, err := service.Namespace.GetNamespaceDetail(params.NamespaceName)
+	data, err := service.Namespace.GetNamespaceDetail(client, params.NamespaceName)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -76,6 +114,7 @@ func (n *namespace) GetNamespaceDetail(ctx *gin.Context) {
 //删除namespace
 func (n *namespace) DeleteNamespace(ctx *gin.Context) {
 	params := new(struct {
+		Cluster       string `json:"cluster"`
 		NamespaceName string `json:"namespace_name"`
 	})
 	//DELETE请求，绑定参数方法改为ctx.ShouldBindJSON
@@ -87,7 +126,15 @@ func (n *namespace) DeleteNamespace(ctx *gin.Context) {
 		})
 		return
 	}
-	err := service.Namespace.DeleteNamespace(params.NamespaceName)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	err = service.Namespace.DeleteNamespace(client, params.NamespaceName)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
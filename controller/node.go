@@ -15,9 +15,14 @@ type node struct{}
 //获取node列表，支持过滤、排序、分页
 func (n *node) GetNodes(ctx *gin.Context) {
 	params := new(struct {
-		FilterName string `form:"filter_name"`
-		Page       int    `form:"page"`
-		Limit      int    `form:"limit"`
+		Cluster       string `form:"cluster"`
+		FilterName    string `form:"filter_name"`
+		LabelSelector string `form:"label_selector"`
+		FieldSelector string `form:"field_selector"`
+		SortBy        string `form:"sort_by"`
+		Order         string `form:"order"`
+		Page          int    `form:"page"`
+		Limit         int    `form:"limit"`
 	})
 	if err := ctx.Bind(params); err != nil {
 		logger.Error("Bind请求参数失败, " + err.Error())
@@ -27,8 +32,32 @@ func (n *node) GetNodes(ctx *gin.Context) {
 		})
 		return
 	}
+	filter, err := service.NewFilterQuery(params.FilterName, params.LabelSelector, params.FieldSelector, service.NodeFieldColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	sort, err := service.NewSortQuery(params.SortBy, params.Order, service.NodeSortColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	data, err := service.Node.GetNodes(params.FilterName, params.Limit, params.Page)
+	data, err := service.Node.GetNodes(client, filter, sort, params.Limit, params.Page)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -46,6 +75,7 @@ func (n *node) GetNodes(ctx *gin.Context) {
 //获取node详情
 func (n *node) GetNodeDetail(ctx *gin.Context) {
 	params := new(struct {
+		Cluster  string `form:"cluster"`
 		NodeName string `form:"node_name"`
 	})
 	if err := ctx.Bind(params); err != nil {
@@ -56,8 +86,16 @@ func (n *node) GetNodeDetail(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	data, err := service.Node.GetNodeDetail(params.NodeName)
+	data, err := service.Node.GetNodeDetail(client, params.NodeName)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
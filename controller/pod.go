@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"k8s-platform/service"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/wonderivan/logger"
@@ -24,10 +25,17 @@ type pod struct{}
 func (p *pod) GetPods(ctx *gin.Context) {
 	//匿名结构体，用于声明入参，get请求为form格式，其他请求为json格式
 	params := new(struct {
-		FilterName string `form:"filter_name"`
-		Namespace  string `form:"namespace"`
-		Page       int    `form:"page"`
-		Limit      int    `form:"limit"`
+		Cluster       string `form:"cluster"`
+		FilterName    string `form:"filter_name"`
+		LabelSelector string `form:"label_selector"`
+		FieldSelector string `form:"field_selector"`
+		SortBy        string `form:"sort_by"`
+		Order         string `form:"order"`
+		Namespace     string `form:"namespace"`
+		AllNamespaces bool   `form:"all_namespaces"`
+		View          string `form:"view"`
+		Page          int    `form:"page"`
+		Limit         int    `form:"limit"`
 	})
 	//绑定参数，给匿名结构体中的属性赋值，值是入参
 	//form格式(Get)使用ctx.Bind方法，json格式使用ctx.ShouldBindJSON方法
@@ -40,8 +48,52 @@ func (p *pod) GetPods(ctx *gin.Context) {
 		})
 		return
 	}
+	filter, err := service.NewFilterQuery(params.FilterName, params.LabelSelector, params.FieldSelector, service.PodFieldColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	sort, err := service.NewSortQuery(params.SortBy, params.Order, service.PodSortColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if err = checkListNamespace(params.Namespace, params.AllNamespaces); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	//跨namespace查询时只返回有权限的namespace中的资源
+	filter.Namespaces = allowedNamespaces(ctx)
+	//默认返回原始的pod对象，view=summary时返回摘要信息
+	if params.View == "" {
+		params.View = service.PodViewFull
+	}
+	if params.View != service.PodViewFull && params.View != service.PodViewSummary {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  "view只能为full或summary",
+			"data": nil,
+		})
+		return
+	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 	//service中的的方法通过 包名.结构体变量名.方法名 使用，serivce.Pod.GetPods()
-	data, err := service.Pod.GetPods(params.FilterName, params.Namespace, params.Limit, params.Page)
+	data, err := service.Pod.GetPods(client, filter, sort, params.Namespace, params.View, params.Limit, params.Page)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -58,6 +110,7 @@ func (p *pod) GetPods(ctx *gin.Context) {
 //获取pod详情
 func (p *pod) GetPodDetail(ctx *gin.Context) {
 	params := new(struct {
+		Cluster   string `form:"cluster"`
 		PodName   string `form:"pod_name"`
 		Namespace string `form:"namespace"`
 	})
@@ -69,7 +122,15 @@ func (p *pod) GetPodDetail(ctx *gin.Context) {
 		})
 		return
 	}
-	data, err := service.Pod.GetPodDetail(params.PodName, params.Namespace)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.Pod.GetPodDetail(client, params.PodName, params.Namespace)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -87,6 +148,7 @@ func (p *pod) GetPodDetail(ctx *gin.Context) {
 func (p *pod) DeletePod(ctx *gin.Context) {
 
 	params := new(struct {
+		Cluster   string `json:"cluster"`
 		PodName   string `json:"pod_name"`
 		Namespace string `json:"namespace"`
 	})
@@ -100,8 +162,16 @@ func (p *pod) DeletePod(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 	fmt.Println("params", params)
-	err := service.Pod.DeletePod(params.PodName, params.Namespace)
+	err = service.Pod.DeletePod(client, params.PodName, params.Namespace)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -118,6 +188,7 @@ func (p *pod) DeletePod(ctx *gin.Context) {
 //更新pod
 func (p *pod) UpdatePod(ctx *gin.Context) {
 	params := new(struct {
+		Cluster   string `json:"cluster"`
 		Namespace string `json:"namespace"`
 		Content   string `json:"content"`
 	})
@@ -130,7 +201,15 @@ func (p *pod) UpdatePod(ctx *gin.Context) {
 		})
 		return
 	}
-	err := service.Pod.UpdatePod(params.Namespace, params.Content)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	err = service.Pod.UpdatePod(client, params.Namespace, params.Content)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -147,6 +226,7 @@ func (p *pod) UpdatePod(ctx *gin.Context) {
 //获取pod容量
 func (p *pod) GetPodContainer(ctx *gin.Context) {
 	params := new(struct {
+		Cluster   string `form:"cluster"`
 		PodName   string `form:"pod_name"`
 		Namespace string `form:"namespace"`
 	})
@@ -159,7 +239,15 @@ func (p *pod) GetPodContainer(ctx *gin.Context) {
 		})
 		return
 	}
-	data, err := service.Pod.GetPodContainer(params.PodName, params.Namespace)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.Pod.GetPodContainer(client, params.PodName, params.Namespace)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -175,10 +263,20 @@ func (p *pod) GetPodContainer(ctx *gin.Context) {
 
 //获取pod中容器日志
 func (p *pod) GetPodLog(ctx *gin.Context) {
+	//mode为空时返回最后config.PodLogTailLine行日志
+	//mode为download时以gzip压缩的附件下载全部日志，mode为search时在服务端搜索全部日志
 	params := new(struct {
+		Cluster       string `form:"cluster"`
 		ContainerName string `form:"container_name"`
 		PodName       string `form:"pod_name"`
 		Namespace     string `form:"namespace"`
+		Mode          string `form:"mode"`
+		Previous      bool   `form:"previous"`
+		Keyword       string `form:"keyword"`
+		Regex         bool   `form:"regex"`
+		IgnoreCase    bool   `form:"ignore_case"`
+		Context       int    `form:"context"`
+		MaxMatches    int    `form:"max_matches"`
 	})
 	//GET请求，绑定参数方法改为ctx.Bind
 	if err := ctx.Bind(params); err != nil {
@@ -189,7 +287,58 @@ func (p *pod) GetPodLog(ctx *gin.Context) {
 		})
 		return
 	}
-	data, err := service.Pod.GetPodLog(params.ContainerName, params.PodName, params.Namespace)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	switch params.Mode {
+	case "":
+	case "download":
+		filename := fmt.Sprintf("%s-%s-%s.log.gz", params.PodName, params.ContainerName, time.Now().Format("20060102150405"))
+		ctx.Header("Content-Type", "application/gzip")
+		ctx.Header("Content-Disposition", "attachment; filename="+filename)
+		//日志边读边写，开始写入后无法再返回json，出错时只能中断下载
+		if err = service.Pod.DownloadPodLog(ctx.Writer, client, params.ContainerName, params.PodName, params.Namespace, params.Previous); err != nil && !ctx.Writer.Written() {
+			ctx.Header("Content-Type", "application/json")
+			ctx.Header("Content-Disposition", "")
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"msg":  err.Error(),
+				"data": nil,
+			})
+		}
+		return
+	case "search":
+		data, err := service.Pod.SearchPodLog(client, params.ContainerName, params.PodName, params.Namespace, params.Previous, &service.PodLogSearch{
+			Keyword:    params.Keyword,
+			Regex:      params.Regex,
+			IgnoreCase: params.IgnoreCase,
+			Context:    params.Context,
+			MaxMatches: params.MaxMatches,
+		})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"msg":  err.Error(),
+				"data": nil,
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"msg":  "搜索Pod中容器日志成功",
+			"data": data,
+		})
+		return
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  "mode只能为download或search",
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.Pod.GetPodLog(client, params.ContainerName, params.PodName, params.Namespace)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -203,9 +352,83 @@ func (p *pod) GetPodLog(ctx *gin.Context) {
 	})
 }
 
+//流式获取pod内容器日志，WebSocket升级请求使用WebSocket推送，其他请求使用Server-Sent Events推送
+func (p *pod) StreamPodLog(ctx *gin.Context) {
+	params := new(service.PodLogQuery)
+	if err := ctx.Bind(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	//连接建立前的参数错误以json返回，建立后的错误通过推送的连接返回
+	if err = service.Pod.StreamPodLog(ctx.Writer, ctx.Request, client, params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+	}
+}
+
+//合并推送deployment、statefulset、daemonset或workflow下所有pod的日志
+func (p *pod) StreamAggregateLog(ctx *gin.Context) {
+	params := new(service.AggregateLogQuery)
+	if err := ctx.Bind(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if err = service.Pod.StreamAggregateLog(ctx.Writer, ctx.Request, client, params); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+	}
+}
+
 //获取每个namespace的pod数量
 func (p *pod) GetPodNumPerNp(ctx *gin.Context) {
-	data, err := service.Pod.GetPodNumPerNp()
+	params := new(struct {
+		Cluster string `form:"cluster"`
+	})
+	if err := ctx.Bind(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.Pod.GetPodNumPerNp(client, allowedNamespaces(ctx))
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -15,9 +15,14 @@ type pv struct{}
 //获取pv列表，支持过滤、排序、分页
 func (p *pv) GetPvs(ctx *gin.Context) {
 	params := new(struct {
-		FilterName string `form:"filter_name"`
-		Page       int    `form:"page"`
-		Limit      int    `form:"limit"`
+		Cluster       string `form:"cluster"`
+		FilterName    string `form:"filter_name"`
+		LabelSelector string `form:"label_selector"`
+		FieldSelector string `form:"field_selector"`
+		SortBy        string `form:"sort_by"`
+		Order         string `form:"order"`
+		Page          int    `form:"page"`
+		Limit         int    `form:"limit"`
 	})
 	if err := ctx.Bind(params); err != nil {
 		logger.Error("Bind请求参数失败, " + err.Error())
@@ -27,8 +32,32 @@ func (p *pv) GetPvs(ctx *gin.Context) {
 		})
 		return
 	}
+	filter, err := service.NewFilterQuery(params.FilterName, params.LabelSelector, params.FieldSelector, service.PvFieldColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	sort, err := service.NewSortQuery(params.SortBy, params.Order, service.PvSortColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	data, err := service.Pv.GetPvs(params.FilterName, params.Limit, params.Page)
+	data, err := service.Pv.GetPvs(client, filter, sort, params.Limit, params.Page)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -46,7 +75,8 @@ func (p *pv) GetPvs(ctx *gin.Context) {
 //获取pv详情
 func (p *pv) GetPvDetail(ctx *gin.Context) {
 	params := new(struct {
-		PvName string `form:"pv_name"`
+		Cluster string `form:"cluster"`
+		PvName  string `form:"pv_name"`
 	})
 	if err := ctx.Bind(params); err != nil {
 		logger.Error("Bind请求参数失败, " + err.Error())
@@ -56,8 +86,16 @@ func (p *pv) GetPvDetail(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	data, err := service.Pv.GetPvDetail(params.PvName)
+	data, err := service.Pv.GetPvDetail(client, params.PvName)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -75,7 +113,8 @@ func (p *pv) GetPvDetail(ctx *gin.Context) {
 //删除pv
 func (p *pv) DeletePv(ctx *gin.Context) {
 	params := new(struct {
-		PvName string `json:"pv_name"`
+		Cluster string `json:"cluster"`
+		PvName  string `json:"pv_name"`
 	})
 	//DELETE请求，绑定参数方法改为ctx.ShouldBindJSON
 	if err := ctx.ShouldBindJSON(params); err != nil {
@@ -86,8 +125,16 @@ func (p *pv) DeletePv(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	err := service.Pv.DeletePv(params.PvName)
+	err = service.Pv.DeletePv(client, params.PvName)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"k8s-platform/model"
+	"k8s-platform/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wonderivan/logger"
+)
+
+var RoleBinding roleBinding
+
+type roleBinding struct{}
+
+//获取角色绑定列表
+func (r *roleBinding) GetBindings(ctx *gin.Context) {
+	params := new(struct {
+		Username string `form:"username"`
+		Page     int    `form:"page"`
+		Limit    int    `form:"limit"`
+	})
+	if err := ctx.Bind(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.RBAC.GetBindings(params.Username, params.Page, params.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "获取角色绑定列表成功",
+		"data": data,
+	})
+}
+
+//创建角色绑定，cluster为空表示所有集群，namespace为空表示集群内所有namespace
+func (r *roleBinding) CreateBinding(ctx *gin.Context) {
+	params := new(struct {
+		Username  string `json:"username"`
+		Role      string `json:"role"`
+		Cluster   string `json:"cluster"`
+		Namespace string `json:"namespace"`
+	})
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	err := service.RBAC.CreateBinding(&model.RoleBinding{
+		Username:  params.Username,
+		Role:      params.Role,
+		Cluster:   params.Cluster,
+		Namespace: params.Namespace,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "创建角色绑定成功",
+		"data": nil,
+	})
+}
+
+//删除角色绑定
+func (r *roleBinding) DeleteBinding(ctx *gin.Context) {
+	params := new(struct {
+		Id int `json:"id"`
+	})
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if err := service.RBAC.DeleteBinding(params.Id); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "删除角色绑定成功",
+		"data": nil,
+	})
+}
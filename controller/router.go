@@ -27,6 +27,41 @@ func (r *router) InitApiRouter(router *gin.Engine) {
 	}).
 		//登录
 		POST("/api/login", Login.Auth).
+		POST("/api/token/refresh", Login.Refresh).
+		GET("/api/oidc/login", Login.OIDCLogin).
+		GET("/api/oidc/callback", Login.OIDCCallback).
+		POST("/api/logout", Login.Logout).
+		//用户管理
+		GET("/api/users", User.GetUsers).
+		POST("/api/user/create", User.CreateUser).
+		PUT("/api/user/disable", User.DisableUser).
+		PUT("/api/user/reset_password", User.ResetPassword).
+		PUT("/api/user/change_password", User.ChangePassword).
+		//角色绑定
+		GET("/api/rolebindings", RoleBinding.GetBindings).
+		POST("/api/rolebinding/create", RoleBinding.CreateBinding).
+		DELETE("/api/rolebinding/del", RoleBinding.DeleteBinding).
+		//审计日志
+		GET("/api/audit", Audit.GetAudits).
+		GET("/api/audit/export", Audit.ExportAudits).
+		//终端录像
+		GET("/api/terminal/records", TerminalRecord.GetRecords).
+		GET("/api/terminal/record/download", TerminalRecord.Download).
+		//终端会话
+		GET("/api/terminal/sessions", Terminal.GetSessions).
+		DELETE("/api/terminal/session/del", Terminal.KillSession).
+		//端口转发
+		GET("/api/portforwards", Terminal.GetPortForwards).
+		DELETE("/api/portforward/del", Terminal.KillPortForward).
+		//集群管理
+		GET("/api/k8s/clusters", Cluster.GetClusters).
+		POST("/api/k8s/cluster/create", Cluster.AddCluster).
+		PUT("/api/k8s/cluster/update", Cluster.UpdateCluster).
+		GET("/api/k8s/cluster/test", Cluster.TestCluster).
+		DELETE("/api/k8s/cluster/del", Cluster.DeleteCluster).
+		GET("/api/k8s/cluster/cache", Cluster.GetCacheStatus).
+		//就绪检查
+		GET("/readyz", Cluster.Ready).
 		//工作流
 		GET("/api/k8s/workflows", Workflow.GetList).
 		GET("/api/k8s/workflow/detail", Workflow.GetById).
@@ -39,7 +74,15 @@ func (r *router) InitApiRouter(router *gin.Engine) {
 		PUT("/api/k8s/pod/update", Pod.UpdatePod).
 		GET("/api/k8s/pod/container", Pod.GetPodContainer).
 		GET("/api/k8s/pod/log", Pod.GetPodLog).
+		GET("/api/k8s/pod/log/stream", Pod.StreamPodLog).
+		GET("/api/k8s/pod/log/aggregate", Pod.StreamAggregateLog).
 		GET("/api/k8s/pod/numnp", Pod.GetPodNumPerNp).
+		GET("/api/k8s/pod/terminal", Terminal.Connect).
+		GET("/api/k8s/pod/debug", Terminal.Debug).
+		GET("/api/k8s/pod/portforward", Terminal.PortForward).
+		POST("/api/k8s/pod/exec", Terminal.Exec).
+		GET("/api/k8s/pod/file/download", Terminal.DownloadFile).
+		POST("/api/k8s/pod/file/upload", Terminal.UploadFile).
 		//deployment操作
 		GET("/api/k8s/deployments", Deployment.GetDeployments).
 		GET("/api/k8s/deployment/detail", Deployment.GetDeploymentDetail).
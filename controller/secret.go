@@ -15,10 +15,16 @@ type secret struct{}
 //获取secret列表，支持过滤、排序、分页
 func (s *secret) GetSecrets(ctx *gin.Context) {
 	params := new(struct {
-		FilterName string `form:"filter_name"`
-		Namespace  string `form:"namespace"`
-		Page       int    `form:"page"`
-		Limit      int    `form:"limit"`
+		Cluster       string `form:"cluster"`
+		FilterName    string `form:"filter_name"`
+		LabelSelector string `form:"label_selector"`
+		FieldSelector string `form:"field_selector"`
+		SortBy        string `form:"sort_by"`
+		Order         string `form:"order"`
+		Namespace     string `form:"namespace"`
+		AllNamespaces bool   `form:"all_namespaces"`
+		Page          int    `form:"page"`
+		Limit         int    `form:"limit"`
 	})
 	if err := ctx.Bind(params); err != nil {
 		logger.Error("Bind请求参数失败, " + err.Error())
@@ -28,8 +34,41 @@ func (s *secret) GetSecrets(ctx *gin.Context) {
 		})
 		return
 	}
+	filter, err := service.NewFilterQuery(params.FilterName, params.LabelSelector, params.FieldSelector, service.SecretFieldColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	sort, err := service.NewSortQuery(params.SortBy, params.Order, service.SecretSortColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if err = checkListNamespace(params.Namespace, params.AllNamespaces); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	//跨namespace查询时只返回有权限的namespace中的资源
+	filter.Namespaces = allowedNamespaces(ctx)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	data, err := service.Secret.GetSecrets(params.FilterName, params.Namespace, params.Limit, params.Page)
+	data, err := service.Secret.GetSecrets(client, filter, sort, params.Namespace, params.Limit, params.Page)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -47,6 +86,7 @@ func (s *secret) GetSecrets(ctx *gin.Context) {
 //获取secret详情
 func (s *secret) GetSecretDetail(ctx *gin.Context) {
 	params := new(struct {
+		Cluster    string `form:"cluster"`
 		SecretName string `form:"secret_name"`
 		Namespace  string `form:"namespace"`
 	})
@@ -58,8 +98,16 @@ func (s *secret) GetSecretDetail(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	data, err := service.Secret.GetSecretDetail(params.SecretName, params.Namespace)
+	data, err := service.Secret.GetSecretDetail(client, params.SecretName, params.Namespace)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -77,6 +125,7 @@ func (s *secret) GetSecretDetail(ctx *gin.Context) {
 //删除secret
 func (s *secret) DeleteSecret(ctx *gin.Context) {
 	params := new(struct {
+		Cluster    string `json:"cluster"`
 		SecretName string `json:"secret_name"`
 		Namespace  string `json:"namespace"`
 	})
@@ -89,8 +138,16 @@ func (s *secret) DeleteSecret(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	err := service.Secret.DeleteSecret(params.SecretName, params.Namespace)
+	err = service.Secret.DeleteSecret(client, params.SecretName, params.Namespace)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -107,6 +164,7 @@ func (s *secret) DeleteSecret(ctx *gin.Context) {
 //更新secret
 func (s *secret) UpdateSecret(ctx *gin.Context) {
 	params := new(struct {
+		Cluster   string `json:"cluster"`
 		Namespace string `json:"namespace"`
 		Content   string `json:"content"`
 	})
@@ -119,8 +177,16 @@ func (s *secret) UpdateSecret(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	err := service.Secret.UpdateSecret(params.Namespace, params.Content)
+	err = service.Secret.UpdateSecret(client, params.Namespace, params.Content)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
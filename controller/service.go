@@ -15,10 +15,16 @@ type servicev1 struct{}
 //获取service列表，支持过滤、排序、分页
 func (s *servicev1) GetServices(ctx *gin.Context) {
 	params := new(struct {
-		FilterName string `form:"filter_name"`
-		Namespace  string `form:"namespace"`
-		Page       int    `form:"page"`
-		Limit      int    `form:"limit"`
+		Cluster       string `form:"cluster"`
+		FilterName    string `form:"filter_name"`
+		LabelSelector string `form:"label_selector"`
+		FieldSelector string `form:"field_selector"`
+		SortBy        string `form:"sort_by"`
+		Order         string `form:"order"`
+		Namespace     string `form:"namespace"`
+		AllNamespaces bool   `form:"all_namespaces"`
+		Page          int    `form:"page"`
+		Limit         int    `form:"limit"`
 	})
 	if err := ctx.Bind(params); err != nil {
 		logger.Error("Bind请求参数失败, " + err.Error())
@@ -28,8 +34,41 @@ func (s *servicev1) GetServices(ctx *gin.Context) {
 		})
 		return
 	}
+	filter, err := service.NewFilterQuery(params.FilterName, params.LabelSelector, params.FieldSelector, service.ServiceFieldColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	sort, err := service.NewSortQuery(params.SortBy, params.Order, service.ServiceSortColumns)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if err = checkListNamespace(params.Namespace, params.AllNamespaces); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	//跨namespace查询时只返回有权限的namespace中的资源
+	filter.Namespaces = allowedNamespaces(ctx)
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	data, err := service.Service.GetServices(params.FilterName, params.Namespace, params.Limit, params.Page)
+	data, err := service.Service.GetServices(client, filter, sort, params.Namespace, params.Limit, params.Page)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -47,6 +86,7 @@ func (s *servicev1) GetServices(ctx *gin.Context) {
 //获取service详情
 func (s *servicev1) GetServiceDetail(ctx *gin.Context) {
 	params := new(struct {
+		Cluster     string `form:"cluster"`
 		ServiceName string `form:"service_name"`
 		Namespace   string `form:"namespace"`
 	})
@@ -58,8 +98,16 @@ func (s *servicev1) GetServiceDetail(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	data, err := service.Service.GetServiceDetail(params.ServiceName, params.Namespace)
+	data, err := service.Service.GetServiceDetail(client, params.ServiceName, params.Namespace)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -89,8 +137,16 @@ func (s *servicev1) CreateService(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(serviceCreate.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	if err = service.Service.CreateService(serviceCreate); err != nil {
+	if err = service.Service.CreateService(client, serviceCreate); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
 			"data": nil,
@@ -106,6 +162,7 @@ func (s *servicev1) CreateService(ctx *gin.Context) {
 //删除service
 func (s *servicev1) DeleteService(ctx *gin.Context) {
 	params := new(struct {
+		Cluster     string `json:"cluster"`
 		ServiceName string `json:"service_name"`
 		Namespace   string `json:"namespace"`
 	})
@@ -118,8 +175,16 @@ func (s *servicev1) DeleteService(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	err := service.Service.DeleteService(params.ServiceName, params.Namespace)
+	err = service.Service.DeleteService(client, params.ServiceName, params.Namespace)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -136,6 +201,7 @@ func (s *servicev1) DeleteService(ctx *gin.Context) {
 //更新service
 func (s *servicev1) UpdateService(ctx *gin.Context) {
 	params := new(struct {
+		Cluster   string `json:"cluster"`
 		Namespace string `json:"namespace"`
 		Content   string `json:"content"`
 	})
@@ -148,8 +214,16 @@ func (s *servicev1) UpdateService(ctx *gin.Context) {
 		})
 		return
 	}
+	client, err := service.K8s.GetClient(params.Cluster)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
 
-	err := service.Service.UpdateService(params.Namespace, params.Content)
+	err = service.Service.UpdateService(client, params.Namespace, params.Content)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"msg":  err.Error(),
@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"errors"
+	"k8s-platform/service"
+	"k8s-platform/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wonderivan/logger"
+)
+
+var Terminal terminal
+
+type terminal struct{}
+
+//连接pod中容器的终端，http协议升级为websocket，token和鉴权由JWTAuth和RBAC中间件处理
+func (t *terminal) Connect(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*utils.CustomClaims)
+	t.upgradeError(ctx, service.Terminal.WsHandler(ctx.Writer, ctx.Request, claims.Username, ctx.ClientIP()))
+}
+
+//在pod中添加临时调试容器并连接其终端，用于没有shell的容器
+func (t *terminal) Debug(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*utils.CustomClaims)
+	t.upgradeError(ctx, service.Terminal.DebugHandler(ctx.Writer, ctx.Request, claims.Username, ctx.ClientIP()))
+}
+
+//返回升级为websocket之前的错误，超过终端数量上限时返回429
+func (t *terminal) upgradeError(ctx *gin.Context, err error) {
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrTerminalSessionLimit) {
+			status = http.StatusTooManyRequests
+		}
+		ctx.JSON(status, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+	}
+}
+
+//在pod的容器中执行一次命令，返回输出和退出码
+func (t *terminal) Exec(ctx *gin.Context) {
+	params := new(service.ExecCreate)
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.Terminal.Exec(params)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "执行命令成功",
+		"data": data,
+	})
+}
+
+//获取打开中的终端会话列表
+func (t *terminal) GetSessions(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "获取终端会话列表成功",
+		"data": service.TerminalSessions.List(),
+	})
+}
+
+//强制终止终端会话
+func (t *terminal) KillSession(ctx *gin.Context) {
+	params := new(struct {
+		ID string `json:"id"`
+	})
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	claims := ctx.MustGet("claims").(*utils.CustomClaims)
+	if err := service.TerminalSessions.Kill(params.ID, claims.Username); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "终止终端会话成功",
+		"data": nil,
+	})
+}
+
+//从容器中下载文件或目录，打包为tar或zip
+func (t *terminal) DownloadFile(ctx *gin.Context) {
+	query := new(service.PodFileQuery)
+	if err := ctx.Bind(query); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	claims := ctx.MustGet("claims").(*utils.CustomClaims)
+	err := service.Terminal.DownloadFile(ctx.Writer, query, claims.Username, ctx.ClientIP())
+	//开始下载后的错误已经无法返回json
+	if err != nil && !ctx.Writer.Written() {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrPodFileTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		ctx.JSON(status, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+	}
+}
+
+//上传文件到容器的目录中，参数通过query传递，文件通过multipart表单的file字段传递
+func (t *terminal) UploadFile(ctx *gin.Context) {
+	query := new(service.PodFileQuery)
+	if err := ctx.BindQuery(query); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	//限制请求body的大小，multipart表单超过内存上限的部分由gin写入临时文件
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, service.PodFileMaxBytes()+1<<20)
+	file, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  "获取上传文件失败，" + err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  "打开上传文件失败，" + err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	defer src.Close()
+	if err = service.Terminal.UploadFile(query, file.Filename, file.Size, src); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrPodFileTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		ctx.JSON(status, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "上传文件成功",
+		"data": nil,
+	})
+}
+
+//通过WebSocket转发到pod或service的端口
+func (t *terminal) PortForward(ctx *gin.Context) {
+	query := new(service.PortForwardQuery)
+	if err := ctx.Bind(query); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	claims := ctx.MustGet("claims").(*utils.CustomClaims)
+	err := service.PortForward.Handler(ctx.Writer, ctx.Request, query, claims.Username, ctx.ClientIP())
+	if errors.Is(err, service.ErrPortForwardLimit) {
+		ctx.JSON(http.StatusTooManyRequests, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	t.upgradeError(ctx, err)
+}
+
+//获取进行中的端口转发列表
+func (t *terminal) GetPortForwards(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "获取端口转发列表成功",
+		"data": service.PortForward.List(),
+	})
+}
+
+//强制终止端口转发
+func (t *terminal) KillPortForward(ctx *gin.Context) {
+	params := new(struct {
+		ID string `json:"id"`
+	})
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	claims := ctx.MustGet("claims").(*utils.CustomClaims)
+	if err := service.PortForward.Kill(params.ID, claims.Username); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "终止端口转发成功",
+		"data": nil,
+	})
+}
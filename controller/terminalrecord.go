@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"k8s-platform/dao"
+	"k8s-platform/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wonderivan/logger"
+)
+
+var TerminalRecord terminalRecord
+
+type terminalRecord struct{}
+
+//获取终端录像列表，支持按用户、pod、容器和时间过滤、分页
+func (t *terminalRecord) GetRecords(ctx *gin.Context) {
+	params := new(struct {
+		dao.TerminalRecordFilter
+		Page  int `form:"page"`
+		Limit int `form:"limit"`
+	})
+	if err := ctx.Bind(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.TerminalRecord.GetRecords(&params.TerminalRecordFilter, params.Page, params.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "获取终端录像列表成功",
+		"data": data,
+	})
+}
+
+//下载asciicast格式的终端录像，可以直接交给asciinema-player在浏览器中回放
+func (t *terminalRecord) Download(ctx *gin.Context) {
+	params := new(struct {
+		ID int `form:"id"`
+	})
+	if err := ctx.Bind(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	record, file, err := service.TerminalRecord.Open(params.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	defer file.Close()
+	ctx.Header("Content-Type", "application/x-asciicast")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=terminal-%d.cast", record.ID))
+	//写出过程中出错时响应头已经写出，只能记录错误日志
+	if _, err = io.Copy(ctx.Writer, file); err != nil {
+		logger.Error("下载终端录像失败，" + err.Error())
+	}
+}
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"k8s-platform/service"
+	"k8s-platform/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wonderivan/logger"
+)
+
+var User user
+
+type user struct{}
+
+//获取用户列表，支持过滤、分页
+func (u *user) GetUsers(ctx *gin.Context) {
+	params := new(struct {
+		FilterName string `form:"filter_name"`
+		Page       int    `form:"page"`
+		Limit      int    `form:"limit"`
+	})
+	if err := ctx.Bind(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	data, err := service.User.GetUsers(params.FilterName, params.Page, params.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "获取用户列表成功",
+		"data": data,
+	})
+}
+
+//创建用户
+func (u *user) CreateUser(ctx *gin.Context) {
+	params := new(struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	})
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if err := service.User.CreateUser(params.Username, params.Password); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "创建用户成功",
+		"data": nil,
+	})
+}
+
+//启用或禁用用户
+func (u *user) DisableUser(ctx *gin.Context) {
+	params := new(struct {
+		Username string `json:"username"`
+		Disabled bool   `json:"disabled"`
+	})
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if err := service.User.SetDisabled(params.Username, params.Disabled); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "更新用户状态成功",
+		"data": nil,
+	})
+}
+
+//重置用户密码
+func (u *user) ResetPassword(ctx *gin.Context) {
+	params := new(struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	})
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	if err := service.User.ResetPassword(params.Username, params.Password); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "重置密码成功",
+		"data": nil,
+	})
+}
+
+//修改当前登录用户的密码，用户名从token中获取
+func (u *user) ChangePassword(ctx *gin.Context) {
+	params := new(struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	})
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		logger.Error("Bind请求参数失败，" + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	claims := ctx.MustGet("claims").(*utils.CustomClaims)
+	if err := service.User.ChangePassword(claims.Username, params.OldPassword, params.NewPassword); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"msg":  "修改密码成功，请重新登录",
+		"data": nil,
+	})
+}
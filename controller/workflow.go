@@ -19,9 +19,11 @@ var Workflow workflow
 //获取列表分页查询
 func (w *workflow) GetList(ctx *gin.Context) {
 	params := new(struct {
-		Namespace string `form:"namespace"`
-		Page      int    `form:"page"`
-		Limit     int    `form:"limit"`
+		Cluster       string `form:"cluster"`
+		Namespace     string `form:"namespace"`
+		AllNamespaces bool   `form:"all_namespaces"`
+		Page          int    `form:"page"`
+		Limit         int    `form:"limit"`
 	})
 	if err := ctx.Bind(params); err != nil {
 		logger.Error("Bind请求参数失败，" + err.Error())
@@ -31,7 +33,15 @@ func (w *workflow) GetList(ctx *gin.Context) {
 		})
 		return
 	}
-	data, err := service.Workflow.GetList(params.Namespace, params.Page, params.Limit)
+	if err := checkListNamespace(params.Namespace, params.AllNamespaces); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"msg":  err.Error(),
+			"data": nil,
+		})
+		return
+	}
+	//跨namespace查询时只返回有权限的namespace中的workflow
+	data, err := service.Workflow.GetList(params.Cluster, params.Namespace, allowedNamespaces(ctx), params.Page, params.Limit)
 	if err != nil {
 		logger.Error("获取Workflow列表失败，" + err.Error())
 		ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -0,0 +1,110 @@
+package dao
+
+import (
+	"errors"
+	"k8s-platform/db"
+	"k8s-platform/model"
+	"time"
+
+	"github.com/wonderivan/logger"
+	"gorm.io/gorm"
+)
+
+type audit struct{}
+
+var Audit audit
+
+//定义列表的返回内容，Items是audit元素列表，Total为符合条件的audit总数
+type AuditResp struct {
+	Items []*model.Audit `json:"items"`
+	Total int64          `json:"total"`
+}
+
+//AuditFilter定义审计日志的查询条件，空值表示不过滤
+type AuditFilter struct {
+	Username  string    `form:"username"`
+	Cluster   string    `form:"cluster"`
+	Namespace string    `form:"namespace"`
+	Resource  string    `form:"resource"`
+	Name      string    `form:"name"`
+	Verb      string    `form:"verb"`
+	Result    string    `form:"result"`
+	StartTime time.Time `form:"start_time" time_format:"2006-01-02 15:04:05"`
+	EndTime   time.Time `form:"end_time" time_format:"2006-01-02 15:04:05"`
+}
+
+//新增审计日志
+func (a *audit) Add(audit *model.Audit) (err error) {
+	tx := db.GORM.Create(audit)
+	if tx.Error != nil {
+		logger.Error("添加Audit失败，" + tx.Error.Error())
+		return errors.New("添加Audit失败，" + tx.Error.Error())
+	}
+	return nil
+}
+
+//获取审计日志列表，支持过滤、分页，按时间倒序
+func (a *audit) GetList(filter *AuditFilter, page, limit int) (data *AuditResp, err error) {
+	var (
+		auditList []*model.Audit
+		total     int64
+	)
+	tx := a.where(filter)
+	if err = tx.Count(&total).Error; err != nil {
+		logger.Error("获取Audit列表失败，" + err.Error())
+		return nil, errors.New("获取Audit列表失败，" + err.Error())
+	}
+	if limit > 0 && page > 0 {
+		tx = tx.Limit(limit).Offset((page - 1) * limit)
+	}
+	if err = tx.Order("id desc").Find(&auditList).Error; err != nil {
+		logger.Error("获取Audit列表失败，" + err.Error())
+		return nil, errors.New("获取Audit列表失败，" + err.Error())
+	}
+	return &AuditResp{
+		Items: auditList,
+		Total: total,
+	}, nil
+}
+
+//按条件分批遍历审计日志，用于导出，避免一次性加载到内存，按时间正序
+func (a *audit) Each(filter *AuditFilter, fn func(audit *model.Audit) error) (err error) {
+	var batch []*model.Audit
+	tx := a.where(filter).FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, item := range batch {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if tx.Error != nil {
+		logger.Error("导出Audit失败，" + tx.Error.Error())
+		return errors.New("导出Audit失败，" + tx.Error.Error())
+	}
+	return nil
+}
+
+func (a *audit) where(filter *AuditFilter) *gorm.DB {
+	tx := db.GORM.Model(&model.Audit{})
+	for column, value := range map[string]string{
+		"username":  filter.Username,
+		"cluster":   filter.Cluster,
+		"namespace": filter.Namespace,
+		"resource":  filter.Resource,
+		"name":      filter.Name,
+		"verb":      filter.Verb,
+		"result":    filter.Result,
+	} {
+		if value != "" {
+			tx = tx.Where(column+" = ?", value)
+		}
+	}
+	if !filter.StartTime.IsZero() {
+		tx = tx.Where("created_at >= ?", filter.StartTime)
+	}
+	if !filter.EndTime.IsZero() {
+		tx = tx.Where("created_at <= ?", filter.EndTime)
+	}
+	return tx
+}
@@ -0,0 +1,72 @@
+package dao
+
+import (
+	"errors"
+	"k8s-platform/db"
+	"k8s-platform/model"
+
+	"github.com/wonderivan/logger"
+)
+
+type cluster struct{}
+
+var Cluster cluster
+
+//获取所有集群
+func (c *cluster) GetAll() (clusters []*model.Cluster, err error) {
+	tx := db.GORM.Order("id asc").Find(&clusters)
+	if tx.Error != nil && tx.Error.Error() != "record not found" {
+		logger.Error("获取Cluster列表失败，" + tx.Error.Error())
+		return nil, errors.New("获取Cluster列表失败，" + tx.Error.Error())
+	}
+	return clusters, nil
+}
+
+//根据集群名获取单条数据，不存在时返回nil
+func (c *cluster) GetByName(name string) (cluster *model.Cluster, err error) {
+	var clusters []*model.Cluster
+	tx := db.GORM.Where("name = ?", name).Limit(1).Find(&clusters)
+	if tx.Error != nil {
+		logger.Error("获取Cluster单条数据失败，" + tx.Error.Error())
+		return nil, errors.New("获取Cluster单条数据失败，" + tx.Error.Error())
+	}
+	if len(clusters) == 0 {
+		return nil, nil
+	}
+	return clusters[0], nil
+}
+
+//新增集群
+func (c *cluster) Add(cluster *model.Cluster) (err error) {
+	tx := db.GORM.Create(cluster)
+	if tx.Error != nil {
+		logger.Error("添加Cluster失败，" + tx.Error.Error())
+		return errors.New("添加Cluster失败，" + tx.Error.Error())
+	}
+	return nil
+}
+
+//更新集群的地址和kubeconfig
+func (c *cluster) Update(cluster *model.Cluster) (err error) {
+	tx := db.GORM.Model(&model.Cluster{}).
+		Where("name = ?", cluster.Name).
+		Updates(map[string]interface{}{
+			"host":       cluster.Host,
+			"kubeconfig": cluster.Kubeconfig,
+		})
+	if tx.Error != nil {
+		logger.Error("更新Cluster失败，" + tx.Error.Error())
+		return errors.New("更新Cluster失败，" + tx.Error.Error())
+	}
+	return nil
+}
+
+//根据集群名删除集群
+func (c *cluster) DelByName(name string) (err error) {
+	tx := db.GORM.Where("name = ?", name).Delete(&model.Cluster{})
+	if tx.Error != nil {
+		logger.Error("删除Cluster失败，" + tx.Error.Error())
+		return errors.New("删除Cluster失败，" + tx.Error.Error())
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package dao
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+//唯一索引冲突，service层据此判断数据已存在，而不是先查询再写入
+var ErrDuplicate = errors.New("数据已存在")
+
+//判断是否为唯一索引冲突，mysql为1062错误，测试使用的sqlite为UNIQUE constraint failed
+func isDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
@@ -0,0 +1,98 @@
+package dao
+
+import (
+	"errors"
+	"k8s-platform/db"
+	"k8s-platform/model"
+
+	"github.com/wonderivan/logger"
+)
+
+type roleBinding struct{}
+
+var RoleBinding roleBinding
+
+//定义列表的返回内容，Items是roleBinding元素列表，Total为roleBinding元素数量
+type RoleBindingResp struct {
+	Items []*model.RoleBinding `json:"items"`
+	Total int64                `json:"total"`
+}
+
+//获取角色绑定列表，支持按用户名查询和分页
+func (r *roleBinding) GetList(username string, page, limit int) (data *RoleBindingResp, err error) {
+	var (
+		bindingList []*model.RoleBinding
+		total       int64
+	)
+	tx := db.GORM.Model(&model.RoleBinding{})
+	if username != "" {
+		tx = tx.Where("username = ?", username)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		logger.Error("获取RoleBinding列表失败，" + err.Error())
+		return nil, errors.New("获取RoleBinding列表失败，" + err.Error())
+	}
+	if limit > 0 && page > 0 {
+		tx = tx.Limit(limit).Offset((page - 1) * limit)
+	}
+	if err = tx.Order("id asc").Find(&bindingList).Error; err != nil {
+		logger.Error("获取RoleBinding列表失败，" + err.Error())
+		return nil, errors.New("获取RoleBinding列表失败，" + err.Error())
+	}
+	return &RoleBindingResp{
+		Items: bindingList,
+		Total: total,
+	}, nil
+}
+
+//获取用户的所有角色绑定
+func (r *roleBinding) GetByUsername(username string) (bindings []*model.RoleBinding, err error) {
+	tx := db.GORM.Where("username = ?", username).Find(&bindings)
+	if tx.Error != nil {
+		logger.Error("获取用户RoleBinding失败，" + tx.Error.Error())
+		return nil, errors.New("获取用户RoleBinding失败，" + tx.Error.Error())
+	}
+	return bindings, nil
+}
+
+//新增角色绑定
+func (r *roleBinding) Add(binding *model.RoleBinding) (err error) {
+	tx := db.GORM.Create(binding)
+	if tx.Error != nil {
+		logger.Error("添加RoleBinding失败，" + tx.Error.Error())
+		return errors.New("添加RoleBinding失败，" + tx.Error.Error())
+	}
+	return nil
+}
+
+//删除角色绑定
+func (r *roleBinding) DelById(id int) (err error) {
+	tx := db.GORM.Where("id = ?", id).Delete(&model.RoleBinding{})
+	if tx.Error != nil {
+		logger.Error("删除RoleBinding失败，" + tx.Error.Error())
+		return errors.New("删除RoleBinding失败，" + tx.Error.Error())
+	}
+	return nil
+}
+
+//替换用户某个来源的所有角色绑定，用于外部身份源登录时同步用户组对应的角色
+func (r *roleBinding) ReplaceBySource(username, source string, bindings []*model.RoleBinding) (err error) {
+	tx := db.GORM.Begin()
+	if err = tx.Where("username = ? and source = ?", username, source).Delete(&model.RoleBinding{}).Error; err != nil {
+		tx.Rollback()
+		logger.Error("同步RoleBinding失败，" + err.Error())
+		return errors.New("同步RoleBinding失败，" + err.Error())
+	}
+	if len(bindings) > 0 {
+		if err = tx.Create(bindings).Error; err != nil {
+			tx.Rollback()
+			logger.Error("同步RoleBinding失败，" + err.Error())
+			return errors.New("同步RoleBinding失败，" + err.Error())
+		}
+	}
+	if err = tx.Commit().Error; err != nil {
+		logger.Error("同步RoleBinding失败，" + err.Error())
+		return errors.New("同步RoleBinding失败，" + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package dao
+
+import (
+	"errors"
+	"k8s-platform/db"
+	"k8s-platform/model"
+	"time"
+
+	"github.com/wonderivan/logger"
+	"gorm.io/gorm"
+)
+
+type terminalRecord struct{}
+
+var TerminalRecord terminalRecord
+
+//定义列表的返回内容，Items是录像元素列表，Total为符合条件的录像总数
+type TerminalRecordResp struct {
+	Items []*model.TerminalRecord `json:"items"`
+	Total int64                   `json:"total"`
+}
+
+//TerminalRecordFilter定义终端录像的查询条件，空值表示不过滤
+type TerminalRecordFilter struct {
+	Username  string    `form:"username"`
+	Cluster   string    `form:"cluster"`
+	Namespace string    `form:"namespace"`
+	Pod       string    `form:"pod"`
+	Container string    `form:"container"`
+	StartTime time.Time `form:"start_time" time_format:"2006-01-02 15:04:05"`
+	EndTime   time.Time `form:"end_time" time_format:"2006-01-02 15:04:05"`
+}
+
+//新增终端录像
+func (t *terminalRecord) Add(record *model.TerminalRecord) (err error) {
+	tx := db.GORM.Create(record)
+	if tx.Error != nil {
+		logger.Error("添加TerminalRecord失败，" + tx.Error.Error())
+		return errors.New("添加TerminalRecord失败，" + tx.Error.Error())
+	}
+	return nil
+}
+
+//会话结束时更新时长和文件大小
+func (t *terminalRecord) Finish(id uint, duration, size int64) (err error) {
+	tx := db.GORM.Model(&model.TerminalRecord{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"duration": duration, "size": size})
+	if tx.Error != nil {
+		logger.Error("更新TerminalRecord失败，" + tx.Error.Error())
+		return errors.New("更新TerminalRecord失败，" + tx.Error.Error())
+	}
+	return nil
+}
+
+//获取终端录像列表，支持过滤、分页，按时间倒序
+func (t *terminalRecord) GetList(filter *TerminalRecordFilter, page, limit int) (data *TerminalRecordResp, err error) {
+	var (
+		recordList []*model.TerminalRecord
+		total      int64
+	)
+	tx := t.where(filter)
+	if err = tx.Count(&total).Error; err != nil {
+		logger.Error("获取TerminalRecord列表失败，" + err.Error())
+		return nil, errors.New("获取TerminalRecord列表失败，" + err.Error())
+	}
+	if limit > 0 && page > 0 {
+		tx = tx.Limit(limit).Offset((page - 1) * limit)
+	}
+	if err = tx.Order("id desc").Find(&recordList).Error; err != nil {
+		logger.Error("获取TerminalRecord列表失败，" + err.Error())
+		return nil, errors.New("获取TerminalRecord列表失败，" + err.Error())
+	}
+	return &TerminalRecordResp{
+		Items: recordList,
+		Total: total,
+	}, nil
+}
+
+//获取单条终端录像，不存在时返回nil
+func (t *terminalRecord) GetById(id int) (record *model.TerminalRecord, err error) {
+	var records []*model.TerminalRecord
+	tx := db.GORM.Where("id = ?", id).Limit(1).Find(&records)
+	if tx.Error != nil {
+		logger.Error("获取TerminalRecord单条数据失败，" + tx.Error.Error())
+		return nil, errors.New("获取TerminalRecord单条数据失败，" + tx.Error.Error())
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0], nil
+}
+
+func (t *terminalRecord) where(filter *TerminalRecordFilter) *gorm.DB {
+	tx := db.GORM.Model(&model.TerminalRecord{})
+	for column, value := range map[string]string{
+		"username":  filter.Username,
+		"cluster":   filter.Cluster,
+		"namespace": filter.Namespace,
+		"pod":       filter.Pod,
+		"container": filter.Container,
+	} {
+		if value != "" {
+			tx = tx.Where(column+" = ?", value)
+		}
+	}
+	if !filter.StartTime.IsZero() {
+		tx = tx.Where("created_at >= ?", filter.StartTime)
+	}
+	if !filter.EndTime.IsZero() {
+		tx = tx.Where("created_at <= ?", filter.EndTime)
+	}
+	return tx
+}
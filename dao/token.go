@@ -0,0 +1,42 @@
+package dao
+
+import (
+	"errors"
+	"k8s-platform/db"
+	"k8s-platform/model"
+	"time"
+
+	"github.com/wonderivan/logger"
+)
+
+type tokenBlacklist struct{}
+
+var TokenBlacklist tokenBlacklist
+
+//将token加入黑名单，同时清理已过期的记录
+func (t *tokenBlacklist) Add(token *model.TokenBlacklist) (err error) {
+	tx := db.GORM.Create(token)
+	if tx.Error != nil && isDuplicate(tx.Error) {
+		return ErrDuplicate
+	}
+	if tx.Error != nil {
+		logger.Error("添加Token黑名单失败，" + tx.Error.Error())
+		return errors.New("添加Token黑名单失败，" + tx.Error.Error())
+	}
+	tx = db.GORM.Where("expires_at < ?", time.Now()).Delete(&model.TokenBlacklist{})
+	if tx.Error != nil {
+		logger.Error("清理Token黑名单失败，" + tx.Error.Error())
+	}
+	return nil
+}
+
+//判断token是否在黑名单中
+func (t *tokenBlacklist) Exists(jti string) (exists bool, err error) {
+	var count int64
+	tx := db.GORM.Model(&model.TokenBlacklist{}).Where("jti = ?", jti).Count(&count)
+	if tx.Error != nil {
+		logger.Error("查询Token黑名单失败，" + tx.Error.Error())
+		return false, errors.New("查询Token黑名单失败，" + tx.Error.Error())
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,114 @@
+package dao
+
+import (
+	"errors"
+	"k8s-platform/db"
+	"k8s-platform/model"
+
+	"github.com/wonderivan/logger"
+	"gorm.io/gorm"
+)
+
+type user struct{}
+
+var User user
+
+//定义列表的返回内容，Items是user元素列表，Total为user元素数量
+type UserResp struct {
+	Items []*model.User `json:"items"`
+	Total int64         `json:"total"`
+}
+
+//获取用户列表，支持按用户名模糊查询和分页
+func (u *user) GetList(filterName string, page, limit int) (data *UserResp, err error) {
+	var (
+		userList []*model.User
+		total    int64
+	)
+	tx := db.GORM.Model(&model.User{})
+	if filterName != "" {
+		tx = tx.Where("username like ?", "%"+filterName+"%")
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		logger.Error("获取User列表失败，" + err.Error())
+		return nil, errors.New("获取User列表失败，" + err.Error())
+	}
+	if limit > 0 && page > 0 {
+		tx = tx.Limit(limit).Offset((page - 1) * limit)
+	}
+	if err = tx.Order("id asc").Find(&userList).Error; err != nil {
+		logger.Error("获取User列表失败，" + err.Error())
+		return nil, errors.New("获取User列表失败，" + err.Error())
+	}
+	return &UserResp{
+		Items: userList,
+		Total: total,
+	}, nil
+}
+
+//根据用户名获取单条数据，不存在时返回nil
+func (u *user) GetByUsername(username string) (user *model.User, err error) {
+	var users []*model.User
+	tx := db.GORM.Where("username = ?", username).Limit(1).Find(&users)
+	if tx.Error != nil {
+		logger.Error("获取User单条数据失败，" + tx.Error.Error())
+		return nil, errors.New("获取User单条数据失败，" + tx.Error.Error())
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+	return users[0], nil
+}
+
+//获取用户总数
+func (u *user) Count() (count int64, err error) {
+	tx := db.GORM.Model(&model.User{}).Count(&count)
+	if tx.Error != nil {
+		logger.Error("获取User数量失败，" + tx.Error.Error())
+		return 0, errors.New("获取User数量失败，" + tx.Error.Error())
+	}
+	return count, nil
+}
+
+//新增用户
+func (u *user) Add(user *model.User) (err error) {
+	tx := db.GORM.Create(user)
+	if tx.Error != nil && isDuplicate(tx.Error) {
+		return ErrDuplicate
+	}
+	if tx.Error != nil {
+		logger.Error("添加User失败，" + tx.Error.Error())
+		return errors.New("添加User失败，" + tx.Error.Error())
+	}
+	return nil
+}
+
+//更新用户的密码哈希，同时token版本加1，使之前签发的token失效
+func (u *user) UpdatePassword(username, password string) (err error) {
+	tx := db.GORM.Model(&model.User{}).
+		Where("username = ?", username).
+		Updates(map[string]interface{}{
+			"password":      password,
+			"token_version": gorm.Expr("token_version + 1"),
+		})
+	if tx.Error != nil {
+		logger.Error("更新User密码失败，" + tx.Error.Error())
+		return errors.New("更新User密码失败，" + tx.Error.Error())
+	}
+	return nil
+}
+
+//启用或禁用用户，同时token版本加1，使之前签发的token失效
+func (u *user) UpdateDisabled(username string, disabled bool) (err error) {
+	tx := db.GORM.Model(&model.User{}).
+		Where("username = ?", username).
+		Updates(map[string]interface{}{
+			"disabled":      disabled,
+			"token_version": gorm.Expr("token_version + 1"),
+		})
+	if tx.Error != nil {
+		logger.Error("更新User状态失败，" + tx.Error.Error())
+		return errors.New("更新User状态失败，" + tx.Error.Error())
+	}
+	return nil
+}
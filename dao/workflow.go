@@ -6,6 +6,7 @@ import (
 	"k8s-platform/model"
 
 	"github.com/wonderivan/logger"
+	"gorm.io/gorm"
 )
 
 /**
@@ -16,21 +17,54 @@ type workflow struct{}
 
 var Workflow workflow
 
-//定义列表的返回内容，Items是workflow元素列表，Total为workflow元素数量
+//定义列表的返回内容，Items是workflow元素列表，Total为满足条件的workflow总数，Facets为每个namespace的workflow数量
 type WorkflowResp struct {
-	Items []*model.Workflow `json:"items"`
-	Total int               `json:"total"`
+	Items  []*model.Workflow `json:"items"`
+	Total  int               `json:"total"`
+	Facets []*WorkflowFacet  `json:"facets"`
+}
+
+//WorkflowFacet为单个namespace的workflow数量
+type WorkflowFacet struct {
+	Namespace string `json:"namespace"`
+	Total     int    `json:"total"`
 }
 
 //获取列表分页查询
-func (w *workflow) GetList(namespace string, page, limit int) (data *WorkflowResp, err error) {
+//namespace为空时查询集群内所有namespace，namespaces不为nil时只查询其中的namespace
+func (w *workflow) GetList(cluster, namespace string, namespaces []string, page, limit int) (data *WorkflowResp, err error) {
 	//定义分页数据的起始位置
 	startSet := (page - 1) * limit
+	//列表、总数和facets使用相同的查询条件
+	scope := func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Model(&model.Workflow{}).Where("cluster = ?", cluster)
+		if namespace != "" {
+			return tx.Where("namespace = ?", namespace)
+		}
+		if namespaces != nil {
+			return tx.Where("namespace IN ?", namespaces)
+		}
+		return tx
+	}
+	//按namespace分组统计数量，各namespace数量之和即为总数
+	facets := []*WorkflowFacet{}
+	tx := db.GORM.Scopes(scope).
+		Select("namespace, count(*) as total").
+		Group("namespace").
+		Order("namespace").
+		Scan(&facets)
+	if tx.Error != nil {
+		logger.Error("获取Workflow数量失败，" + tx.Error.Error())
+		return nil, errors.New("获取Workflow数量失败，" + tx.Error.Error())
+	}
+	total := 0
+	for _, facet := range facets {
+		total += facet.Total
+	}
 	//定义数据库查询返回内容
 	var workflowList []*model.Workflow
 	//数据库查询，Limit方法用于限制条数，Offset方法设置起始位置
-	tx := db.GORM.
-		Where("namespace = ?", namespace).
+	tx = db.GORM.Scopes(scope).
 		Limit(limit).
 		Offset(startSet).
 		Order("id desc").
@@ -41,15 +75,19 @@ func (w *workflow) GetList(namespace string, page, limit int) (data *WorkflowRes
 		return nil, errors.New("获取Workflow列表失败，" + tx.Error.Error())
 	}
 	return &WorkflowResp{
-		Items: workflowList,
-		Total: len(workflowList),
+		Items:  workflowList,
+		Total:  total,
+		Facets: facets,
 	}, nil
 }
 
 //获取workflow单条数据
 func (w *workflow) GetById(id int) (workflow *model.Workflow, err error) {
 	workflow = &model.Workflow{} //给空间
-	tx := db.GORM.Where("id = ?", id).First(&workflow)
+	//详情中返回每一步的结果
+	tx := db.GORM.Preload("Steps", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("id")
+	}).Where("id = ?", id).First(&workflow)
 	if tx.Error != nil && tx.Error.Error() != "record not found" {
 		logger.Error("获取Workflow单条数据失败，" + tx.Error.Error())
 		return nil, errors.New("获取Workflow单条数据失败，" + tx.Error.Error())
@@ -57,7 +95,7 @@ func (w *workflow) GetById(id int) (workflow *model.Workflow, err error) {
 	return
 }
 
-//新增workflow
+//新增workflow，workflow.Steps会在同一个事务中写入
 func (w *workflow) Add(workflow *model.Workflow) (err error) {
 	tx := db.GORM.Create(&workflow)
 	if tx.Error != nil {
@@ -73,11 +111,38 @@ func (w *workflow) Add(workflow *model.Workflow) (err error) {
 //实际执行语句UPDATE 'workflow' SET 'deleted_at' = '2022-09-28 16:22:55' WHERE 'id' IN ('1')
 //硬删除db.GORM.Unscoped().Delete("id = ?",id)直接从表中删除这条数据
 //实际执行语句DELETE FROM 'workflow' WHERE 'id' IN ('1');
+//workflow和workflow_step在同一个事务中删除
 func (w *workflow) DelById(id int) (err error) {
-	tx := db.GORM.Where("id = ?", id).Delete(&model.Workflow{})
-	if tx.Error != nil {
-		logger.Error("删除Workflow失败，" + tx.Error.Error())
-		return errors.New("删除Workflow失败，" + tx.Error.Error())
+	err = db.GORM.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workflow_id = ?", id).Delete(&model.WorkflowStep{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&model.Workflow{}).Error
+	})
+	if err != nil {
+		logger.Error("删除Workflow失败，" + err.Error())
+		return errors.New("删除Workflow失败，" + err.Error())
+	}
+	return nil
+}
+
+//更新workflow状态，并在同一个事务中追加步骤记录
+func (w *workflow) UpdateStatus(id uint, status string, steps []*model.WorkflowStep) (err error) {
+	err = db.GORM.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Workflow{}).Where("id = ?", id).Update("status", status).Error; err != nil {
+			return err
+		}
+		for _, step := range steps {
+			step.WorkflowID = id
+		}
+		if len(steps) == 0 {
+			return nil
+		}
+		return tx.Create(&steps).Error
+	})
+	if err != nil {
+		logger.Error("更新Workflow状态失败，" + err.Error())
+		return errors.New("更新Workflow状态失败，" + err.Error())
 	}
 	return nil
 }
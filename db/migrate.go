@@ -0,0 +1,57 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"k8s-platform/config"
+	"k8s-platform/model"
+
+	"github.com/wonderivan/logger"
+	"gorm.io/gorm/schema"
+)
+
+//需要自动迁移的表，新增表时需要加到这里
+var models = []interface{}{
+	&model.Workflow{},
+	&model.WorkflowStep{},
+	&model.Cluster{},
+	&model.User{},
+	&model.RoleBinding{},
+	&model.TokenBlacklist{},
+	&model.Audit{},
+	&model.TerminalRecord{},
+}
+
+//数据库迁移，启动时根据model创建缺少的表、字段和索引，已有的数据不会被删除
+func Migrate() error {
+	//添加唯一索引之前清理重复的数据，黑名单中同一个jti只需要保留一条
+	if err := dedupe(&model.TokenBlacklist{}, "jti"); err != nil {
+		logger.Error("数据库迁移失败，" + err.Error())
+		return errors.New("数据库迁移失败，" + err.Error())
+	}
+	if err := GORM.AutoMigrate(models...); err != nil {
+		logger.Error("数据库迁移失败，" + err.Error())
+		return errors.New("数据库迁移失败，" + err.Error())
+	}
+	//多集群之前创建的workflow没有cluster字段，回填为默认集群，否则按集群查询列表时查不到
+	tx := GORM.Model(&model.Workflow{}).
+		Where("cluster = '' or cluster is null").
+		Update("cluster", config.DefaultCluster)
+	if tx.Error != nil {
+		logger.Error("回填Workflow集群失败，" + tx.Error.Error())
+		return errors.New("回填Workflow集群失败，" + tx.Error.Error())
+	}
+	logger.Info("数据库迁移成功！")
+	return nil
+}
+
+//删除column重复的数据，每个值只保留id最小的一条，表不存在时跳过
+//子查询外再包一层，mysql不允许在删除语句的子查询中直接查询同一张表
+func dedupe(table schema.Tabler, column string) error {
+	if !GORM.Migrator().HasTable(table) {
+		return nil
+	}
+	name := table.TableName()
+	return GORM.Exec(fmt.Sprintf("DELETE FROM %s WHERE id NOT IN (SELECT id FROM (SELECT MIN(id) AS id FROM %s GROUP BY %s) t)",
+		name, name, column)).Error
+}
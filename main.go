@@ -1,38 +1,66 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"k8s-platform/config"
 	"k8s-platform/controller"
 	"k8s-platform/db"
 	"k8s-platform/middle"
 	"k8s-platform/service"
+	"k8s-platform/utils"
 	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
+	"github.com/wonderivan/logger"
 )
 
 func main() {
-	//初始化k8s clientset
-	service.K8s.Init()
+	//加载配置文件、环境变量和命令行参数
+	if err := config.Init(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		logger.Error("加载配置失败，" + err.Error())
+		os.Exit(1)
+	}
+	//加载jwt签名密钥
+	if err := utils.JWTToken.Init(); err != nil {
+		logger.Error("加载jwt密钥失败，" + err.Error())
+		os.Exit(1)
+	}
 	//初始化数据库
 	db.Init()
 	//关闭db连接
 	defer db.Close()
-	//初始化gin对象路由配置
-	r := gin.Default()
+	//创建或更新数据库表结构
+	if err := db.Migrate(); err != nil {
+		os.Exit(1)
+	}
+	//用户表为空时创建初始管理员
+	service.User.InitAdmin()
+	//初始化k8s clientset，数据库中保存的集群依赖db连接
+	service.K8s.Init()
+	//初始化gin对象路由配置，访问日志中去掉query参数中的token
+	r := gin.New()
+	r.Use(middle.Logger(), gin.Recovery())
 	//跨域配置
 	r.Use(middle.Cors())
 	//jwt token验证
 	r.Use(middle.JWTAuth())
+	//变更类接口的审计日志，放在RBAC之前以记录被拒绝的请求
+	r.Use(middle.Audit())
+	//按角色绑定鉴权
+	r.Use(middle.RBAC())
+	//返回集群缓存状态
+	r.Use(middle.CacheStatus())
 	//初始化路由规则
 	controller.Router.InitApiRouter(r)
 
-	//终端websocket
-	go func() {
-		http.HandleFunc("/ws", service.Terminal.WsHandler)
-		http.ListenAndServe(":9094", nil)
-	}()
-
-	//http server gin程序启动
-	r.Run(config.ListenAddr)
+	//http server gin程序启动，保存原始的ResponseWriter用于流式接口设置写入超时
+	if err := http.ListenAndServe(config.ListenAddr, utils.KeepRawWriter(r)); err != nil {
+		logger.Error("启动http server失败，" + err.Error())
+		os.Exit(1)
+	}
 }
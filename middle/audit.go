@@ -0,0 +1,142 @@
+package middle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"k8s-platform/config"
+	"k8s-platform/model"
+	"k8s-platform/service"
+	"k8s-platform/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//auditWriter在写回响应的同时保存响应内容，用于从返回的msg中获取失败原因
+type auditWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+//Audit中间件，记录/api/k8s/下所有POST、PUT、DELETE请求的审计日志
+//需要在JWTAuth之后、RBAC之前使用，这样被RBAC拒绝的请求也会被记录
+func Audit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.FullPath()
+		if !strings.HasPrefix(path, "/api/k8s/") || c.Request.Method == http.MethodGet {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		var body []byte
+		if c.Request.Body != nil && !isMultipart(c) {
+			body, _ = io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+		}
+		route, ok := routePermissions[c.Request.Method+" "+path]
+		if !ok {
+			route = routePermission{resource: path, verb: c.Request.Method}
+		}
+		record := &model.Audit{
+			IP:       c.ClientIP(),
+			Method:   c.Request.Method,
+			Path:     path,
+			Resource: route.resource,
+			Verb:     route.verb,
+			Cluster:  config.DefaultCluster,
+			Name:     auditName(route.resource, body),
+			Command:  auditCommand(route.verb, body),
+		}
+		//multipart请求不读取body，资源名从query中获取
+		if isMultipart(c) {
+			record.Name = c.Query(route.resource + "_name")
+		}
+		//在执行接口之前获取cluster和namespace，workflow删除后就无法从数据库中获取了
+		if perm, err := buildPermission(c, route); err == nil {
+			record.Cluster = perm.Cluster
+			record.Namespace = perm.Namespace
+		}
+		writer := &auditWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		record.Status = writer.Status()
+		record.Latency = time.Since(start).Milliseconds()
+		if claims, ok := c.Get("claims"); ok {
+			record.Username = claims.(*utils.CustomClaims).Username
+		}
+		if len(body) > 0 {
+			sum := sha256.Sum256(body)
+			record.BodyDigest = hex.EncodeToString(sum[:])
+		}
+		if record.Status >= 400 {
+			resp := new(struct {
+				Msg string `json:"msg"`
+			})
+			if json.Unmarshal(writer.body.Bytes(), resp) == nil {
+				record.Message = resp.Msg
+			}
+		}
+		service.Audit.Record(record)
+	}
+}
+
+//从请求body中获取执行的命令，只记录exec接口，被RBAC拒绝的请求同样记录
+func auditCommand(verb string, body []byte) string {
+	if verb != "exec" {
+		return ""
+	}
+	values, err := bodyValues(body)
+	if err != nil {
+		return ""
+	}
+	command, ok := values["command"].([]interface{})
+	if !ok {
+		return ""
+	}
+	data, err := json.Marshal(command)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+//从请求body中获取资源名，依次尝试<resource>_name、name、id以及content中的metadata.name
+func auditName(resource string, body []byte) string {
+	values, err := bodyValues(body)
+	if err != nil {
+		return ""
+	}
+	for _, key := range []string{resource + "_name", "name", "id"} {
+		switch v := values[key].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case json.Number:
+			return v.String()
+		}
+	}
+	//更新接口的content为资源的json
+	if content, ok := values["content"].(string); ok {
+		object := new(struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		})
+		if json.Unmarshal([]byte(content), object) == nil {
+			return object.Metadata.Name
+		}
+	}
+	return ""
+}
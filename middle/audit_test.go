@@ -0,0 +1,21 @@
+package middle
+
+import "testing"
+
+//exec接口需要记录命令原文，大小写不同的key与controller绑定的结果一致
+func TestAuditCommand(t *testing.T) {
+	cases := []struct {
+		verb, body, want string
+	}{
+		{"exec", `{"pod_name":"a","command":["sh","-c","rm -rf /data"]}`, `["sh","-c","rm -rf /data"]`},
+		{"exec", `{"pod_name":"a","Command":["cat","/etc/passwd"]}`, `["cat","/etc/passwd"]`},
+		{"exec", `{"pod_name":"a"}`, ""},
+		{"exec", `not json`, ""},
+		{"delete", `{"command":["ls"]}`, ""},
+	}
+	for _, c := range cases {
+		if got := auditCommand(c.verb, []byte(c.body)); got != c.want {
+			t.Errorf("%s %s: 记录的命令为%q，期望%q", c.verb, c.body, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package middle
+
+import (
+	"k8s-platform/service"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//缓存状态相关的响应头，前端据此判断数据的新鲜程度
+const (
+	headerCacheSynced    = "X-Cache-Synced"
+	headerCacheSyncedAt  = "X-Cache-Synced-At"
+	headerCacheLastEvent = "X-Cache-Last-Event"
+	headerCacheAge       = "X-Cache-Age"
+)
+
+//路由中的资源与缓存资源的对应关系
+var cacheResourceNames = map[string]string{
+	"pod":         "pods",
+	"deployment":  "deployments",
+	"daemonset":   "daemonsets",
+	"statefulset": "statefulsets",
+	"service":     "services",
+	"ingress":     "ingresses",
+	"configmap":   "configmaps",
+	"secret":      "secrets",
+	"pvc":         "persistentvolumeclaims",
+	"pv":          "persistentvolumes",
+	"node":        "nodes",
+	"namespace":   "namespaces",
+}
+
+//CacheStatus中间件，在/api/k8s/下的GET请求的响应头中返回集群缓存的状态
+//X-Cache-Synced为false时数据直接从apiserver读取，为true时X-Cache-Age为距最近一次watch事件的秒数
+//缓存按资源同步，接口对应的资源已同步完成时X-Cache-Synced即为true
+func CacheStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet || !strings.HasPrefix(c.FullPath(), "/api/k8s/") {
+			c.Next()
+			return
+		}
+		status := service.K8s.GetCacheStatus(c.Query("cluster"))
+		synced := status.Synced
+		//UnsyncedResources为空并且未同步完成时表示集群没有缓存
+		if route, ok := routePermissions[c.Request.Method+" "+c.FullPath()]; ok && !synced && len(status.UnsyncedResources) > 0 {
+			if resource, ok := cacheResourceNames[route.resource]; ok {
+				synced = !resourceUnsynced(status, resource)
+			}
+		}
+		c.Header(headerCacheSynced, strconv.FormatBool(synced))
+		if status.SyncedAt != nil {
+			c.Header(headerCacheSyncedAt, status.SyncedAt.Format(time.RFC3339))
+		}
+		if status.LastEventAt != nil {
+			c.Header(headerCacheLastEvent, status.LastEventAt.Format(time.RFC3339))
+			c.Header(headerCacheAge, strconv.Itoa(int(time.Since(*status.LastEventAt).Seconds())))
+		}
+		c.Next()
+	}
+}
+
+func resourceUnsynced(status *service.CacheStatus, resource string) bool {
+	for _, r := range status.UnsyncedResources {
+		if r == resource {
+			return true
+		}
+	}
+	return false
+}
@@ -19,6 +19,8 @@ func Cors() gin.HandlerFunc {
 		//c.Header("Access-Control-Allow-Methods", "*")
 		c.Header("Access-Control-Allow-Headers", "X-Token, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Max")
 		c.Header("Access-Control-Allow-Credentials", "false")
+		//允许前端读取缓存状态的响应头
+		c.Header("Access-Control-Expose-Headers", "X-Cache-Synced, X-Cache-Synced-At, X-Cache-Last-Event, X-Cache-Age")
 		//旅行所有OPTIONS方法
 		if method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
@@ -0,0 +1,35 @@
+package middle
+
+import (
+	"k8s-platform/db"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+//使用内存sqlite代替mysql，并执行与启动时相同的迁移，每个测试使用独立的数据库
+func setupTestDB(t *testing.T) {
+	gormDB, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//内存数据库每个连接都是独立的，只保留一个连接
+	sqlDB.SetMaxOpenConns(1)
+	old := db.GORM
+	db.GORM = gormDB
+	t.Cleanup(func() {
+		db.GORM = old
+		sqlDB.Close()
+	})
+	if err = db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+}
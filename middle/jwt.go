@@ -1,21 +1,67 @@
 package middle
 
 import (
+	"k8s-platform/service"
 	"k8s-platform/utils"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 )
 
+//免登录的接口，refresh接口使用body中的refresh token鉴权，oidc回调接口使用state和code鉴权
+//readyz为就绪检查接口，供k8s探针调用
+var publicPaths = []string{
+	"/api/login",
+	"/api/token/refresh",
+	"/api/oidc/login",
+	"/api/oidc/callback",
+	"/readyz",
+}
+
+func isPublicPath(path string) bool {
+	for _, p := range publicPaths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+//是否为WebSocket或Server-Sent Events请求
+func isStreamRequest(r *http.Request) bool {
+	return websocket.IsWebSocketUpgrade(r) || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+//获取请求中的token，优先使用Header中的Authorization
+//浏览器的WebSocket和EventSource无法设置header，此类请求允许通过query参数token传递，WebSocket还可以通过子协议传递
+func requestToken(c *gin.Context) string {
+	if token := c.Request.Header.Get("Authorization"); token != "" {
+		return token
+	}
+	if !isStreamRequest(c.Request) {
+		return ""
+	}
+	if token := c.Query("token"); token != "" {
+		return token
+	}
+	for _, protocol := range websocket.Subprotocols(c.Request) {
+		if strings.HasPrefix(protocol, service.WsTokenProtocolPrefix) {
+			return strings.TrimPrefix(protocol, service.WsTokenProtocolPrefix)
+		}
+	}
+	return ""
+}
+
 func JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		//对登录接口放行
-
-		if len(c.Request.URL.String()) >= 10 && c.Request.URL.String()[0:10] == "/api/login" {
+		//对免登录接口放行
+		if isPublicPath(c.Request.URL.Path) {
 			c.Next()
 		} else {
 			//获取Header中的Authorization
-			token := c.Request.Header.Get("Authorization")
+			token := requestToken(c)
 			if token == "" {
 				c.JSON(http.StatusBadRequest, gin.H{
 					"msg":  "请求未携带token，无权限访问",
@@ -44,6 +90,42 @@ func JWTAuth() gin.HandlerFunc {
 				c.Abort()
 				return
 			}
+			//refresh token只能用于换取新的token，不能访问接口
+			if claims.TokenType != utils.AccessToken {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"msg":  "token类型错误",
+					"data": nil,
+				})
+				c.Abort()
+				return
+			}
+			//已注销的token
+			revoked, err := service.Token.IsRevoked(claims.Id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"msg":  err.Error(),
+					"data": nil,
+				})
+				c.Abort()
+				return
+			}
+			if revoked {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"msg":  "token已注销，请重新登录",
+					"data": nil,
+				})
+				c.Abort()
+				return
+			}
+			//用户被禁用或密码变更后，之前签发的token立即失效
+			if err = service.Token.CheckUser(claims); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"msg":  err.Error(),
+					"data": nil,
+				})
+				c.Abort()
+				return
+			}
 			//继续交由下一个路由处理，并将解析出的信息传递下去
 			c.Set("claims", claims)
 			c.Next()
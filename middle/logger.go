@@ -0,0 +1,55 @@
+package middle
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//访问日志中间件，格式与gin默认的Logger一致
+//WebSocket和EventSource请求通过query参数token传递token，记录日志前替换掉，避免token写入日志
+func Logger() gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{
+		Formatter: func(param gin.LogFormatterParams) string {
+			var statusColor, methodColor, resetColor string
+			if param.IsOutputColor() {
+				statusColor = param.StatusCodeColor()
+				methodColor = param.MethodColor()
+				resetColor = param.ResetColor()
+			}
+			if param.Latency > time.Minute {
+				param.Latency = param.Latency.Truncate(time.Second)
+			}
+			return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+				param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+				statusColor, param.StatusCode, resetColor,
+				param.Latency,
+				param.ClientIP,
+				methodColor, param.Method, resetColor,
+				redactToken(param.Path),
+				param.ErrorMessage,
+			)
+		},
+	})
+}
+
+//替换请求地址中的token参数，地址无法解析时去掉整个query
+func redactToken(path string) string {
+	u, err := url.Parse(path)
+	if err != nil {
+		if i := strings.IndexByte(path, '?'); i >= 0 {
+			return path[:i]
+		}
+		return path
+	}
+	query := u.Query()
+	if _, ok := query["token"]; !ok {
+		return path
+	}
+	query.Set("token", "REDACTED")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
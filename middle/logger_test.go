@@ -0,0 +1,37 @@
+package middle
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+//通过query参数传递的token不能写入访问日志
+func TestLoggerRedactsToken(t *testing.T) {
+	var out bytes.Buffer
+	old := gin.DefaultWriter
+	gin.DefaultWriter = &out
+	t.Cleanup(func() { gin.DefaultWriter = old })
+
+	engine := gin.New()
+	engine.Use(Logger())
+	engine.GET("/api/k8s/pod/log/stream", func(c *gin.Context) {})
+	for _, target := range []string{
+		"/api/k8s/pod/log/stream?namespace=dev&token=secret-jwt",
+		"/api/k8s/pod/log/stream?token=secret-jwt&token=other-jwt",
+		"/api/k8s/pod/log/stream?token=secret-jwt&bad=%zz",
+	} {
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	logs := out.String()
+	if strings.Contains(logs, "secret-jwt") || strings.Contains(logs, "other-jwt") {
+		t.Fatalf("访问日志中包含token，%s", logs)
+	}
+	if !strings.Contains(logs, "namespace=dev") {
+		t.Fatalf("其他参数应该保留，%s", logs)
+	}
+}
@@ -0,0 +1,343 @@
+package middle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"k8s-platform/config"
+	"k8s-platform/dao"
+	"k8s-platform/service"
+	"k8s-platform/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wonderivan/logger"
+)
+
+//routePermission定义路由需要的权限
+//filter为true的列表接口，在没有集群范围权限时不直接拒绝，而是把有权限的namespace传给controller过滤
+type routePermission struct {
+	resource string
+	verb     string
+	scope    string
+	filter   bool
+}
+
+//路由与权限的对应关系，key为"请求方法 路由"，未在此定义的路由只允许平台管理员访问
+var routePermissions = map[string]routePermission{
+	//退出登录
+	"POST /api/logout": {resource: "token", verb: "delete", scope: service.ScopeSelf},
+	//用户管理
+	"GET /api/users":                {resource: "user", verb: "list", scope: service.ScopePlatform},
+	"POST /api/user/create":         {resource: "user", verb: "create", scope: service.ScopePlatform},
+	"PUT /api/user/disable":         {resource: "user", verb: "update", scope: service.ScopePlatform},
+	"PUT /api/user/reset_password":  {resource: "user", verb: "update", scope: service.ScopePlatform},
+	"PUT /api/user/change_password": {resource: "user", verb: "update", scope: service.ScopeSelf},
+	//角色绑定
+	"GET /api/rolebindings":        {resource: "rolebinding", verb: "list", scope: service.ScopePlatform},
+	"POST /api/rolebinding/create": {resource: "rolebinding", verb: "create", scope: service.ScopePlatform},
+	"DELETE /api/rolebinding/del":  {resource: "rolebinding", verb: "delete", scope: service.ScopePlatform},
+	//审计日志
+	"GET /api/audit":        {resource: "audit", verb: "list", scope: service.ScopePlatform},
+	"GET /api/audit/export": {resource: "audit", verb: "list", scope: service.ScopePlatform},
+	//终端录像
+	"GET /api/terminal/records":         {resource: "terminalrecord", verb: "list", scope: service.ScopePlatform},
+	"GET /api/terminal/record/download": {resource: "terminalrecord", verb: "get", scope: service.ScopePlatform},
+	//终端会话
+	"GET /api/terminal/sessions":       {resource: "terminalsession", verb: "list", scope: service.ScopePlatform},
+	"DELETE /api/terminal/session/del": {resource: "terminalsession", verb: "delete", scope: service.ScopePlatform},
+	//端口转发
+	"GET /api/portforwards":       {resource: "portforward", verb: "list", scope: service.ScopePlatform},
+	"DELETE /api/portforward/del": {resource: "portforward", verb: "delete", scope: service.ScopePlatform},
+	//集群管理
+	"GET /api/k8s/clusters":        {resource: "cluster", verb: "list", scope: service.ScopePlatform},
+	"POST /api/k8s/cluster/create": {resource: "cluster", verb: "create", scope: service.ScopePlatform},
+	"PUT /api/k8s/cluster/update":  {resource: "cluster", verb: "update", scope: service.ScopePlatform},
+	"GET /api/k8s/cluster/test":    {resource: "cluster", verb: "get", scope: service.ScopePlatform},
+	"DELETE /api/k8s/cluster/del":  {resource: "cluster", verb: "delete", scope: service.ScopePlatform},
+	"GET /api/k8s/cluster/cache":   {resource: "cluster", verb: "get", scope: service.ScopeSelf},
+	//k8s资源
+	"GET /api/k8s/workflows":          {resource: "workflow", verb: "list", scope: service.ScopeNamespace, filter: true},
+	"GET /api/k8s/workflow/detail":    {resource: "workflow", verb: "get", scope: service.ScopeNamespace},
+	"POST /api/k8s/workflow/create":   {resource: "workflow", verb: "create", scope: service.ScopeNamespace},
+	"DELETE /api/k8s/workflow/del":    {resource: "workflow", verb: "delete", scope: service.ScopeNamespace},
+	"GET /api/k8s/pods":               {resource: "pod", verb: "list", scope: service.ScopeNamespace, filter: true},
+	"GET /api/k8s/pod/detail":         {resource: "pod", verb: "get", scope: service.ScopeNamespace},
+	"DELETE /api/k8s/pod/del":         {resource: "pod", verb: "delete", scope: service.ScopeNamespace},
+	"PUT /api/k8s/pod/update":         {resource: "pod", verb: "update", scope: service.ScopeNamespace},
+	"GET /api/k8s/pod/container":      {resource: "pod", verb: "get", scope: service.ScopeNamespace},
+	"GET /api/k8s/pod/log":            {resource: "pod", verb: "log", scope: service.ScopeNamespace},
+	"GET /api/k8s/pod/log/stream":     {resource: "pod", verb: "log", scope: service.ScopeNamespace},
+	"GET /api/k8s/pod/log/aggregate":  {resource: "pod", verb: "log", scope: service.ScopeNamespace},
+	"GET /api/k8s/pod/numnp":          {resource: "pod", verb: "list", scope: service.ScopeNamespace, filter: true},
+	"GET /api/k8s/pod/terminal":       {resource: "pod", verb: "exec", scope: service.ScopeNamespace},
+	"GET /api/k8s/pod/debug":          {resource: "pod", verb: "exec", scope: service.ScopeNamespace},
+	"GET /api/k8s/pod/portforward":    {resource: "pod", verb: "portforward", scope: service.ScopeNamespace},
+	"POST /api/k8s/pod/exec":          {resource: "pod", verb: "exec", scope: service.ScopeNamespace},
+	"GET /api/k8s/pod/file/download":  {resource: "pod", verb: "exec", scope: service.ScopeNamespace},
+	"POST /api/k8s/pod/file/upload":   {resource: "pod", verb: "exec", scope: service.ScopeNamespace},
+	"GET /api/k8s/deployments":        {resource: "deployment", verb: "list", scope: service.ScopeNamespace, filter: true},
+	"GET /api/k8s/deployment/detail":  {resource: "deployment", verb: "get", scope: service.ScopeNamespace},
+	"PUT /api/k8s/deployment/scale":   {resource: "deployment", verb: "update", scope: service.ScopeNamespace},
+	"DELETE /api/k8s/deployment/del":  {resource: "deployment", verb: "delete", scope: service.ScopeNamespace},
+	"PUT /api/k8s/deployment/restart": {resource: "deployment", verb: "update", scope: service.ScopeNamespace},
+	"PUT /api/k8s/deployment/update":  {resource: "deployment", verb: "update", scope: service.ScopeNamespace},
+	"GET /api/k8s/deployment/numnp":   {resource: "deployment", verb: "list", scope: service.ScopeNamespace, filter: true},
+	"POST /api/k8s/deployment/create": {resource: "deployment", verb: "create", scope: service.ScopeNamespace},
+	"GET /api/k8s/daemonsets":         {resource: "daemonset", verb: "list", scope: service.ScopeNamespace, filter: true},
+	"GET /api/k8s/daemonset/detail":   {resource: "daemonset", verb: "get", scope: service.ScopeNamespace},
+	"DELETE /api/k8s/daemonset/del":   {resource: "daemonset", verb: "delete", scope: service.ScopeNamespace},
+	"PUT /api/k8s/daemonset/update":   {resource: "daemonset", verb: "update", scope: service.ScopeNamespace},
+	"GET /api/k8s/statefulsets":       {resource: "statefulset", verb: "list", scope: service.ScopeNamespace, filter: true},
+	"GET /api/k8s/statefulset/detail": {resource: "statefulset", verb: "get", scope: service.ScopeNamespace},
+	"DELETE /api/k8s/statefulset/del": {resource: "statefulset", verb: "delete", scope: service.ScopeNamespace},
+	"PUT /api/k8s/statefulset/update": {resource: "statefulset", verb: "update", scope: service.ScopeNamespace},
+	"GET /api/k8s/services":           {resource: "service", verb: "list", scope: service.ScopeNamespace, filter: true},
+	"GET /api/k8s/service/detail":     {resource: "service", verb: "get", scope: service.ScopeNamespace},
+	"DELETE /api/k8s/service/del":     {resource: "service", verb: "delete", scope: service.ScopeNamespace},
+	"PUT /api/k8s/service/update":     {resource: "service", verb: "update", scope: service.ScopeNamespace},
+	"POST /api/k8s/service/create":    {resource: "service", verb: "create", scope: service.ScopeNamespace},
+	"GET /api/k8s/ingresses":          {resource: "ingress", verb: "list", scope: service.ScopeNamespace, filter: true},
+	"GET /api/k8s/ingress/detail":     {resource: "ingress", verb: "get", scope: service.ScopeNamespace},
+	"DELETE /api/k8s/ingress/del":     {resource: "ingress", verb: "delete", scope: service.ScopeNamespace},
+	"PUT /api/k8s/ingress/update":     {resource: "ingress", verb: "update", scope: service.ScopeNamespace},
+	"POST /api/k8s/ingress/create":    {resource: "ingress", verb: "create", scope: service.ScopeNamespace},
+	"GET /api/k8s/configmaps":         {resource: "configmap", verb: "list", scope: service.ScopeNamespace, filter: true},
+	"GET /api/k8s/configmap/detail":   {resource: "configmap", verb: "get", scope: service.ScopeNamespace},
+	"DELETE /api/k8s/configmap/del":   {resource: "configmap", verb: "delete", scope: service.ScopeNamespace},
+	"PUT /api/k8s/configmap/update":   {resource: "configmap", verb: "update", scope: service.ScopeNamespace},
+	"GET /api/k8s/secrets":            {resource: "secret", verb: "list", scope: service.ScopeNamespace, filter: true},
+	"GET /api/k8s/secret/detail":      {resource: "secret", verb: "get", scope: service.ScopeNamespace},
+	"DELETE /api/k8s/secret/del":      {resource: "secret", verb: "delete", scope: service.ScopeNamespace},
+	"PUT /api/k8s/secret/update":      {resource: "secret", verb: "update", scope: service.ScopeNamespace},
+	"GET /api/k8s/pvcs":               {resource: "pvc", verb: "list", scope: service.ScopeNamespace, filter: true},
+	"GET /api/k8s/pvc/detail":         {resource: "pvc", verb: "get", scope: service.ScopeNamespace},
+	"DELETE /api/k8s/pvc/del":         {resource: "pvc", verb: "delete", scope: service.ScopeNamespace},
+	"PUT /api/k8s/pvc/update":         {resource: "pvc", verb: "update", scope: service.ScopeNamespace},
+	"GET /api/k8s/nodes":              {resource: "node", verb: "list", scope: service.ScopeCluster},
+	"GET /api/k8s/node/detail":        {resource: "node", verb: "get", scope: service.ScopeCluster},
+	"GET /api/k8s/namespaces":         {resource: "namespace", verb: "list", scope: service.ScopeNamespace, filter: true},
+	"GET /api/k8s/namespace/detail":   {resource: "namespace", verb: "get", scope: service.ScopeNamespace},
+	"DELETE /api/k8s/namespace/del":   {resource: "namespace", verb: "delete", scope: service.ScopeCluster},
+	"GET /api/k8s/pvs":                {resource: "pv", verb: "list", scope: service.ScopeCluster},
+	"GET /api/k8s/pv/detail":          {resource: "pv", verb: "get", scope: service.ScopeCluster},
+}
+
+//RBAC中间件，在controller执行前根据路由对应的资源和操作进行鉴权，无权限时返回403
+//需要在JWTAuth之后使用
+func RBAC() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//免登录接口和非api接口不鉴权
+		path := c.FullPath()
+		if !strings.HasPrefix(path, "/api/") || isPublicPath(path) {
+			c.Next()
+			return
+		}
+		claims := c.MustGet("claims").(*utils.CustomClaims)
+		route, ok := routePermissions[c.Request.Method+" "+path]
+		if !ok {
+			route = routePermission{resource: path, verb: c.Request.Method, scope: service.ScopePlatform}
+		}
+		perm, err := buildPermission(c, route)
+		if errors.Is(err, errWorkflowNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"msg":  err.Error(),
+				"data": nil,
+			})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"msg":  err.Error(),
+				"data": nil,
+			})
+			c.Abort()
+			return
+		}
+		//namespace为空的列表接口，按有权限的namespace过滤
+		if route.filter && perm.Namespace == "" {
+			all, namespaces, err := service.RBAC.AllowedNamespaces(claims.Username, perm.Cluster, perm.Resource, perm.Verb)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"msg":  err.Error(),
+					"data": nil,
+				})
+				c.Abort()
+				return
+			}
+			if all {
+				c.Next()
+				return
+			}
+			if len(namespaces) > 0 {
+				c.Set("allowed_namespaces", namespaces)
+				c.Next()
+				return
+			}
+			deny(c, claims.Username, perm)
+			return
+		}
+		allowed, err := service.RBAC.Authorize(claims.Username, perm)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"msg":  err.Error(),
+				"data": nil,
+			})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			deny(c, claims.Username, perm)
+			return
+		}
+		c.Next()
+	}
+}
+
+func deny(c *gin.Context, username string, perm *service.Permission) {
+	msg := fmt.Sprintf("用户%s无权限对集群%s中namespace[%s]的%s资源执行%s操作",
+		username, perm.Cluster, perm.Namespace, perm.Resource, perm.Verb)
+	logger.Error(msg)
+	c.JSON(http.StatusForbidden, gin.H{
+		"msg":  msg,
+		"data": nil,
+	})
+	c.Abort()
+}
+
+//workflow不存在，RBAC中间件据此返回404
+var errWorkflowNotFound = errors.New("Workflow不存在")
+
+//从请求参数中解析出cluster和namespace，组装成Permission
+func buildPermission(c *gin.Context, route routePermission) (perm *service.Permission, err error) {
+	params, err := requestParams(c)
+	if err != nil {
+		return nil, err
+	}
+	perm = &service.Permission{
+		Cluster:   params["cluster"],
+		Namespace: params["namespace"],
+		Resource:  route.resource,
+		Verb:      route.verb,
+		Scope:     route.scope,
+	}
+	//namespace详情接口的参数名为namespace_name
+	if route.resource == "namespace" && params["namespace_name"] != "" {
+		perm.Namespace = params["namespace_name"]
+	}
+	//workflow详情和删除接口只传id，cluster和namespace从数据库中获取
+	if route.resource == "workflow" && params["id"] != "" {
+		id, err := strconv.Atoi(params["id"])
+		if err != nil {
+			return nil, fmt.Errorf("id参数不合法，%s", params["id"])
+		}
+		workflow, err := dao.Workflow.GetById(id)
+		if err != nil {
+			return nil, err
+		}
+		//不存在时不能使用默认集群鉴权，否则鉴权的对象与实际操作的对象不一致
+		if workflow.ID == 0 {
+			return nil, errWorkflowNotFound
+		}
+		perm.Cluster = workflow.Cluster
+		perm.Namespace = workflow.Namespace
+	}
+	if perm.Cluster == "" {
+		perm.Cluster = config.DefaultCluster
+	}
+	return perm, nil
+}
+
+//获取请求参数，GET请求和multipart请求从query中获取，其他请求从json body中获取
+//读取body后需要重新写回，保证controller中的ShouldBindJSON可以正常绑定
+//json body的key按encoding/json绑定结构体时的规则忽略大小写，保证鉴权的参数与controller实际使用的参数一致
+func requestParams(c *gin.Context) (params map[string]string, err error) {
+	params = map[string]string{}
+	if c.Request.Method == http.MethodGet || isMultipart(c) {
+		for key := range c.Request.URL.Query() {
+			params[key] = c.Query(key)
+		}
+		return params, nil
+	}
+	if c.Request.Body == nil {
+		return params, nil
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取请求body失败，%s", err.Error())
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+	if len(body) == 0 {
+		return params, nil
+	}
+	values, err := bodyValues(body)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range values {
+		switch v := value.(type) {
+		case string:
+			params[key] = v
+		//controller中的数字参数都是整数，不是整数时绑定会失败，这里直接拒绝
+		case json.Number:
+			if _, err = strconv.ParseInt(v.String(), 10, 64); err != nil {
+				return nil, fmt.Errorf("请求参数%s必须为整数，%s", key, v.String())
+			}
+			params[key] = v.String()
+		case bool:
+			params[key] = strconv.FormatBool(v)
+		}
+	}
+	return params, nil
+}
+
+//解析json body，返回的key为忽略大小写后的key
+//controller使用json.Decoder绑定参数，只解析第一个json值，并且key忽略大小写、重复时后面的值生效，
+//所以body不是单个json对象，或者有忽略大小写后重复的key时直接拒绝，避免鉴权和实际操作的对象不一致
+func bodyValues(body []byte) (values map[string]interface{}, err error) {
+	raw := map[string]json.RawMessage{}
+	if err = json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("请求body不是合法的json对象，%s", err.Error())
+	}
+	values = map[string]interface{}{}
+	for key, data := range raw {
+		folded := foldKey(key)
+		if _, ok := values[folded]; ok {
+			return nil, fmt.Errorf("请求参数%s重复", folded)
+		}
+		//数字保留原文，避免转换成float64后大整数丢失精度或格式化为科学计数法
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err = decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("请求body不是合法的json对象，%s", err.Error())
+		}
+		values[folded] = value
+	}
+	return values, nil
+}
+
+//将key转换为忽略大小写后的形式，与encoding/json匹配结构体字段的规则一致，如Namespace、NAMESPACE都转换为namespace
+//每个字符取大小写等价字符中最小的一个再转小写，这样K(开尔文符号)、ſ等特殊字符也能和k、s匹配
+func foldKey(key string) string {
+	return strings.ToLower(strings.Map(func(r rune) rune {
+		min := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < min {
+				min = f
+			}
+		}
+		return min
+	}, key))
+}
+
+//multipart请求（如上传文件）的body可能很大，中间件不读取body，参数通过query传递
+func isMultipart(c *gin.Context) bool {
+	return strings.HasPrefix(c.ContentType(), "multipart/")
+}
@@ -0,0 +1,118 @@
+package middle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"k8s-platform/dao"
+	"k8s-platform/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newJSONContext(method, body string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(method, "/api/k8s/pod/del", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	return c
+}
+
+//鉴权使用的namespace必须与controller中ShouldBindJSON绑定到的namespace一致
+func TestRequestParamsMatchesBinding(t *testing.T) {
+	bodies := []string{
+		`{"namespace":"dev","pod_name":"a"}`,
+		`{"Namespace":"dev","pod_name":"a"}`,
+		`{"NAMESPACE":"dev","pod_name":"a"}`,
+		`{"namespace":"kube-system","namespace":"dev"}`,
+		`{"nameſpace":"dev"}`,
+	}
+	for _, body := range bodies {
+		c := newJSONContext(http.MethodDelete, body)
+		params, err := requestParams(c)
+		if err != nil {
+			t.Fatalf("%s：解析参数失败，%v", body, err)
+		}
+		bound := new(struct {
+			Namespace string `json:"namespace"`
+		})
+		if err = c.ShouldBindJSON(bound); err != nil {
+			t.Fatalf("%s：绑定参数失败，%v", body, err)
+		}
+		if params["namespace"] != bound.Namespace {
+			t.Errorf("%s：鉴权的namespace为%q，controller使用的namespace为%q", body, params["namespace"], bound.Namespace)
+		}
+	}
+}
+
+//忽略大小写后重复的key，以及controller能绑定但不是单个json对象的body，都直接拒绝
+func TestRequestParamsRejectsAmbiguousBody(t *testing.T) {
+	bodies := []string{
+		`{"namespace":"dev","Namespace":"kube-system","pod_name":"a"}`,
+		`{"Namespace":"dev","namespace":"kube-system"}`,
+		`{"namespace":"dev","NAMESPACE":"kube-system"}`,
+		`{"cluster":"default","Cluster":"prod","namespace":"dev"}`,
+		`{"namespace":"dev","nameſpace":"kube-system"}`,
+		`{"namespace":"dev","cluster":"prod"} {}`,
+		`{"namespace":"dev"`,
+	}
+	for _, body := range bodies {
+		if _, err := requestParams(newJSONContext(http.MethodPost, body)); err == nil {
+			t.Errorf("%s：应该被拒绝", body)
+		}
+	}
+}
+
+func TestRequestParamsQuery(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/k8s/pods?cluster=prod&namespace=dev", nil)
+	params, err := requestParams(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params["cluster"] != "prod" || params["namespace"] != "dev" {
+		t.Fatalf("query参数解析错误，%v", params)
+	}
+}
+
+//workflow接口按id从数据库获取cluster和namespace，鉴权的id必须与controller绑定的id一致
+func TestBuildPermissionWorkflowId(t *testing.T) {
+	setupTestDB(t)
+	workflow := &model.Workflow{Name: "app", Cluster: "prod", Namespace: "team-a"}
+	if err := dao.Workflow.Add(workflow); err != nil {
+		t.Fatal(err)
+	}
+	route := routePermissions["DELETE /api/k8s/workflow/del"]
+
+	c := newJSONContext(http.MethodDelete, fmt.Sprintf(`{"id":%d}`, workflow.ID))
+	perm, err := buildPermission(c, route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm.Cluster != "prod" || perm.Namespace != "team-a" {
+		t.Fatalf("鉴权对象错误，%+v", perm)
+	}
+	//1000000之前会被格式化为1e+06，再被解析为1，使用workflow 1的namespace鉴权
+	c = newJSONContext(http.MethodDelete, `{"id":1000000}`)
+	if _, err = buildPermission(c, route); !errors.Is(err, errWorkflowNotFound) {
+		t.Fatalf("不存在的workflow应该返回errWorkflowNotFound，%v", err)
+	}
+	//controller无法绑定到int的数字直接拒绝
+	for _, body := range []string{`{"id":1e6}`, `{"id":1.5}`, `{"id":"1abc"}`, `{"id":"1e+06"}`} {
+		c = newJSONContext(http.MethodDelete, body)
+		if _, err = buildPermission(c, route); err == nil || errors.Is(err, errWorkflowNotFound) {
+			t.Errorf("%s: 应该返回参数错误，%v", body, err)
+		}
+	}
+	//大整数保留原文，不丢失精度
+	c = newJSONContext(http.MethodDelete, `{"replicas":9007199254740993}`)
+	params, err := requestParams(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params["replicas"] != "9007199254740993" {
+		t.Fatalf("数字参数解析错误，%s", params["replicas"])
+	}
+}
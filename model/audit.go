@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+//定义Audit结构体，记录每一次变更类接口调用和终端会话
+//BodyDigest为请求body的sha256摘要，不保存body原文，避免secret等敏感内容入库
+//Command为执行命令接口的命令参数，json数组格式，与BodyDigest不同，命令原文需要入库用于追溯
+//Latency为接口耗时，终端会话为会话时长，单位毫秒
+type Audit struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt *time.Time `json:"created_at"`
+
+	Username   string `json:"username"`
+	IP         string `json:"ip"`
+	Cluster    string `json:"cluster"`
+	Namespace  string `json:"namespace"`
+	Resource   string `json:"resource"`
+	Name       string `json:"name"`
+	Verb       string `json:"verb"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	BodyDigest string `json:"body_digest"`
+	Command    string `json:"command" gorm:"type:text"`
+	Status     int    `json:"status"`
+	Result     string `json:"result"`
+	Message    string `json:"message" gorm:"type:text"`
+	Latency    int64  `json:"latency"`
+}
+
+func (*Audit) TableName() string {
+	return "audit"
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+//定义Cluster结构体，用于保存通过接口添加的集群
+//Kubeconfig字段保存的是加密后的kubeconfig内容，不返回给前端，Name有唯一索引
+type Cluster struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+
+	Name       string `json:"name" gorm:"size:128;uniqueIndex"`
+	Host       string `json:"host"`
+	Kubeconfig string `json:"-" gorm:"type:text"`
+}
+
+func (*Cluster) TableName() string {
+	return "cluster"
+}
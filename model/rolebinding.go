@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+//定义RoleBinding结构体，将用户在某个集群、某个namespace下绑定为某个角色
+//Cluster为空表示所有集群，Namespace为空表示集群内所有namespace
+//Source为空表示手动创建，否则为登录时根据外部身份源的用户组同步生成，每次登录都会重新同步
+type RoleBinding struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Source    string `json:"source"`
+}
+
+func (*RoleBinding) TableName() string {
+	return "role_binding"
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+//定义TerminalRecord结构体，记录终端会话录像的索引，录像内容以asciicast v2格式保存在文件中
+//File为录像文件相对config.TerminalRecordDir的路径，不返回给前端
+//Duration为会话时长，单位毫秒，Size为录像文件大小，单位字节，会话结束时更新
+type TerminalRecord struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt *time.Time `json:"created_at"`
+
+	Username  string `json:"username"`
+	IP        string `json:"ip"`
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Command   string `json:"command"`
+	File      string `json:"-"`
+	Duration  int64  `json:"duration"`
+	Size      int64  `json:"size"`
+}
+
+func (*TerminalRecord) TableName() string {
+	return "terminal_record"
+}
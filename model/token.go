@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+//定义TokenBlacklist结构体，保存已注销的token唯一标识(jti)
+//ExpiresAt为token原本的过期时间，过期后的记录可以清理
+//Jti为唯一索引，同一个refresh token并发刷新时只有一个请求能写入
+type TokenBlacklist struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt *time.Time `json:"created_at"`
+
+	Jti       string     `json:"jti" gorm:"size:64;uniqueIndex"`
+	Username  string     `json:"username"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (*TokenBlacklist) TableName() string {
+	return "token_blacklist"
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+//定义User结构体，Password保存的是bcrypt哈希后的密码，不返回给前端
+//Source为用户来源，local为本地用户，其他来源的用户在首次登录时自动创建，没有本地密码
+//Username为唯一索引，并发创建同名用户或外部用户并发首次登录时只有一个能写入
+//TokenVersion在禁用用户、重置或修改密码时加1，签发token时写入token，与用户当前版本不一致的token失效
+type User struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+
+	Username string `json:"username" gorm:"size:128;uniqueIndex"`
+	Password string `json:"-"`
+	Disabled bool   `json:"disabled"`
+	Source   string `json:"source" gorm:"default:local"`
+
+	TokenVersion int `json:"-" gorm:"not null;default:0"`
+}
+
+func (*User) TableName() string {
+	return "user"
+}
@@ -15,6 +15,7 @@ type Workflow struct {
 	DeletedAt *time.Time `json:"deleted_at"`
 
 	Name       string `json:"name"`
+	Cluster    string `json:"cluster"`
 	Namespace  string `json:"namespace"`
 	Replicas   int32  `json:"replicas"`
 	Deployment string `json:"deployment"`
@@ -22,9 +23,31 @@ type Workflow struct {
 	Ingress    string `json:"ingress"`
 	Type       string `json:"type" gorm:"column:type"`
 	//Type: clusterip nodeport ingrress
+	//Status为workflow的状态：succeeded、failed、delete_failed
+	Status string `json:"status"`
+	//Steps为创建、回滚、删除k8s资源的每一步的结果，只在详情中返回
+	Steps []*WorkflowStep `json:"steps,omitempty" gorm:"foreignKey:WorkflowID"`
 }
 
 //定义TableName方法，返回mysql表名，以此来定义mysql中的表名
 func (*Workflow) TableName() string {
 	return "workflow"
 }
+
+//定义WorkflowStep结构体，记录workflow创建、回滚、删除k8s资源的每一步
+//Action为create、rollback、delete，Kind为Deployment、Service、Ingress，Status为success、failed
+type WorkflowStep struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt  *time.Time `json:"created_at"`
+	WorkflowID uint       `json:"workflow_id"`
+
+	Action  string `json:"action"`
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message" gorm:"type:text"`
+}
+
+func (*WorkflowStep) TableName() string {
+	return "workflow_step"
+}
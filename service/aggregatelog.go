@@ -0,0 +1,404 @@
+package service
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"errors"
+	"io"
+	"k8s-platform/config"
+	"k8s-platform/dao"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wonderivan/logger"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+//AggregateLogQuery为聚合日志的查询参数
+//Kind为deployment、statefulset、daemonset或workflow，workflow通过WorkflowID指定，其他通过Name指定
+//ContainerName为空时使用每个pod的第一个容器，TailLines和SinceSeconds只对开始推送时已存在的pod生效
+type AggregateLogQuery struct {
+	Cluster       string `form:"cluster"`
+	Namespace     string `form:"namespace"`
+	Kind          string `form:"kind"`
+	Name          string `form:"name"`
+	WorkflowID    int    `form:"workflow_id"`
+	ContainerName string `form:"container_name"`
+	Follow        bool   `form:"follow"`
+	SinceSeconds  *int64 `form:"since_seconds"`
+	Timestamps    bool   `form:"timestamps"`
+	TailLines     *int64 `form:"tail_lines"`
+}
+
+const (
+	//各pod的日志到达时间不同，日志在合并窗口内按时间戳排序后再推送
+	podLogMergeWindow = time.Second
+	//follow模式下重新查询pod列表的间隔，用于发现滚动更新中新建的pod
+	podLogResyncInterval = 3 * time.Second
+)
+
+//单行日志，time为apiserver返回的时间戳
+type aggregateLogLine struct {
+	time    time.Time
+	arrived time.Time
+	pod     string
+	text    string
+}
+
+//按时间戳排序的最小堆
+type aggregateLogHeap []*aggregateLogLine
+
+func (h aggregateLogHeap) Len() int            { return len(h) }
+func (h aggregateLogHeap) Less(i, j int) bool  { return h[i].time.Before(h[j].time) }
+func (h aggregateLogHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *aggregateLogHeap) Push(x interface{}) { *h = append(*h, x.(*aggregateLogLine)) }
+func (h *aggregateLogHeap) Pop() interface{} {
+	old := *h
+	line := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return line
+}
+
+//单个pod的日志流状态，lastTime用于日志流中断后从断点继续，避免重复推送
+type aggregatePodStream struct {
+	running  bool
+	lastTime time.Time
+}
+
+//logAggregator合并多个pod的日志
+type logAggregator struct {
+	ctx       context.Context
+	client    *kubernetes.Clientset
+	query     *AggregateLogQuery
+	selector  labels.Selector
+	lines     chan *aggregateLogLine
+	wg        sync.WaitGroup
+	lock      sync.Mutex
+	streams   map[string]*aggregatePodStream
+	truncated bool
+}
+
+//解析资源的selector，workflow使用其对应的deployment
+func (q *AggregateLogQuery) resolveSelector(client *kubernetes.Clientset) (selector labels.Selector, err error) {
+	if q.Namespace == "" {
+		return nil, errors.New("namespace不能为空")
+	}
+	var labelSelector *metav1.LabelSelector
+	switch q.Kind {
+	case "deployment":
+		deployment, err := Deployment.get(client, q.Name, q.Namespace)
+		if err != nil {
+			return nil, errors.New("获取Deployment失败，" + err.Error())
+		}
+		labelSelector = deployment.Spec.Selector
+	case "statefulset":
+		statefulSet, err := StatefulSet.get(client, q.Name, q.Namespace)
+		if err != nil {
+			return nil, errors.New("获取StatefulSet失败，" + err.Error())
+		}
+		labelSelector = statefulSet.Spec.Selector
+	case "daemonset":
+		daemonSet, err := DaemonSet.get(client, q.Name, q.Namespace)
+		if err != nil {
+			return nil, errors.New("获取DaemonSet失败，" + err.Error())
+		}
+		labelSelector = daemonSet.Spec.Selector
+	case "workflow":
+		workflow, err := dao.Workflow.GetById(q.WorkflowID)
+		if err != nil {
+			return nil, err
+		}
+		if workflow.ID == 0 {
+			return nil, errors.New("workflow不存在")
+		}
+		//鉴权使用的是请求中的cluster和namespace，必须与workflow一致
+		if workflow.Cluster != K8s.clusterName(q.Cluster) || workflow.Namespace != q.Namespace {
+			return nil, errors.New("workflow不在指定的cluster和namespace中")
+		}
+		deployment, err := Deployment.get(client, workflow.Deployment, workflow.Namespace)
+		if err != nil {
+			return nil, errors.New("获取Deployment失败，" + err.Error())
+		}
+		labelSelector = deployment.Spec.Selector
+	default:
+		return nil, errors.New("kind只能为deployment、statefulset、daemonset或workflow")
+	}
+	selector, err = metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return nil, errors.New("解析selector失败，" + err.Error())
+	}
+	//空的selector会匹配namespace下所有pod
+	if selector.Empty() {
+		return nil, errors.New("资源的selector为空")
+	}
+	return selector, nil
+}
+
+//StreamAggregateLog合并推送deployment、statefulset、daemonset或workflow下所有pod的日志
+//每行日志以[pod名]开头，按时间戳交错排列，follow模式下滚动更新中新建的pod会自动加入
+func (p *pod) StreamAggregateLog(w http.ResponseWriter, r *http.Request, client *kubernetes.Clientset, query *AggregateLogQuery) error {
+	if query.SinceSeconds != nil && *query.SinceSeconds <= 0 {
+		return errors.New("since_seconds必须大于0")
+	}
+	selector, err := query.resolveSelector(client)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	a := &logAggregator{
+		ctx:      ctx,
+		client:   client,
+		query:    query,
+		selector: selector,
+		lines:    make(chan *aggregateLogLine, 1024),
+		streams:  map[string]*aggregatePodStream{},
+	}
+	pods, err := a.listPods()
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return errors.New("没有匹配的pod")
+	}
+	sink, err := newPodLogSink(w, r, ctx, cancel)
+	if err != nil {
+		return err
+	}
+	defer sink.close()
+
+	a.start(pods, true)
+	if query.Follow {
+		go podLogKeepalive(ctx, cancel, sink)
+		go a.resync()
+	} else {
+		//不follow时所有pod的日志读完后结束
+		go func() {
+			a.wg.Wait()
+			close(a.lines)
+		}()
+	}
+
+	pending := &aggregateLogHeap{}
+	ticker := time.NewTicker(podLogMergeWindow / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case line, ok := <-a.lines:
+			if !ok {
+				if err = a.flush(sink, pending, true); err == nil {
+					sink.end()
+				}
+				return nil
+			}
+			heap.Push(pending, line)
+		case <-ticker.C:
+			if err = a.flush(sink, pending, false); err != nil {
+				logger.Warn("推送聚合日志失败，" + err.Error())
+				return nil
+			}
+		}
+	}
+}
+
+//推送合并窗口之外的日志，all为true时推送全部
+//每次从堆顶取时间戳最小的日志，堆顶的日志还在窗口内时停止，等待其他pod更早的日志
+func (a *logAggregator) flush(sink podLogSink, pending *aggregateLogHeap, all bool) error {
+	deadline := time.Now().Add(-podLogMergeWindow)
+	var b strings.Builder
+	for pending.Len() > 0 {
+		line := (*pending)[0]
+		if !all && line.arrived.After(deadline) {
+			break
+		}
+		heap.Pop(pending)
+		b.WriteString("[" + line.pod + "] ")
+		if a.query.Timestamps {
+			b.WriteString(line.time.Format(time.RFC3339Nano) + " ")
+		}
+		b.WriteString(line.text)
+		if b.Len() >= podLogChunkSize {
+			if err := sink.send([]byte(b.String())); err != nil {
+				return err
+			}
+			b.Reset()
+		}
+	}
+	if b.Len() > 0 {
+		return sink.send([]byte(b.String()))
+	}
+	return nil
+}
+
+//获取selector匹配的pod，按名称排序
+func (a *logAggregator) listPods() (pods []corev1.Pod, err error) {
+	podList, err := Pod.list(a.client, a.query.Namespace)
+	if err != nil {
+		return nil, errors.New("获取Pod列表失败，" + err.Error())
+	}
+	for _, pod := range podList.Items {
+		if a.selector.Matches(labels.Set(pod.Labels)) {
+			pods = append(pods, pod)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+	return pods, nil
+}
+
+//定时重新查询pod列表，为新建的pod和日志流中断但仍在运行的pod启动日志流
+func (a *logAggregator) resync() {
+	ticker := time.NewTicker(podLogResyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			pods, err := a.listPods()
+			if err != nil {
+				logger.Warn(err.Error())
+				continue
+			}
+			a.start(pods, false)
+		}
+	}
+}
+
+//为没有日志流的pod启动日志流，initial为true时表示开始推送时已存在的pod
+//同时推送的pod超过config.PodLogAggregateMaxPods时不再启动新的日志流
+func (a *logAggregator) start(pods []corev1.Pod, initial bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	running := 0
+	for _, stream := range a.streams {
+		if stream.running {
+			running++
+		}
+	}
+	for _, pod := range pods {
+		stream, ok := a.streams[pod.Name]
+		if ok && stream.running {
+			continue
+		}
+		if running >= config.PodLogAggregateMaxPods {
+			if !a.truncated {
+				logger.Warn("聚合日志匹配的pod超过%d个，超出的pod不推送", config.PodLogAggregateMaxPods)
+				a.truncated = true
+			}
+			return
+		}
+		//容器还未启动的pod等待下一次查询
+		if pod.Status.Phase == corev1.PodPending {
+			continue
+		}
+		option := &corev1.PodLogOptions{
+			Container:  a.query.ContainerName,
+			Follow:     a.query.Follow,
+			Timestamps: true,
+		}
+		if option.Container == "" && len(pod.Spec.Containers) > 0 {
+			option.Container = pod.Spec.Containers[0].Name
+		}
+		switch {
+		case ok:
+			//日志流中断后只在pod仍在运行时从断点继续
+			if pod.Status.Phase != corev1.PodRunning {
+				continue
+			}
+			option.SinceTime = &metav1.Time{Time: stream.lastTime}
+		case initial:
+			option.SinceSeconds = a.query.SinceSeconds
+			tailLines := int64(config.PodLogTailLine)
+			if a.query.TailLines != nil {
+				tailLines = *a.query.TailLines
+			}
+			if tailLines >= 0 {
+				option.TailLines = &tailLines
+			}
+		}
+		//推送过程中新建的pod不限制行数，推送全部日志
+		if !ok {
+			stream = &aggregatePodStream{}
+		}
+		stream.running = true
+		a.streams[pod.Name] = stream
+		running++
+		a.wg.Add(1)
+		go a.read(pod.Name, stream, option)
+	}
+}
+
+//读取单个pod的日志，解析时间戳后发送给合并协程
+func (a *logAggregator) read(podName string, stream *aggregatePodStream, option *corev1.PodLogOptions) {
+	defer a.wg.Done()
+	defer func() {
+		a.lock.Lock()
+		stream.running = false
+		a.lock.Unlock()
+	}()
+	a.lock.Lock()
+	lastTime := stream.lastTime
+	a.lock.Unlock()
+	body, err := a.client.CoreV1().Pods(a.query.Namespace).GetLogs(podName, option).Stream(a.ctx)
+	if err != nil {
+		if a.ctx.Err() == nil {
+			logger.Warn("获取Pod %s日志失败，%s", podName, err.Error())
+		}
+		return
+	}
+	defer body.Close()
+	reader := bufio.NewReader(body)
+	for {
+		text, err := reader.ReadString('\n')
+		if text != "" {
+			line := &aggregateLogLine{arrived: time.Now(), pod: podName, text: text}
+			//日志格式为"<RFC3339Nano时间戳> <内容>"
+			if i := strings.IndexByte(text, ' '); i > 0 {
+				if t, parseErr := time.Parse(time.RFC3339Nano, text[:i]); parseErr == nil {
+					line.time = t
+					line.text = text[i+1:]
+				}
+			}
+			if line.time.IsZero() {
+				line.time = line.arrived
+			}
+			if !strings.HasSuffix(line.text, "\n") {
+				line.text += "\n"
+			}
+			//SinceTime只精确到秒，跳过断点之前已推送的日志
+			if !line.time.After(lastTime) {
+				continue
+			}
+			lastTime = line.time
+			a.lock.Lock()
+			stream.lastTime = lastTime
+			a.lock.Unlock()
+			//合并协程处理不过来时阻塞读取，与单个pod的流式日志一样由客户端的消费速度限流
+			select {
+			case a.lines <- line:
+			case <-a.ctx.Done():
+				return
+			}
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			if a.ctx.Err() == nil {
+				logger.Warn("读取Pod %s日志失败，%s", podName, err.Error())
+			}
+			return
+		}
+	}
+}
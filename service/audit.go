@@ -0,0 +1,65 @@
+package service
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"k8s-platform/dao"
+	"k8s-platform/model"
+	"strconv"
+	"time"
+)
+
+var Audit audit
+
+type audit struct{}
+
+//审计结果
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+//导出csv的表头，与model.Audit的字段一一对应
+var auditCSVHeader = []string{"id", "time", "username", "ip", "cluster", "namespace", "resource", "name",
+	"verb", "method", "path", "body_digest", "command", "status", "result", "message", "latency_ms"}
+
+//记录审计日志，写入失败只记录错误日志，不影响接口本身的返回
+func (a *audit) Record(record *model.Audit) {
+	if record.Result == "" {
+		record.Result = AuditSuccess
+		if record.Status >= 400 {
+			record.Result = AuditFailure
+		}
+	}
+	dao.Audit.Add(record)
+}
+
+//获取审计日志列表，支持过滤、分页
+func (a *audit) GetAudits(filter *dao.AuditFilter, page, limit int) (data *dao.AuditResp, err error) {
+	return dao.Audit.GetList(filter, page, limit)
+}
+
+//按条件导出审计日志为csv
+func (a *audit) Export(filter *dao.AuditFilter, w io.Writer) (err error) {
+	writer := csv.NewWriter(w)
+	if err = writer.Write(auditCSVHeader); err != nil {
+		return err
+	}
+	err = dao.Audit.Each(filter, func(item *model.Audit) error {
+		createdAt := ""
+		if item.CreatedAt != nil {
+			createdAt = item.CreatedAt.Format(time.RFC3339)
+		}
+		return writer.Write([]string{
+			fmt.Sprint(item.ID), createdAt, item.Username, item.IP, item.Cluster, item.Namespace,
+			item.Resource, item.Name, item.Verb, item.Method, item.Path, item.BodyDigest, item.Command,
+			strconv.Itoa(item.Status), item.Result, item.Message, strconv.FormatInt(item.Latency, 10),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"k8s-platform/config"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wonderivan/logger"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+//clusterCache保存单个集群的informer，列表和详情接口从watch维护的本地缓存中读取，不再每次请求apiserver
+//每种资源的informer单独判断是否同步完成，未同步完成的资源直接请求apiserver
+//syncDone表示同步等待已结束（全部同步完成或超过config.CacheSyncTimeout），之后集群缓存不再影响就绪检查
+type clusterCache struct {
+	client    *kubernetes.Clientset
+	informers map[string]cache.SharedIndexInformer
+	stopCh    chan struct{}
+
+	lock        sync.RWMutex
+	syncDone    bool
+	syncedAt    time.Time
+	lastEventAt time.Time
+	watchError  string
+}
+
+//CacheStatus为集群缓存的状态，用于判断返回数据的新鲜程度
+//Synced表示所有资源都已同步完成，UnsyncedResources为未同步完成、直接请求apiserver的资源
+//Ready表示同步等待已结束，没有权限list的资源等同步不了的资源不会一直影响就绪检查
+//LastEventAt为最近一次收到watch事件的时间，WatchError为最近一次watch失败的原因，watch恢复后清空
+type CacheStatus struct {
+	Cluster           string     `json:"cluster"`
+	Ready             bool       `json:"ready"`
+	Synced            bool       `json:"synced"`
+	UnsyncedResources []string   `json:"unsynced_resources"`
+	SyncedAt          *time.Time `json:"synced_at"`
+	LastEventAt       *time.Time `json:"last_event_at"`
+	WatchError        string     `json:"watch_error"`
+}
+
+//缓存的资源，key为资源名，与apiserver的resource一致
+var cacheResources = map[string]schema.GroupVersionResource{
+	"pods":                   {Version: "v1", Resource: "pods"},
+	"deployments":            {Group: "apps", Version: "v1", Resource: "deployments"},
+	"daemonsets":             {Group: "apps", Version: "v1", Resource: "daemonsets"},
+	"statefulsets":           {Group: "apps", Version: "v1", Resource: "statefulsets"},
+	"services":               {Version: "v1", Resource: "services"},
+	"ingresses":              {Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+	"configmaps":             {Version: "v1", Resource: "configmaps"},
+	"secrets":                {Version: "v1", Resource: "secrets"},
+	"persistentvolumeclaims": {Version: "v1", Resource: "persistentvolumeclaims"},
+	"persistentvolumes":      {Version: "v1", Resource: "persistentvolumes"},
+	"nodes":                  {Version: "v1", Resource: "nodes"},
+	"namespaces":             {Version: "v1", Resource: "namespaces"},
+}
+
+//创建集群缓存并在后台启动informer，每种资源同步完成后即可从缓存读取
+func newClusterCache(cluster string, client *kubernetes.Clientset) *clusterCache {
+	c := &clusterCache{
+		client:    client,
+		informers: map[string]cache.SharedIndexInformer{},
+		stopCh:    make(chan struct{}),
+	}
+	//不需要定期resync，数据的更新完全依赖watch事件
+	factory := informers.NewSharedInformerFactory(client, 0)
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { c.touch() },
+		UpdateFunc: func(interface{}, interface{}) { c.touch() },
+		DeleteFunc: func(interface{}) { c.touch() },
+	}
+	for resource, gvr := range cacheResources {
+		resource := resource
+		genericInformer, err := factory.ForResource(gvr)
+		if err != nil {
+			logger.Error("创建集群%s的%s informer失败，%s", cluster, resource, err.Error())
+			continue
+		}
+		informer := genericInformer.Informer()
+		informer.AddEventHandler(handler)
+		informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+			cache.DefaultWatchErrorHandler(r, err)
+			c.lock.Lock()
+			c.watchError = resource + ": " + err.Error()
+			c.lock.Unlock()
+		})
+		c.informers[resource] = informer
+	}
+	factory.Start(c.stopCh)
+	go c.waitForSync(cluster)
+	return c
+}
+
+//等待所有informer同步完成，超过config.CacheSyncTimeout时结束等待，未同步的资源继续在后台重试
+func (c *clusterCache) waitForSync(cluster string) {
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for _, informer := range c.informers {
+			wg.Add(1)
+			go func(informer cache.SharedIndexInformer) {
+				defer wg.Done()
+				cache.WaitForCacheSync(c.stopCh, informer.HasSynced)
+			}(informer)
+		}
+		wg.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(config.CacheSyncTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		logger.Warn("集群%s缓存同步超时，以下资源直接请求apiserver：%s", cluster, c.unsynced())
+		c.lock.Lock()
+		c.syncDone = true
+		c.lock.Unlock()
+		<-done
+	}
+	//informer被停止时done也会关闭
+	select {
+	case <-c.stopCh:
+		return
+	default:
+	}
+	now := time.Now()
+	c.lock.Lock()
+	c.syncDone = true
+	c.syncedAt = now
+	c.lock.Unlock()
+	logger.Info("集群%s缓存同步完成，耗时%s", cluster, now.Sub(start))
+}
+
+//获取未同步完成的资源
+func (c *clusterCache) unsynced() (resources []string) {
+	for resource, informer := range c.informers {
+		if !informer.HasSynced() {
+			resources = append(resources, resource)
+		}
+	}
+	sort.Strings(resources)
+	return resources
+}
+
+//获取已同步完成的informer，未同步完成时返回false，调用方需要直接请求apiserver
+func (c *clusterCache) informer(resource string) (informer cache.SharedIndexInformer, ok bool) {
+	informer, ok = c.informers[resource]
+	if !ok || !informer.HasSynced() {
+		return nil, false
+	}
+	return informer, true
+}
+
+//收到watch事件说明与apiserver的连接正常，更新事件时间并清空watch错误
+func (c *clusterCache) touch() {
+	c.lock.Lock()
+	c.lastEventAt = time.Now()
+	c.watchError = ""
+	c.lock.Unlock()
+}
+
+func (c *clusterCache) stop() {
+	close(c.stopCh)
+}
+
+func (c *clusterCache) status(cluster string) *CacheStatus {
+	unsynced := c.unsynced()
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	status := &CacheStatus{
+		Cluster:           cluster,
+		Ready:             c.syncDone,
+		Synced:            len(unsynced) == 0,
+		UnsyncedResources: unsynced,
+		WatchError:        c.watchError,
+	}
+	if status.Synced && !c.syncedAt.IsZero() {
+		syncedAt := c.syncedAt
+		status.SyncedAt = &syncedAt
+	}
+	if !c.lastEventAt.IsZero() {
+		lastEventAt := c.lastEventAt
+		status.LastEventAt = &lastEventAt
+	}
+	return status
+}
+
+//根据clientSet获取集群缓存，不存在时返回nil
+func (k *k8s) getCache(client *kubernetes.Clientset) *clusterCache {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	for _, c := range k.CacheMap {
+		if c.client == client {
+			return c
+		}
+	}
+	return nil
+}
+
+//从缓存中获取资源列表，namespace为空时获取所有namespace
+//ok为false表示缓存不可用，调用方需要直接请求apiserver
+func (k *k8s) CacheList(client *kubernetes.Clientset, resource, namespace string) (objs []interface{}, ok bool) {
+	c := k.getCache(client)
+	if c == nil {
+		return nil, false
+	}
+	informer, ok := c.informer(resource)
+	if !ok {
+		return nil, false
+	}
+	indexer := informer.GetIndexer()
+	if namespace == "" {
+		return indexer.List(), true
+	}
+	objs, err := indexer.ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		logger.Error("从缓存获取%s列表失败，%s", resource, err.Error())
+		return nil, false
+	}
+	return objs, true
+}
+
+//从缓存中获取单个资源，集群级别的资源namespace传空
+//ok为false表示缓存不可用，资源不存在时返回与apiserver一致的NotFound错误
+func (k *k8s) CacheGet(client *kubernetes.Clientset, resource, namespace, name string) (obj interface{}, ok bool, err error) {
+	c := k.getCache(client)
+	if c == nil {
+		return nil, false, nil
+	}
+	informer, ok := c.informer(resource)
+	if !ok {
+		return nil, false, nil
+	}
+	key := name
+	if namespace != "" {
+		key = namespace + "/" + name
+	}
+	obj, exists, err := informer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return nil, false, nil
+	}
+	if !exists {
+		return nil, true, apierrors.NewNotFound(schema.GroupResource{Resource: resource}, name)
+	}
+	return obj, true, nil
+}
+
+//获取集群缓存状态，集群名为空时使用默认集群
+func (k *k8s) GetCacheStatus(cluster string) *CacheStatus {
+	cluster = k.clusterName(cluster)
+	k.lock.RLock()
+	c, ok := k.CacheMap[cluster]
+	k.lock.RUnlock()
+	if !ok {
+		return &CacheStatus{Cluster: cluster}
+	}
+	return c.status(cluster)
+}
+
+//所有集群的缓存都结束同步等待后就绪，同步超时的资源直接请求apiserver，不会一直阻塞就绪
+func (k *k8s) Ready() (ready bool, statuses []*CacheStatus) {
+	ready = true
+	for _, cluster := range k.GetClusterNames() {
+		status := k.GetCacheStatus(cluster)
+		if !status.Ready {
+			ready = false
+		}
+		statuses = append(statuses, status)
+	}
+	return ready, statuses
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"encoding/json"
+	"k8s-platform/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+//模拟的apiserver，没有权限list secret，集群中没有networking.k8s.io/v1，其他资源返回空列表
+func newCacheTestServer(t *testing.T) *httptest.Server {
+	kinds := map[string]string{
+		"pods": "PodList", "services": "ServiceList", "configmaps": "ConfigMapList",
+		"persistentvolumeclaims": "PersistentVolumeClaimList", "persistentvolumes": "PersistentVolumeList",
+		"nodes": "NodeList", "namespaces": "NamespaceList",
+		"deployments": "DeploymentList", "daemonsets": "DaemonSetList", "statefulsets": "StatefulSetList",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		parts := strings.Split(r.URL.Path, "/")
+		resource := parts[len(parts)-1]
+		switch {
+		case resource == "secrets":
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "Forbidden", "code": 403,
+			})
+		case strings.HasPrefix(r.URL.Path, "/apis/networking.k8s.io/"):
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "NotFound", "code": 404,
+			})
+		case r.URL.Query().Get("watch") == "true":
+			//watch请求保持连接直到客户端断开
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			apiVersion := "v1"
+			if strings.HasPrefix(r.URL.Path, "/apis/apps/") {
+				apiVersion = "apps/v1"
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"kind": kinds[resource], "apiVersion": apiVersion,
+				"metadata": map[string]string{"resourceVersion": "1"}, "items": []interface{}{},
+			})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+//部分资源无法同步时，同步超时后集群就绪，已同步的资源从缓存读取，其他资源直接请求apiserver
+func TestCachePartialSync(t *testing.T) {
+	srv := newCacheTestServer(t)
+	oldTimeout := config.CacheSyncTimeout
+	config.CacheSyncTimeout = time.Second
+	t.Cleanup(func() { config.CacheSyncTimeout = oldTimeout })
+	if err := K8s.Register("cache-test", &rest.Config{Host: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { K8s.Unregister("cache-test") })
+	client, err := K8s.GetClient("cache-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	var status *CacheStatus
+	for time.Now().Before(deadline) {
+		status = K8s.GetCacheStatus("cache-test")
+		if status.Ready {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if !status.Ready {
+		t.Fatal("同步超时后集群应该就绪")
+	}
+	if status.Synced || strings.Join(status.UnsyncedResources, ",") != "ingresses,secrets" {
+		t.Fatalf("未同步的资源不正确，%+v", status)
+	}
+	if ready, _ := K8s.Ready(); !ready {
+		t.Fatal("同步超时后就绪检查应该通过")
+	}
+	if _, ok := K8s.CacheList(client, "pods", ""); !ok {
+		t.Fatal("已同步的pods应该从缓存读取")
+	}
+	if _, ok, _ := K8s.CacheGet(client, "namespaces", "", "default"); !ok {
+		t.Fatal("已同步的namespaces应该从缓存读取")
+	}
+	for _, resource := range []string{"secrets", "ingresses"} {
+		if _, ok := K8s.CacheList(client, resource, "default"); ok {
+			t.Fatalf("未同步的%s应该直接请求apiserver", resource)
+		}
+		if _, ok, _ := K8s.CacheGet(client, resource, "default", "x"); ok {
+			t.Fatalf("未同步的%s应该直接请求apiserver", resource)
+		}
+	}
+}
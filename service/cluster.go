@@ -0,0 +1,217 @@
+package service
+
+import (
+	"errors"
+	"k8s-platform/dao"
+	"k8s-platform/model"
+	"k8s-platform/utils"
+	"sort"
+
+	"github.com/wonderivan/logger"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+var Cluster cluster
+
+type cluster struct{}
+
+//定义ClusterCreate结构体，用于添加集群，Kubeconfig为kubeconfig文件的内容
+type ClusterCreate struct {
+	Name       string `json:"name"`
+	Kubeconfig string `json:"kubeconfig"`
+}
+
+//定义ClusterInfo结构体，用于返回集群列表
+type ClusterInfo struct {
+	Name string `json:"name"`
+	Host string `json:"host"`
+}
+
+//定义ClusterTestResp结构体，用于返回集群连通性测试结果
+type ClusterTestResp struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Platform   string `json:"platform"`
+	GitVersion string `json:"git_version"`
+}
+
+//获取集群列表
+func (c *cluster) GetClusters() (clusters []*ClusterInfo) {
+	names := K8s.GetClusterNames()
+	sort.Strings(names)
+	for _, name := range names {
+		conf, err := K8s.GetConfig(name)
+		if err != nil {
+			continue
+		}
+		clusters = append(clusters, &ClusterInfo{
+			Name: name,
+			Host: conf.Host,
+		})
+	}
+	return clusters
+}
+
+//添加集群，kubeconfig加密后写入数据库，再注册到K8s中
+//先写入数据库，并发添加同名集群时由唯一索引保证只有一个能注册，注册失败时删除写入的数据
+func (c *cluster) AddCluster(data *ClusterCreate) (err error) {
+	if data.Name == "" || data.Kubeconfig == "" {
+		return errors.New("集群名和kubeconfig不能为空")
+	}
+	if _, err = K8s.GetClient(data.Name); err == nil {
+		return errors.New("集群" + data.Name + "已存在")
+	}
+	cluster, conf, err := c.encrypt(data)
+	if err != nil {
+		return err
+	}
+	if err = dao.Cluster.Add(cluster); err != nil {
+		return err
+	}
+	if err = K8s.Register(data.Name, conf); err != nil {
+		if delErr := dao.Cluster.DelByName(data.Name); delErr != nil {
+			return errors.New(err.Error() + "，" + delErr.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+//更新集群的kubeconfig，用于凭据轮换，注册失败时恢复数据库中原来的kubeconfig
+func (c *cluster) UpdateCluster(data *ClusterCreate) (err error) {
+	if data.Name == "" || data.Kubeconfig == "" {
+		return errors.New("集群名和kubeconfig不能为空")
+	}
+	old, err := dao.Cluster.GetByName(data.Name)
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		return errors.New("集群" + data.Name + "不存在或为配置文件中的集群，不支持更新")
+	}
+	cluster, conf, err := c.encrypt(data)
+	if err != nil {
+		return err
+	}
+	if err = dao.Cluster.Update(cluster); err != nil {
+		return err
+	}
+	if err = K8s.Register(data.Name, conf); err != nil {
+		if updateErr := dao.Cluster.Update(old); updateErr != nil {
+			return errors.New(err.Error() + "，" + updateErr.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+//校验kubeconfig内容并加密，返回待入库的数据和rest配置
+func (c *cluster) encrypt(data *ClusterCreate) (cluster *model.Cluster, conf *rest.Config, err error) {
+	//根据kubeconfig内容生成rest配置，确保入库的kubeconfig是可用的
+	conf, err = c.restConfig([]byte(data.Kubeconfig))
+	if err != nil {
+		logger.Error(errors.New("解析kubeconfig失败，" + err.Error()))
+		return nil, nil, errors.New("解析kubeconfig失败，" + err.Error())
+	}
+	ciphertext, err := utils.AESCrypto.Encrypt([]byte(data.Kubeconfig))
+	if err != nil {
+		logger.Error(errors.New("加密kubeconfig失败，" + err.Error()))
+		return nil, nil, errors.New("加密kubeconfig失败，" + err.Error())
+	}
+	return &model.Cluster{
+		Name:       data.Name,
+		Host:       conf.Host,
+		Kubeconfig: ciphertext,
+	}, conf, nil
+}
+
+//解密数据库中的kubeconfig并生成rest配置，只在构建client时调用
+func (c *cluster) decrypt(cluster *model.Cluster) (conf *rest.Config, err error) {
+	kubeconfig, err := utils.AESCrypto.Decrypt(cluster.Kubeconfig)
+	if err != nil {
+		return nil, errors.New("解密集群" + cluster.Name + "的kubeconfig失败，" + err.Error())
+	}
+	conf, err = c.restConfig(kubeconfig)
+	if err != nil {
+		return nil, errors.New("解析集群" + cluster.Name + "的kubeconfig失败，" + err.Error())
+	}
+	return conf, nil
+}
+
+//解析kubeconfig并生成rest配置
+//kubeconfig由接口上传，exec、auth-provider会在平台所在主机上执行命令，文件路径会读取平台所在主机上的文件，
+//所以只允许使用内联的证书和token
+func (c *cluster) restConfig(kubeconfig []byte) (conf *rest.Config, err error) {
+	apiConfig, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.checkInline(apiConfig); err != nil {
+		return nil, err
+	}
+	return clientcmd.NewDefaultClientConfig(*apiConfig, &clientcmd.ConfigOverrides{}).ClientConfig()
+}
+
+//检查kubeconfig中的凭据是否都是内联的
+func (c *cluster) checkInline(apiConfig *clientcmdapi.Config) error {
+	for name, authInfo := range apiConfig.AuthInfos {
+		switch {
+		case authInfo.Exec != nil:
+			return errors.New("用户" + name + "使用了exec，不支持")
+		case authInfo.AuthProvider != nil:
+			return errors.New("用户" + name + "使用了auth-provider，不支持")
+		case authInfo.ClientCertificate != "":
+			return errors.New("用户" + name + "使用了client-certificate文件，请使用client-certificate-data")
+		case authInfo.ClientKey != "":
+			return errors.New("用户" + name + "使用了client-key文件，请使用client-key-data")
+		case authInfo.TokenFile != "":
+			return errors.New("用户" + name + "使用了tokenFile，请使用token")
+		}
+	}
+	for name, cluster := range apiConfig.Clusters {
+		if cluster.CertificateAuthority != "" {
+			return errors.New("集群" + name + "使用了certificate-authority文件，请使用certificate-authority-data")
+		}
+	}
+	return nil
+}
+
+//测试集群连通性，返回apiserver版本信息
+func (c *cluster) TestCluster(name string) (resp *ClusterTestResp, err error) {
+	client, err := K8s.GetClient(name)
+	if err != nil {
+		return nil, err
+	}
+	version, err := client.Discovery().ServerVersion()
+	if err != nil {
+		logger.Error(errors.New("连接集群失败，" + err.Error()))
+		return nil, errors.New("连接集群失败，" + err.Error())
+	}
+	return &ClusterTestResp{
+		Name:       name,
+		Version:    version.Major + "." + version.Minor,
+		Platform:   version.Platform,
+		GitVersion: version.GitVersion,
+	}, nil
+}
+
+//删除集群
+func (c *cluster) DeleteCluster(name string) (err error) {
+	if name == "" {
+		return errors.New("集群名不能为空")
+	}
+	cluster, err := dao.Cluster.GetByName(name)
+	if err != nil {
+		return err
+	}
+	if cluster == nil {
+		return errors.New("集群" + name + "不存在或为配置文件中的集群，不支持删除")
+	}
+	if err = dao.Cluster.DelByName(name); err != nil {
+		return err
+	}
+	K8s.Unregister(name)
+	return nil
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"encoding/base64"
+	"k8s-platform/config"
+	"k8s-platform/dao"
+	"strings"
+	"testing"
+)
+
+const testKubeconfigHead = `apiVersion: v1
+kind: Config
+current-context: test
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+`
+
+func TestRestConfigInline(t *testing.T) {
+	kubeconfig := testKubeconfigHead + `    certificate-authority-data: ""
+users:
+- name: test
+  user:
+    token: abc
+`
+	conf, err := Cluster.restConfig([]byte(kubeconfig))
+	if err != nil {
+		t.Fatalf("内联kubeconfig解析失败，%v", err)
+	}
+	if conf.Host != "https://127.0.0.1:6443" || conf.BearerToken != "abc" {
+		t.Fatalf("rest配置不正确，%+v", conf)
+	}
+}
+
+func TestRestConfigRejectsHostAccess(t *testing.T) {
+	cases := map[string]string{
+		"exec": testKubeconfigHead + `users:
+- name: test
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: /bin/sh
+      args: ["-c", "id"]
+`,
+		"auth-provider": testKubeconfigHead + `users:
+- name: test
+  user:
+    auth-provider:
+      name: gcp
+`,
+		"client-certificate": testKubeconfigHead + `users:
+- name: test
+  user:
+    client-certificate: /etc/passwd
+`,
+		"client-key": testKubeconfigHead + `users:
+- name: test
+  user:
+    client-key: /etc/passwd
+`,
+		"tokenFile": testKubeconfigHead + `users:
+- name: test
+  user:
+    tokenFile: /etc/passwd
+`,
+		"certificate-authority": testKubeconfigHead + `    certificate-authority: /etc/passwd
+users:
+- name: test
+  user:
+    token: abc
+`,
+	}
+	for name, kubeconfig := range cases {
+		_, err := Cluster.restConfig([]byte(kubeconfig))
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s应该被拒绝，实际返回%v", name, err)
+		}
+	}
+}
+
+//注册失败时不能在数据库中留下集群，否则重启后会重复注册失败，接口也无法再次添加同名集群
+func TestAddClusterRegisterFailed(t *testing.T) {
+	setupTestDB(t)
+	config.EncryptKey = "0123456789abcdef0123456789abcdef"
+	t.Cleanup(func() { config.EncryptKey = "" })
+	//CA证书无法解析，生成rest配置成功，创建clientSet失败
+	kubeconfig := testKubeconfigHead + `    certificate-authority-data: ` + base64.StdEncoding.EncodeToString([]byte("not a certificate")) + `
+users:
+- name: test
+  user:
+    token: abc
+`
+	if err := Cluster.AddCluster(&ClusterCreate{Name: "cluster-test", Kubeconfig: kubeconfig}); err == nil {
+		t.Fatal("CA证书不合法时应该注册失败")
+	}
+	if cluster, err := dao.Cluster.GetByName("cluster-test"); err != nil || cluster != nil {
+		t.Fatalf("注册失败时应该删除数据库中的集群，%+v，%v", cluster, err)
+	}
+	if _, err := K8s.GetClient("cluster-test"); err == nil {
+		t.Fatal("注册失败的集群不应该可用")
+	}
+}
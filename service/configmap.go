@@ -8,6 +8,7 @@ import (
 	"github.com/wonderivan/logger"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 type configMap struct{}
@@ -15,8 +16,10 @@ type configMap struct{}
 var ConfigMap configMap
 
 type ConfigMapsResp struct {
-	Items []corev1.ConfigMap `json:"items"`
-	Total int                `json:"total"`
+	Items       []corev1.ConfigMap `json:"items"`
+	Total       int                `json:"total"`
+	Facets      []*NamespaceFacet  `json:"facets"`
+	SortColumns []string           `json:"sort_columns"`
 }
 
 func (c *configMap) toCells(std []corev1.ConfigMap) []DataCell {
@@ -37,9 +40,9 @@ func (c *configMap) fromCells(cells []DataCell) []corev1.ConfigMap {
 }
 
 // 获取configmap列表，支持过滤、排序、分页
-func (c *configMap) GetConfigMaps(filterName, namespace string, limit, page int) (configMapsResp *ConfigMapsResp, err error) {
+func (c *configMap) GetConfigMaps(client *kubernetes.Clientset, filter *FilterQuery, sort *SortQuery, namespace string, limit, page int) (configMapsResp *ConfigMapsResp, err error) {
 	//获取configMapList类型的configMap列表
-	configMapList, err := K8s.ClientSet.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{})
+	configMapList, err := c.list(client, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取ConfigMap列表失败，" + err.Error()))
 		return nil, errors.New("获取ConfigMap列表失败，" + err.Error())
@@ -48,7 +51,8 @@ func (c *configMap) GetConfigMaps(filterName, namespace string, limit, page int)
 	selectableData := &dataSelector{
 		GenericDataList: c.toCells(configMapList.Items),
 		dataSelectQuery: &DataSelectQuery{
-			FilterQuery: &FilterQuery{Name: filterName},
+			FilterQuery: filter,
+			SortQuery:   sort,
 			PaginateQuery: &PaginateQuery{
 				Limit: limit,
 				Page:  page,
@@ -57,18 +61,22 @@ func (c *configMap) GetConfigMaps(filterName, namespace string, limit, page int)
 	}
 	filtered := selectableData.Filter()
 	total := len(filtered.GenericDataList)
+	//统计每个namespace的数量，需要在分页之前
+	facets := filtered.Facets()
 	data := filtered.Sort().Paginate()
 	//将[]DataCell类型的configmap列表转为v1.configmap列表
 	configMaps := c.fromCells(data.GenericDataList)
 	return &ConfigMapsResp{
-		Items: configMaps,
-		Total: total,
+		Items:       configMaps,
+		Total:       total,
+		Facets:      facets,
+		SortColumns: ConfigMapSortColumns,
 	}, nil
 }
 
 // 获取configmap详情
-func (c *configMap) GetConfigMapDetail(configMapName, namespace string) (configMap *corev1.ConfigMap, err error) {
-	configMap, err = K8s.ClientSet.CoreV1().ConfigMaps(namespace).Get(context.TODO(), configMapName, metav1.GetOptions{})
+func (c *configMap) GetConfigMapDetail(client *kubernetes.Clientset, configMapName, namespace string) (configMap *corev1.ConfigMap, err error) {
+	configMap, err = c.get(client, configMapName, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取ConfigMap详情失败，" + err.Error()))
 		return nil, errors.New("获取ConfigMap详情失败，" + err.Error())
@@ -77,8 +85,8 @@ func (c *configMap) GetConfigMapDetail(configMapName, namespace string) (configM
 }
 
 // 删除configmap
-func (c *configMap) DeleteConfigMap(configMapName, namespace string) (err error) {
-	err = K8s.ClientSet.CoreV1().ConfigMaps(namespace).Delete(context.TODO(), configMapName, metav1.DeleteOptions{})
+func (c *configMap) DeleteConfigMap(client *kubernetes.Clientset, configMapName, namespace string) (err error) {
+	err = client.CoreV1().ConfigMaps(namespace).Delete(context.TODO(), configMapName, metav1.DeleteOptions{})
 	if err != nil {
 		logger.Error(errors.New("删除ConfigMap失败，" + err.Error()))
 		return errors.New("删除ConfigMap失败，" + err.Error())
@@ -87,17 +95,43 @@ func (c *configMap) DeleteConfigMap(configMapName, namespace string) (err error)
 }
 
 // 更新configMap
-func (c *configMap) UpdateConfigMap(namespace, content string) (err error) {
+func (c *configMap) UpdateConfigMap(client *kubernetes.Clientset, namespace, content string) (err error) {
 	var configMap = &corev1.ConfigMap{}
 	err = json.Unmarshal([]byte(content), configMap)
 	if err != nil {
 		logger.Error(errors.New("反序列化失败，" + err.Error()))
 		return errors.New("反序列化失败，" + err.Error())
 	}
-	_, err = K8s.ClientSet.CoreV1().ConfigMaps(namespace).Update(context.TODO(), configMap, metav1.UpdateOptions{})
+	_, err = client.CoreV1().ConfigMaps(namespace).Update(context.TODO(), configMap, metav1.UpdateOptions{})
 	if err != nil {
 		logger.Error(errors.New("更新ConfigMap失败，" + err.Error()))
 		return errors.New("更新ConfigMap失败，" + err.Error())
 	}
 	return nil
 }
+
+//获取configmap列表，缓存可用时从缓存中读取，否则请求apiserver
+func (c *configMap) list(client *kubernetes.Clientset, namespace string) (*corev1.ConfigMapList, error) {
+	objs, ok := K8s.CacheList(client, "configmaps", namespace)
+	if !ok {
+		return client.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{})
+	}
+	list := &corev1.ConfigMapList{Items: make([]corev1.ConfigMap, len(objs))}
+	for i, obj := range objs {
+		list.Items[i] = *obj.(*corev1.ConfigMap)
+	}
+	return list, nil
+}
+
+//获取单个configmap，缓存可用时从缓存中读取，否则请求apiserver
+func (c *configMap) get(client *kubernetes.Clientset, name, namespace string) (*corev1.ConfigMap, error) {
+	obj, ok, err := K8s.CacheGet(client, "configmaps", namespace, name)
+	if !ok {
+		return client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	//缓存中的对象是共享的，返回副本避免被修改
+	return obj.(*corev1.ConfigMap).DeepCopy(), nil
+}
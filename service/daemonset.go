@@ -8,6 +8,7 @@ import (
 	"github.com/wonderivan/logger"
 	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 var DaemonSet daemonSet
@@ -15,14 +16,16 @@ var DaemonSet daemonSet
 type daemonSet struct{}
 
 type DaemonSetsResp struct {
-	Items []appsv1.DaemonSet `json:"items"`
-	Total int                `json:"total"`
+	Items       []appsv1.DaemonSet `json:"items"`
+	Total       int                `json:"total"`
+	Facets      []*NamespaceFacet  `json:"facets"`
+	SortColumns []string           `json:"sort_columns"`
 }
 
 //获取daemonset列表，支持过滤、排序、分页
-func (d *daemonSet) GetDaemonSets(filterName, namespace string, limit, page int) (daemonSetsResp *DaemonSetsResp, err error) {
+func (d *daemonSet) GetDaemonSets(client *kubernetes.Clientset, filter *FilterQuery, sort *SortQuery, namespace string, limit, page int) (daemonSetsResp *DaemonSetsResp, err error) {
 	//获取daemonSetList类型的daemonSet列表
-	daemonSetList, err := K8s.ClientSet.AppsV1().DaemonSets(namespace).List(context.TODO(), metav1.ListOptions{})
+	daemonSetList, err := d.list(client, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取DaemonSet列表失败, " + err.Error()))
 		return nil, errors.New("获取DaemonSet列表失败, " + err.Error())
@@ -31,7 +34,8 @@ func (d *daemonSet) GetDaemonSets(filterName, namespace string, limit, page int)
 	selectableData := &dataSelector{
 		GenericDataList: d.toCells(daemonSetList.Items),
 		dataSelectQuery: &DataSelectQuery{
-			FilterQuery: &FilterQuery{Name: filterName},
+			FilterQuery: filter,
+			SortQuery:   sort,
 			PaginateQuery: &PaginateQuery{
 				Limit: limit,
 				Page:  page,
@@ -41,20 +45,24 @@ func (d *daemonSet) GetDaemonSets(filterName, namespace string, limit, page int)
 
 	filtered := selectableData.Filter()
 	total := len(filtered.GenericDataList)
+	//统计每个namespace的数量，需要在分页之前
+	facets := filtered.Facets()
 	data := filtered.Sort().Paginate()
 
 	//将[]DataCell类型的daemonset列表转为v1.daemonset列表
 	daemonSets := d.fromCells(data.GenericDataList)
 
 	return &DaemonSetsResp{
-		Items: daemonSets,
-		Total: total,
+		Items:       daemonSets,
+		Total:       total,
+		Facets:      facets,
+		SortColumns: DaemonSetSortColumns,
 	}, nil
 }
 
 //获取daemonset详情
-func (d *daemonSet) GetDaemonSetDetail(daemonSetName, namespace string) (daemonSet *appsv1.DaemonSet, err error) {
-	daemonSet, err = K8s.ClientSet.AppsV1().DaemonSets(namespace).Get(context.TODO(), daemonSetName, metav1.GetOptions{})
+func (d *daemonSet) GetDaemonSetDetail(client *kubernetes.Clientset, daemonSetName, namespace string) (daemonSet *appsv1.DaemonSet, err error) {
+	daemonSet, err = d.get(client, daemonSetName, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取DaemonSet详情失败, " + err.Error()))
 		return nil, errors.New("获取DaemonSet详情失败, " + err.Error())
@@ -64,8 +72,8 @@ func (d *daemonSet) GetDaemonSetDetail(daemonSetName, namespace string) (daemonS
 }
 
 //删除daemonset
-func (d *daemonSet) DeleteDaemonSet(daemonSetName, namespace string) (err error) {
-	err = K8s.ClientSet.AppsV1().DaemonSets(namespace).Delete(context.TODO(), daemonSetName, metav1.DeleteOptions{})
+func (d *daemonSet) DeleteDaemonSet(client *kubernetes.Clientset, daemonSetName, namespace string) (err error) {
+	err = client.AppsV1().DaemonSets(namespace).Delete(context.TODO(), daemonSetName, metav1.DeleteOptions{})
 	if err != nil {
 		logger.Error(errors.New("删除DaemonSet失败, " + err.Error()))
 		return errors.New("删除DaemonSet失败, " + err.Error())
@@ -75,7 +83,7 @@ func (d *daemonSet) DeleteDaemonSet(daemonSetName, namespace string) (err error)
 }
 
 //更新daemonset
-func (d *daemonSet) UpdateDaemonSet(namespace, content string) (err error) {
+func (d *daemonSet) UpdateDaemonSet(client *kubernetes.Clientset, namespace, content string) (err error) {
 	var daemonSet = &appsv1.DaemonSet{}
 
 	err = json.Unmarshal([]byte(content), daemonSet)
@@ -84,7 +92,7 @@ func (d *daemonSet) UpdateDaemonSet(namespace, content string) (err error) {
 		return errors.New("反序列化失败, " + err.Error())
 	}
 
-	_, err = K8s.ClientSet.AppsV1().DaemonSets(namespace).Update(context.TODO(), daemonSet, metav1.UpdateOptions{})
+	_, err = client.AppsV1().DaemonSets(namespace).Update(context.TODO(), daemonSet, metav1.UpdateOptions{})
 	if err != nil {
 		logger.Error(errors.New("更新DaemonSet失败, " + err.Error()))
 		return errors.New("更新DaemonSet失败, " + err.Error())
@@ -108,3 +116,29 @@ func (d *daemonSet) fromCells(cells []DataCell) []appsv1.DaemonSet {
 
 	return daemonSets
 }
+
+//获取daemonset列表，缓存可用时从缓存中读取，否则请求apiserver
+func (d *daemonSet) list(client *kubernetes.Clientset, namespace string) (*appsv1.DaemonSetList, error) {
+	objs, ok := K8s.CacheList(client, "daemonsets", namespace)
+	if !ok {
+		return client.AppsV1().DaemonSets(namespace).List(context.TODO(), metav1.ListOptions{})
+	}
+	list := &appsv1.DaemonSetList{Items: make([]appsv1.DaemonSet, len(objs))}
+	for i, obj := range objs {
+		list.Items[i] = *obj.(*appsv1.DaemonSet)
+	}
+	return list, nil
+}
+
+//获取单个daemonset，缓存可用时从缓存中读取，否则请求apiserver
+func (d *daemonSet) get(client *kubernetes.Clientset, name, namespace string) (*appsv1.DaemonSet, error) {
+	obj, ok, err := K8s.CacheGet(client, "daemonsets", namespace, name)
+	if !ok {
+		return client.AppsV1().DaemonSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	//缓存中的对象是共享的，返回副本避免被修改
+	return obj.(*appsv1.DaemonSet).DeepCopy(), nil
+}
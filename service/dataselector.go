@@ -1,7 +1,10 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -9,6 +12,9 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 /**
@@ -20,29 +26,231 @@ import (
 type dataSelector struct {
 	GenericDataList []DataCell
 	dataSelectQuery *DataSelectQuery //过滤和分页的属性
+	sortValues      [][]interface{}  //排序时每个元素的排序字段的值，与GenericDataList一一对应，最后一个值为namespace
 }
 
 //DataCell接口，用于各种资源list的类型转换，转换后可以使用dataSelector的自定义排序方法
+//GetLabels和GetFields用于label_selector和field_selector过滤，GetFields返回的字段与apiserver支持的field selector一致
+//GetSortValue返回排序字段的值，支持int64、string和time.Time，各资源支持的排序字段见<资源>SortColumns
 type DataCell interface {
 	GetCreation() time.Time
 	GetName() string
+	GetLabels() map[string]string
+	GetFields() fields.Set
+	GetSortValue(column string) interface{}
 }
 
-//DataSelectQuery定义过滤和分页的属性，过滤：Name，分页：Limit和Page
+//DataSelectQuery定义过滤、排序和分页的属性，过滤：Name，排序：SortQuery，分页：Limit和Page
 //Limit是单页的数据条数
 //Page是第几页
 type DataSelectQuery struct {
 	FilterQuery   *FilterQuery
+	SortQuery     *SortQuery
 	PaginateQuery *PaginateQuery
 }
+
+//FilterQuery定义过滤条件，Name为名称模糊匹配
+//LabelSelector和FieldSelector的语法与kubectl的-l和--field-selector一致，如app=checkout,spec.nodeName=node1
+//Namespaces为有权限的namespace，跨namespace查询时只返回其中的资源，nil表示不限制
 type FilterQuery struct {
-	Name string
+	Name          string
+	LabelSelector string
+	FieldSelector string
+	Namespaces    []string
+	labelSelector labels.Selector
+	fieldSelector fields.Selector
+}
+
+//创建FilterQuery并解析label_selector和field_selector，语法错误时返回错误
+//fieldColumns为该资源支持的field selector字段，与apiserver一致，使用不支持的字段时返回错误
+func NewFilterQuery(name, labelSelector, fieldSelector string, fieldColumns []string) (filter *FilterQuery, err error) {
+	filter = &FilterQuery{
+		Name:          name,
+		LabelSelector: labelSelector,
+		FieldSelector: fieldSelector,
+	}
+	if labelSelector != "" {
+		if filter.labelSelector, err = labels.Parse(labelSelector); err != nil {
+			return nil, errors.New("label_selector格式错误，" + err.Error())
+		}
+	}
+	if fieldSelector != "" {
+		if filter.fieldSelector, err = fields.ParseSelector(fieldSelector); err != nil {
+			return nil, errors.New("field_selector格式错误，" + err.Error())
+		}
+		for _, requirement := range filter.fieldSelector.Requirements() {
+			if !contains(fieldColumns, requirement.Field) {
+				return nil, fmt.Errorf("不支持的field_selector字段%s，支持的字段：%s", requirement.Field, strings.Join(fieldColumns, ","))
+			}
+		}
+	}
+	return filter, nil
+}
+
+//判断元素是否满足所有过滤条件
+func (f *FilterQuery) matches(cell DataCell) bool {
+	//判断字符串s中是否包含子串str
+	if f.Name != "" && !strings.Contains(cell.GetName(), f.Name) {
+		return false
+	}
+	if f.labelSelector != nil && !f.labelSelector.Matches(labels.Set(cell.GetLabels())) {
+		return false
+	}
+	if f.fieldSelector != nil && !f.fieldSelector.Matches(cell.GetFields()) {
+		return false
+	}
+	if f.Namespaces != nil && !contains(f.Namespaces, cellNamespace(cell)) {
+		return false
+	}
+	return true
 }
+
 type PaginateQuery struct {
 	Limit int
 	Page  int
 }
 
+//排序方向
+const (
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+//各资源支持的排序字段，列表接口的返回中通过sort_columns告知前端
+var (
+	PodSortColumns         = namespacedSortColumns("status", "node", "restarts", "ip")
+	DeploymentSortColumns  = namespacedSortColumns("replicas", "ready_replicas", "available_replicas")
+	DaemonSetSortColumns   = namespacedSortColumns("desired", "ready")
+	StatefulSetSortColumns = namespacedSortColumns("replicas", "ready_replicas")
+	ServiceSortColumns     = namespacedSortColumns("type", "cluster_ip")
+	IngressSortColumns     = namespacedSortColumns()
+	ConfigMapSortColumns   = namespacedSortColumns()
+	SecretSortColumns      = namespacedSortColumns("type")
+	PvcSortColumns         = namespacedSortColumns("status", "capacity", "storage_class")
+	PvSortColumns          = clusterSortColumns("status", "capacity", "storage_class")
+	NodeSortColumns        = clusterSortColumns("status", "allocatable_cpu", "allocatable_memory", "allocatable_pods")
+	NamespaceSortColumns   = clusterSortColumns("status")
+)
+
+//各资源支持的field selector字段，与apiserver一致，DataCell的GetFields需要返回这些字段
+var (
+	PodFieldColumns = namespacedFieldColumns("spec.nodeName", "spec.restartPolicy", "spec.schedulerName",
+		"spec.serviceAccountName", "spec.hostNetwork", "status.phase", "status.podIP", "status.nominatedNodeName")
+	DeploymentFieldColumns  = namespacedFieldColumns()
+	DaemonSetFieldColumns   = namespacedFieldColumns()
+	StatefulSetFieldColumns = namespacedFieldColumns()
+	ServiceFieldColumns     = namespacedFieldColumns()
+	IngressFieldColumns     = namespacedFieldColumns()
+	ConfigMapFieldColumns   = namespacedFieldColumns()
+	SecretFieldColumns      = namespacedFieldColumns("type")
+	PvcFieldColumns         = namespacedFieldColumns()
+	PvFieldColumns          = clusterFieldColumns()
+	NodeFieldColumns        = clusterFieldColumns("spec.unschedulable")
+	NamespaceFieldColumns   = clusterFieldColumns("status.phase")
+)
+
+//namespace级别资源的field selector字段，包含metadata.name、metadata.namespace
+func namespacedFieldColumns(columns ...string) []string {
+	return append([]string{"metadata.name", "metadata.namespace"}, columns...)
+}
+
+//集群级别资源的field selector字段，包含metadata.name
+func clusterFieldColumns(columns ...string) []string {
+	return append([]string{"metadata.name"}, columns...)
+}
+
+//namespace级别资源的排序字段，包含name、namespace、creation
+func namespacedSortColumns(columns ...string) []string {
+	return append([]string{"name", "namespace", "creation"}, columns...)
+}
+
+//集群级别资源的排序字段，包含name、creation
+func clusterSortColumns(columns ...string) []string {
+	return append([]string{"name", "creation"}, columns...)
+}
+
+//SortQuery定义排序条件，按Columns的顺序依次比较，前一个字段相同时再比较下一个字段
+type SortQuery struct {
+	Columns []*SortColumn
+}
+
+type SortColumn struct {
+	Name  string
+	Order string
+}
+
+//创建SortQuery，sortBy和order为逗号分隔的多个值，如sort_by=node,restarts&order=asc,desc
+//order的个数少于sortBy时，缺少的部分使用最后一个order，都不传时为降序
+//sortBy为空时按创建时间降序，columns为该资源支持的排序字段
+func NewSortQuery(sortBy, order string, columns []string) (query *SortQuery, err error) {
+	query = &SortQuery{}
+	if sortBy == "" {
+		query.Columns = []*SortColumn{{Name: "creation", Order: OrderDesc}}
+		return query, nil
+	}
+	var orders []string
+	if order != "" {
+		orders = strings.Split(order, ",")
+	}
+	for i, name := range strings.Split(sortBy, ",") {
+		name = strings.TrimSpace(name)
+		if !contains(columns, name) {
+			return nil, fmt.Errorf("不支持的排序字段%s，支持的字段：%s", name, strings.Join(columns, ","))
+		}
+		o := OrderDesc
+		if len(orders) > 0 {
+			o = strings.TrimSpace(orders[len(orders)-1])
+			if i < len(orders) {
+				o = strings.TrimSpace(orders[i])
+			}
+		}
+		if o != OrderAsc && o != OrderDesc {
+			return nil, errors.New("order只能为asc或desc")
+		}
+		query.Columns = append(query.Columns, &SortColumn{Name: name, Order: o})
+	}
+	return query, nil
+}
+
+//比较两个排序字段的值，a小于b时返回负数
+func compareSortValue(a, b interface{}) int {
+	switch x := a.(type) {
+	case int64:
+		y, _ := b.(int64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	case string:
+		y, _ := b.(string)
+		return strings.Compare(x, y)
+	case time.Time:
+		y, _ := b.(time.Time)
+		switch {
+		case x.Before(y):
+			return -1
+		case x.After(y):
+			return 1
+		}
+	}
+	return 0
+}
+
+//所有资源都支持的排序字段的值
+func objectMetaSortValue(meta *metav1.ObjectMeta, column string) interface{} {
+	switch column {
+	case "name":
+		return meta.Name
+	case "namespace":
+		return meta.Namespace
+	case "creation":
+		return meta.CreationTimestamp.Time
+	}
+	return nil
+}
+
 //实现自定义结构的排序，需要重写Len、Swap、Less方法
 //Len方法用于获取数组长度
 func (d *dataSelector) Len() int {
@@ -52,38 +260,62 @@ func (d *dataSelector) Len() int {
 //Swap方法用于数组中的元素在比较大小后的位置交换，可定义升序或降序
 func (d *dataSelector) Swap(i, j int) {
 	d.GenericDataList[i], d.GenericDataList[j] = d.GenericDataList[j], d.GenericDataList[i]
+	d.sortValues[i], d.sortValues[j] = d.sortValues[j], d.sortValues[i]
 }
 
 //Less方法用于定义数组中元素排序的“大小”的比较方式
+//按SortQuery中的字段依次比较，所有字段都相同时按名称升序，保证分页结果稳定
 func (d *dataSelector) Less(i, j int) bool {
-	a := d.GenericDataList[i].GetCreation()
-	b := d.GenericDataList[j].GetCreation()
-	return b.Before(a)
+	a, b := d.GenericDataList[i], d.GenericDataList[j]
+	//未指定排序条件时按创建时间降序
+	if d.dataSelectQuery.SortQuery == nil {
+		return b.GetCreation().Before(a.GetCreation())
+	}
+	for k, column := range d.dataSelectQuery.SortQuery.Columns {
+		result := compareSortValue(d.sortValues[i][k], d.sortValues[j][k])
+		if result == 0 {
+			continue
+		}
+		if column.Order == OrderAsc {
+			return result < 0
+		}
+		return result > 0
+	}
+	last := len(d.sortValues[i]) - 1
+	if result := compareSortValue(d.sortValues[i][last], d.sortValues[j][last]); result != 0 {
+		return result < 0
+	}
+	return a.GetName() < b.GetName()
 }
 
 //重写以上3个方法使用sort.Sort进行排序
+//排序前计算一次每个元素的排序字段的值，pod的status等字段计算开销较大，不在每次比较时重复计算
 func (d *dataSelector) Sort() *dataSelector {
+	d.sortValues = make([][]interface{}, len(d.GenericDataList))
+	if query := d.dataSelectQuery.SortQuery; query != nil {
+		for i, cell := range d.GenericDataList {
+			values := make([]interface{}, 0, len(query.Columns)+1)
+			for _, column := range query.Columns {
+				values = append(values, cell.GetSortValue(column.Name))
+			}
+			d.sortValues[i] = append(values, cell.GetSortValue("namespace"))
+		}
+	}
 	sort.Sort(d)
+	d.sortValues = nil
 	return d
 }
 
-//Filter方法用于过滤元素，比较元素的Name属性，若包含，再返回
+//Filter方法用于过滤元素，元素名包含Name且满足label_selector和field_selector时返回
 func (d *dataSelector) Filter() *dataSelector {
-	//若Name的传参为空，则返回所有元素
-	if d.dataSelectQuery.FilterQuery.Name == "" {
+	filter := d.dataSelectQuery.FilterQuery
+	//若没有任何过滤条件，则返回所有元素
+	if filter == nil || (filter.Name == "" && filter.labelSelector == nil && filter.fieldSelector == nil && filter.Namespaces == nil) {
 		return d
 	}
-	//若Name的传参不为空，则返回元素名中包含Name的所有元素
 	filteredList := []DataCell{}
 	for _, value := range d.GenericDataList {
-		matches := true
-		objName := value.GetName()
-		//判断字符串s中是否包含子串str
-		if !strings.Contains(objName, d.dataSelectQuery.FilterQuery.Name) {
-			matches = false
-			continue
-		}
-		if matches {
+		if filter.matches(value) {
 			filteredList = append(filteredList, value)
 		}
 	}
@@ -91,6 +323,49 @@ func (d *dataSelector) Filter() *dataSelector {
 	return d
 }
 
+//NamespaceFacet为列表中单个namespace的资源数量
+type NamespaceFacet struct {
+	Namespace string `json:"namespace"`
+	Total     int    `json:"total"`
+}
+
+//Facets方法统计每个namespace的元素数量，按namespace名称升序返回，需要在Filter之后、Paginate之前调用
+func (d *dataSelector) Facets() []*NamespaceFacet {
+	counts := countByNamespace(d.GenericDataList)
+	facets := make([]*NamespaceFacet, 0, len(counts))
+	for namespace, total := range counts {
+		facets = append(facets, &NamespaceFacet{Namespace: namespace, Total: total})
+	}
+	sort.Slice(facets, func(i, j int) bool {
+		return facets[i].Namespace < facets[j].Namespace
+	})
+	return facets
+}
+
+//统计每个namespace的元素数量
+func countByNamespace(cells []DataCell) map[string]int {
+	counts := map[string]int{}
+	for _, cell := range cells {
+		counts[cellNamespace(cell)]++
+	}
+	return counts
+}
+
+//获取元素所在的namespace，集群级别的资源返回空
+func cellNamespace(cell DataCell) string {
+	namespace, _ := cell.GetSortValue("namespace").(string)
+	return namespace
+}
+
+//所有资源都支持的field selector字段，集群级别的资源没有metadata.namespace
+func objectMetaFields(meta *metav1.ObjectMeta) fields.Set {
+	set := fields.Set{"metadata.name": meta.Name}
+	if meta.Namespace != "" {
+		set["metadata.namespace"] = meta.Namespace
+	}
+	return set
+}
+
 //Paginate方法用于数组分页，根据Limit和Page的传参，返回数据
 func (d *dataSelector) Paginate() *dataSelector {
 	limit := d.dataSelectQuery.PaginateQuery.Limit
@@ -102,6 +377,10 @@ func (d *dataSelector) Paginate() *dataSelector {
 	//举例：25个元素的数组，limit是10，page是3，startIndex是20，endIndex是30（实际上endIndex是25）
 	startIndex := limit * (page - 1)
 	endIndex := limit * page
+	//页码超过最后一页时返回空列表
+	if len(d.GenericDataList) < startIndex {
+		startIndex = len(d.GenericDataList)
+	}
 	//处理最后一页，这时候就把endIndex由30改为25了
 	if len(d.GenericDataList) < endIndex {
 		endIndex = len(d.GenericDataList)
@@ -119,6 +398,40 @@ func (p podCell) GetCreation() time.Time {
 func (p podCell) GetName() string {
 	return p.Name
 }
+func (p podCell) GetLabels() map[string]string {
+	return p.Labels
+}
+func (p podCell) GetFields() fields.Set {
+	set := objectMetaFields(&p.ObjectMeta)
+	set["spec.nodeName"] = p.Spec.NodeName
+	set["spec.restartPolicy"] = string(p.Spec.RestartPolicy)
+	set["spec.schedulerName"] = p.Spec.SchedulerName
+	set["spec.serviceAccountName"] = p.Spec.ServiceAccountName
+	set["spec.hostNetwork"] = strconv.FormatBool(p.Spec.HostNetwork)
+	set["status.phase"] = string(p.Status.Phase)
+	set["status.podIP"] = p.Status.PodIP
+	set["status.nominatedNodeName"] = p.Status.NominatedNodeName
+	return set
+}
+func (p podCell) GetSortValue(column string) interface{} {
+	switch column {
+	case "status":
+		//与view=summary返回的状态一致，如CrashLoopBackOff、Terminating
+		pod := corev1.Pod(p)
+		return Pod.summarize(&pod).Status
+	case "node":
+		return p.Spec.NodeName
+	case "restarts":
+		var restarts int64
+		for _, status := range p.Status.ContainerStatuses {
+			restarts += int64(status.RestartCount)
+		}
+		return restarts
+	case "ip":
+		return p.Status.PodIP
+	}
+	return objectMetaSortValue(&p.ObjectMeta, column)
+}
 
 //实现Deployment的DataCell接口
 type deploymentCell appsv1.Deployment //appsv1 "k8s.io/api/apps/v1"
@@ -128,6 +441,23 @@ func (d deploymentCell) GetCreation() time.Time {
 func (d deploymentCell) GetName() string {
 	return d.Name
 }
+func (d deploymentCell) GetLabels() map[string]string {
+	return d.Labels
+}
+func (d deploymentCell) GetFields() fields.Set {
+	return objectMetaFields(&d.ObjectMeta)
+}
+func (d deploymentCell) GetSortValue(column string) interface{} {
+	switch column {
+	case "replicas":
+		return int64(d.Status.Replicas)
+	case "ready_replicas":
+		return int64(d.Status.ReadyReplicas)
+	case "available_replicas":
+		return int64(d.Status.AvailableReplicas)
+	}
+	return objectMetaSortValue(&d.ObjectMeta, column)
+}
 
 //实现Service的DataCell接口
 type serviceCell corev1.Service //corev1 "k8s.io/api/core/v1"
@@ -137,6 +467,21 @@ func (s serviceCell) GetCreation() time.Time {
 func (s serviceCell) GetName() string {
 	return s.Name
 }
+func (s serviceCell) GetLabels() map[string]string {
+	return s.Labels
+}
+func (s serviceCell) GetFields() fields.Set {
+	return objectMetaFields(&s.ObjectMeta)
+}
+func (s serviceCell) GetSortValue(column string) interface{} {
+	switch column {
+	case "type":
+		return string(s.Spec.Type)
+	case "cluster_ip":
+		return s.Spec.ClusterIP
+	}
+	return objectMetaSortValue(&s.ObjectMeta, column)
+}
 
 //实现Ingress的DataCell接口
 type ingressCell nwv1.Ingress //nwv1 "k8s.io/api/networking/v1"
@@ -146,6 +491,15 @@ func (i ingressCell) GetCreation() time.Time {
 func (i ingressCell) GetName() string {
 	return i.Name
 }
+func (i ingressCell) GetLabels() map[string]string {
+	return i.Labels
+}
+func (i ingressCell) GetFields() fields.Set {
+	return objectMetaFields(&i.ObjectMeta)
+}
+func (i ingressCell) GetSortValue(column string) interface{} {
+	return objectMetaSortValue(&i.ObjectMeta, column)
+}
 
 type namespaceCell corev1.Namespace
 
@@ -157,6 +511,23 @@ func (n namespaceCell) GetName() string {
 	return n.Name
 }
 
+func (n namespaceCell) GetLabels() map[string]string {
+	return n.Labels
+}
+
+func (n namespaceCell) GetFields() fields.Set {
+	set := objectMetaFields(&n.ObjectMeta)
+	set["status.phase"] = string(n.Status.Phase)
+	return set
+}
+
+func (n namespaceCell) GetSortValue(column string) interface{} {
+	if column == "status" {
+		return string(n.Status.Phase)
+	}
+	return objectMetaSortValue(&n.ObjectMeta, column)
+}
+
 type configMapCell corev1.ConfigMap
 
 func (c configMapCell) GetCreation() time.Time {
@@ -167,6 +538,18 @@ func (c configMapCell) GetName() string {
 	return c.Name
 }
 
+func (c configMapCell) GetLabels() map[string]string {
+	return c.Labels
+}
+
+func (c configMapCell) GetFields() fields.Set {
+	return objectMetaFields(&c.ObjectMeta)
+}
+
+func (c configMapCell) GetSortValue(column string) interface{} {
+	return objectMetaSortValue(&c.ObjectMeta, column)
+}
+
 type daemonSetCell appsv1.DaemonSet
 
 func (d daemonSetCell) GetCreation() time.Time {
@@ -177,6 +560,24 @@ func (d daemonSetCell) GetName() string {
 	return d.Name
 }
 
+func (d daemonSetCell) GetLabels() map[string]string {
+	return d.Labels
+}
+
+func (d daemonSetCell) GetFields() fields.Set {
+	return objectMetaFields(&d.ObjectMeta)
+}
+
+func (d daemonSetCell) GetSortValue(column string) interface{} {
+	switch column {
+	case "desired":
+		return int64(d.Status.DesiredNumberScheduled)
+	case "ready":
+		return int64(d.Status.NumberReady)
+	}
+	return objectMetaSortValue(&d.ObjectMeta, column)
+}
+
 type statefulSetCell appsv1.StatefulSet
 
 func (s statefulSetCell) GetCreation() time.Time {
@@ -187,6 +588,24 @@ func (s statefulSetCell) GetName() string {
 	return s.Name
 }
 
+func (s statefulSetCell) GetLabels() map[string]string {
+	return s.Labels
+}
+
+func (s statefulSetCell) GetFields() fields.Set {
+	return objectMetaFields(&s.ObjectMeta)
+}
+
+func (s statefulSetCell) GetSortValue(column string) interface{} {
+	switch column {
+	case "replicas":
+		return int64(s.Status.Replicas)
+	case "ready_replicas":
+		return int64(s.Status.ReadyReplicas)
+	}
+	return objectMetaSortValue(&s.ObjectMeta, column)
+}
+
 type nodeCell corev1.Node
 
 func (n nodeCell) GetCreation() time.Time {
@@ -197,6 +616,35 @@ func (n nodeCell) GetName() string {
 	return n.Name
 }
 
+func (n nodeCell) GetLabels() map[string]string {
+	return n.Labels
+}
+
+func (n nodeCell) GetFields() fields.Set {
+	set := objectMetaFields(&n.ObjectMeta)
+	set["spec.unschedulable"] = strconv.FormatBool(n.Spec.Unschedulable)
+	return set
+}
+
+func (n nodeCell) GetSortValue(column string) interface{} {
+	switch column {
+	case "status":
+		for _, condition := range n.Status.Conditions {
+			if condition.Type == corev1.NodeReady {
+				return string(condition.Status)
+			}
+		}
+		return string(corev1.ConditionUnknown)
+	case "allocatable_cpu":
+		return n.Status.Allocatable.Cpu().MilliValue()
+	case "allocatable_memory":
+		return n.Status.Allocatable.Memory().Value()
+	case "allocatable_pods":
+		return n.Status.Allocatable.Pods().Value()
+	}
+	return objectMetaSortValue(&n.ObjectMeta, column)
+}
+
 type pvCell corev1.PersistentVolume
 
 func (p pvCell) GetCreation() time.Time {
@@ -207,6 +655,26 @@ func (p pvCell) GetName() string {
 	return p.Name
 }
 
+func (p pvCell) GetLabels() map[string]string {
+	return p.Labels
+}
+
+func (p pvCell) GetFields() fields.Set {
+	return objectMetaFields(&p.ObjectMeta)
+}
+
+func (p pvCell) GetSortValue(column string) interface{} {
+	switch column {
+	case "status":
+		return string(p.Status.Phase)
+	case "capacity":
+		return p.Spec.Capacity.Storage().Value()
+	case "storage_class":
+		return p.Spec.StorageClassName
+	}
+	return objectMetaSortValue(&p.ObjectMeta, column)
+}
+
 type secretCell corev1.Secret
 
 func (s secretCell) GetCreation() time.Time {
@@ -217,6 +685,23 @@ func (s secretCell) GetName() string {
 	return s.Name
 }
 
+func (s secretCell) GetLabels() map[string]string {
+	return s.Labels
+}
+
+func (s secretCell) GetFields() fields.Set {
+	set := objectMetaFields(&s.ObjectMeta)
+	set["type"] = string(s.Type)
+	return set
+}
+
+func (s secretCell) GetSortValue(column string) interface{} {
+	if column == "type" {
+		return string(s.Type)
+	}
+	return objectMetaSortValue(&s.ObjectMeta, column)
+}
+
 type pvcCell corev1.PersistentVolumeClaim
 
 func (p pvcCell) GetCreation() time.Time {
@@ -226,3 +711,29 @@ func (p pvcCell) GetCreation() time.Time {
 func (p pvcCell) GetName() string {
 	return p.Name
 }
+
+func (p pvcCell) GetLabels() map[string]string {
+	return p.Labels
+}
+
+func (p pvcCell) GetFields() fields.Set {
+	return objectMetaFields(&p.ObjectMeta)
+}
+func (p pvcCell) GetSortValue(column string) interface{} {
+	switch column {
+	case "status":
+		return string(p.Status.Phase)
+	case "capacity":
+		//已绑定的pvc使用实际容量，未绑定时使用申请的容量
+		if capacity, ok := p.Status.Capacity[corev1.ResourceStorage]; ok {
+			return capacity.Value()
+		}
+		return p.Spec.Resources.Requests.Storage().Value()
+	case "storage_class":
+		if p.Spec.StorageClassName != nil {
+			return *p.Spec.StorageClassName
+		}
+		return ""
+	}
+	return objectMetaSortValue(&p.ObjectMeta, column)
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	nwv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//各资源支持的field selector字段需要与GetFields返回的字段一致
+func TestFieldColumnsMatchCells(t *testing.T) {
+	meta := metav1.ObjectMeta{Name: "test", Namespace: "default"}
+	cases := []struct {
+		kind    string
+		cell    DataCell
+		columns []string
+	}{
+		{"pod", podCell(corev1.Pod{ObjectMeta: meta}), PodFieldColumns},
+		{"deployment", deploymentCell(appsv1.Deployment{ObjectMeta: meta}), DeploymentFieldColumns},
+		{"daemonset", daemonSetCell(appsv1.DaemonSet{ObjectMeta: meta}), DaemonSetFieldColumns},
+		{"statefulset", statefulSetCell(appsv1.StatefulSet{ObjectMeta: meta}), StatefulSetFieldColumns},
+		{"service", serviceCell(corev1.Service{ObjectMeta: meta}), ServiceFieldColumns},
+		{"ingress", ingressCell(nwv1.Ingress{ObjectMeta: meta}), IngressFieldColumns},
+		{"configmap", configMapCell(corev1.ConfigMap{ObjectMeta: meta}), ConfigMapFieldColumns},
+		{"secret", secretCell(corev1.Secret{ObjectMeta: meta}), SecretFieldColumns},
+		{"pvc", pvcCell(corev1.PersistentVolumeClaim{ObjectMeta: meta}), PvcFieldColumns},
+		{"pv", pvCell(corev1.PersistentVolume{}), PvFieldColumns},
+		{"node", nodeCell(corev1.Node{}), NodeFieldColumns},
+		{"namespace", namespaceCell(corev1.Namespace{}), NamespaceFieldColumns},
+	}
+	for _, c := range cases {
+		var keys []string
+		for key := range c.cell.GetFields() {
+			keys = append(keys, key)
+		}
+		columns := append([]string{}, c.columns...)
+		sort.Strings(keys)
+		sort.Strings(columns)
+		if strings.Join(keys, ",") != strings.Join(columns, ",") {
+			t.Errorf("%s: GetFields返回%v，支持的字段为%v", c.kind, keys, columns)
+		}
+	}
+}
+
+func TestNewFilterQueryFieldColumns(t *testing.T) {
+	if _, err := NewFilterQuery("", "", "spec.nodeName=node1,status.phase!=Running", PodFieldColumns); err != nil {
+		t.Fatalf("支持的字段返回错误：%v", err)
+	}
+	//apiserver不支持的字段，之前会因GetFields中没有该字段而静默返回空列表
+	for _, selector := range []string{"spec.nodename=node1", "status.hostIP=10.0.0.1", "metadata.namespace=default"} {
+		columns := PodFieldColumns
+		if strings.HasPrefix(selector, "metadata.namespace") {
+			columns = NodeFieldColumns
+		}
+		if _, err := NewFilterQuery("", "", selector, columns); err == nil {
+			t.Errorf("%s: 不支持的字段没有返回错误", selector)
+		}
+	}
+}
+
+//status排序使用与列表中显示一致的状态，而不是status.phase
+func TestPodSortByStatus(t *testing.T) {
+	crash := corev1.Pod{Status: corev1.PodStatus{
+		Phase: corev1.PodRunning,
+		ContainerStatuses: []corev1.ContainerStatus{{
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		}},
+	}}
+	crash.Name = "crash"
+	running := corev1.Pod{Status: corev1.PodStatus{
+		Phase: corev1.PodRunning,
+		ContainerStatuses: []corev1.ContainerStatus{{
+			Ready: true,
+			State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+		}},
+	}}
+	running.Name = "running"
+	if got := podCell(crash).GetSortValue("status"); got != "CrashLoopBackOff" {
+		t.Fatalf("status排序值为%v，期望CrashLoopBackOff", got)
+	}
+	query, err := NewSortQuery("status", "asc", PodSortColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selector := &dataSelector{
+		GenericDataList: []DataCell{podCell(running), podCell(crash)},
+		dataSelectQuery: &DataSelectQuery{SortQuery: query},
+	}
+	cells := selector.Sort().GenericDataList
+	if cells[0].GetName() != "crash" || cells[1].GetName() != "running" {
+		t.Fatalf("排序结果为%s,%s，期望crash,running", cells[0].GetName(), cells[1].GetName())
+	}
+}
+
+//记录GetSortValue调用次数的DataCell
+type countingCell struct {
+	podCell
+	calls *int
+}
+
+func (c countingCell) GetSortValue(column string) interface{} {
+	*c.calls++
+	return c.podCell.GetSortValue(column)
+}
+
+//每个元素的排序字段只计算一次，不在每次比较时重新计算pod状态
+func TestSortComputesValuesOnce(t *testing.T) {
+	query, err := NewSortQuery("status", "asc", PodSortColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	cells := make([]DataCell, 100)
+	for i := range cells {
+		pod := corev1.Pod{}
+		pod.Name = fmt.Sprintf("pod-%03d", (i*37)%100)
+		cells[i] = countingCell{podCell(pod), &calls}
+	}
+	selector := &dataSelector{GenericDataList: cells, dataSelectQuery: &DataSelectQuery{SortQuery: query}}
+	sorted := selector.Sort().GenericDataList
+	//每个元素计算status和namespace两个值
+	if calls != 2*len(cells) {
+		t.Fatalf("GetSortValue调用%d次，期望%d次", calls, 2*len(cells))
+	}
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i-1].GetName() > sorted[i].GetName() {
+			t.Fatalf("状态相同时应该按名称升序，%s在%s之前", sorted[i-1].GetName(), sorted[i].GetName())
+		}
+	}
+}
+
+//页码超过最后一页时返回空列表
+func TestPaginateOutOfRange(t *testing.T) {
+	cases := []struct {
+		page  int
+		names string
+	}{
+		{1, "a,b"},
+		{2, "c"},
+		{3, ""},
+		{10, ""},
+	}
+	for _, c := range cases {
+		var cells []DataCell
+		for _, name := range []string{"a", "b", "c"} {
+			pod := corev1.Pod{}
+			pod.Name = name
+			cells = append(cells, podCell(pod))
+		}
+		selector := &dataSelector{
+			GenericDataList: cells,
+			dataSelectQuery: &DataSelectQuery{PaginateQuery: &PaginateQuery{Limit: 2, Page: c.page}},
+		}
+		var names []string
+		for _, cell := range selector.Paginate().GenericDataList {
+			names = append(names, cell.GetName())
+		}
+		if got := strings.Join(names, ","); got != c.names {
+			t.Errorf("第%d页为%q，期望%q", c.page, got, c.names)
+		}
+	}
+}
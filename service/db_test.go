@@ -0,0 +1,45 @@
+package service
+
+import (
+	"k8s-platform/db"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+//使用内存sqlite代替mysql，并执行与启动时相同的迁移，每个测试使用独立的数据库
+func setupTestDB(t *testing.T) {
+	//内存数据库每个连接都是独立的，只保留一个连接
+	openTestDB(t, "file::memory:", 1)
+}
+
+//使用文件sqlite，允许多个连接同时读写，用于测试并发请求
+func setupTestFileDB(t *testing.T) {
+	openTestDB(t, filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000&_journal_mode=WAL", 10)
+}
+
+func openTestDB(t *testing.T, dsn string, maxOpenConns int) {
+	gormDB, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(maxOpenConns)
+	old := db.GORM
+	db.GORM = gormDB
+	t.Cleanup(func() {
+		db.GORM = old
+		sqlDB.Close()
+	})
+	if err = db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"k8s-platform/config"
+	"time"
+
+	"github.com/wonderivan/logger"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+)
+
+//检查调试容器状态的间隔
+const debugContainerPollInterval = time.Second
+
+//在pod中添加临时调试容器并等待启动，target为共享进程命名空间的容器，为空时使用第一个容器
+//等待过程中的进度输出到终端，返回调试容器名
+func (t *terminal) startDebugContainer(client *kubernetes.Clientset, namespace, podName, target string, pty *TerminalSession) (name string, err error) {
+	pod, err := client.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if err != nil {
+		logger.Error("获取Pod详情失败，" + err.Error())
+		return "", errors.New("获取Pod详情失败，" + err.Error())
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		return "", fmt.Errorf("Pod状态为%s，只能调试运行中的Pod", pod.Status.Phase)
+	}
+	if target == "" {
+		target = pod.Spec.Containers[0].Name
+	}
+	found := false
+	for _, container := range pod.Spec.Containers {
+		if container.Name == target {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("Pod中不存在容器%s", target)
+	}
+	name = "debugger-" + utilrand.String(5)
+	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:                     name,
+			Image:                    config.DebugImage,
+			ImagePullPolicy:          corev1.PullIfNotPresent,
+			Stdin:                    true,
+			TTY:                      true,
+			TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		},
+		TargetContainerName: target,
+	})
+	pty.Write([]byte(fmt.Sprintf("正在创建调试容器%s，镜像%s，目标容器%s...\r\n", name, config.DebugImage, target)))
+	if _, err = client.CoreV1().Pods(namespace).UpdateEphemeralContainers(context.TODO(), podName, pod, metav1.UpdateOptions{}); err != nil {
+		logger.Error("创建调试容器失败，" + err.Error())
+		return "", errors.New("创建调试容器失败，" + err.Error())
+	}
+	if err = t.waitDebugContainer(client, namespace, podName, name, pty); err != nil {
+		return "", err
+	}
+	pty.Write([]byte("调试容器已启动，如果没有看到命令提示符，请按回车\r\n"))
+	return name, nil
+}
+
+//等待调试容器进入running状态，超过config.DebugStartTimeout、容器退出或拉取镜像失败时返回错误
+func (t *terminal) waitDebugContainer(client *kubernetes.Clientset, namespace, podName, name string, pty *TerminalSession) error {
+	timeout := time.NewTimer(config.DebugStartTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(debugContainerPollInterval)
+	defer ticker.Stop()
+	for {
+		pod, err := client.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+		if err != nil {
+			logger.Error("获取Pod详情失败，" + err.Error())
+			return errors.New("获取Pod详情失败，" + err.Error())
+		}
+		for _, status := range pod.Status.EphemeralContainerStatuses {
+			if status.Name != name {
+				continue
+			}
+			switch {
+			case status.State.Running != nil:
+				return nil
+			case status.State.Terminated != nil:
+				return fmt.Errorf("调试容器已退出，%s %s", status.State.Terminated.Reason, status.State.Terminated.Message)
+			case status.State.Waiting != nil:
+				switch status.State.Waiting.Reason {
+				case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CreateContainerError", "CreateContainerConfigError":
+					return fmt.Errorf("调试容器启动失败，%s %s", status.State.Waiting.Reason, status.State.Waiting.Message)
+				}
+			}
+		}
+		select {
+		case <-pty.doneChan:
+			return errors.New("会话已结束")
+		case <-timeout.C:
+			return fmt.Errorf("调试容器%s未在%s内启动", name, config.DebugStartTimeout)
+		case <-ticker.C:
+		}
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/wonderivan/logger"
 	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 /**
@@ -27,13 +28,16 @@ type deployment struct{}
 
 //定义列表的返回内容，Items是deployment元素列表，Total为deployment元素数量
 type DeploymentsResp struct {
-	Items []appsv1.Deployment `json:"items"`
-	Total int                 `json:"total"`
+	Items       []appsv1.Deployment `json:"items"`
+	Total       int                 `json:"total"`
+	Facets      []*NamespaceFacet   `json:"facets"`
+	SortColumns []string            `json:"sort_columns"`
 }
 
 //定义DeployCreate结构体，用于创建deployment需要的参数属性的定义
 type DeployCreate struct {
 	Name          string            `json:"name"`
+	Cluster       string            `json:"cluster"`
 	Namespace     string            `json:"namespace"`
 	Replicas      int32             `json:"replicas"`
 	Image         string            `json:"image"`
@@ -67,9 +71,9 @@ func (d *deployment) fromCells(cells []DataCell) []appsv1.Deployment {
 }
 
 //获取deployment列表，支持过滤、排序、分页
-func (d *deployment) GetDeployments(filterName, namespace string, limit, page int) (deploymentsResp *DeploymentsResp, err error) {
+func (d *deployment) GetDeployments(client *kubernetes.Clientset, filter *FilterQuery, sort *SortQuery, namespace string, limit, page int) (deploymentsResp *DeploymentsResp, err error) {
 	//获取deploymentList类型的deployment列表
-	deploymentList, err := K8s.ClientSet.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
+	deploymentList, err := d.list(client, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取Deployment列表失败，" + err.Error()))
 		return nil, errors.New("获取Deployment列表失败，" + err.Error())
@@ -78,7 +82,8 @@ func (d *deployment) GetDeployments(filterName, namespace string, limit, page in
 	selectableData := &dataSelector{
 		GenericDataList: d.toCells(deploymentList.Items),
 		dataSelectQuery: &DataSelectQuery{
-			FilterQuery: &FilterQuery{Name: filterName},
+			FilterQuery: filter,
+			SortQuery:   sort,
 			PaginateQuery: &PaginateQuery{
 				Limit: limit,
 				Page:  page,
@@ -87,18 +92,22 @@ func (d *deployment) GetDeployments(filterName, namespace string, limit, page in
 	}
 	filtered := selectableData.Filter()
 	total := len(filtered.GenericDataList)
+	//统计每个namespace的数量，需要在分页之前
+	facets := filtered.Facets()
 	data := filtered.Sort().Paginate()
 	//将[]DataCell类型的deployment列表转为appsv1.deployment列表
 	deployments := d.fromCells(data.GenericDataList)
 	return &DeploymentsResp{
-		Items: deployments,
-		Total: total,
+		Items:       deployments,
+		Total:       total,
+		Facets:      facets,
+		SortColumns: DeploymentSortColumns,
 	}, nil
 }
 
 //获取deployment详情
-func (d *deployment) GetDeploymentDetail(deploymentName, namespace string) (deployment *appsv1.Deployment, err error) {
-	deployment, err = K8s.ClientSet.AppsV1().Deployments(namespace).Get(context.TODO(), deploymentName, metav1.GetOptions{})
+func (d *deployment) GetDeploymentDetail(client *kubernetes.Clientset, deploymentName, namespace string) (deployment *appsv1.Deployment, err error) {
+	deployment, err = d.get(client, deploymentName, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取Deployment详情失败，" + err.Error()))
 		return nil, errors.New("获取Deployment详情失败，" + err.Error())
@@ -107,9 +116,9 @@ func (d *deployment) GetDeploymentDetail(deploymentName, namespace string) (depl
 }
 
 //设置deployment副本数
-func (d *deployment) ScaleDeployment(deploymentName, namespace string, scaleNum int) (replica int32, err error) {
+func (d *deployment) ScaleDeployment(client *kubernetes.Clientset, deploymentName, namespace string, scaleNum int) (replica int32, err error) {
 	//获取autoscalingv1.Scale类型的对象，能点出当前的副本数
-	scale, err := K8s.ClientSet.AppsV1().Deployments(namespace).GetScale(context.TODO(), deploymentName, metav1.GetOptions{})
+	scale, err := client.AppsV1().Deployments(namespace).GetScale(context.TODO(), deploymentName, metav1.GetOptions{})
 	fmt.Println("deploymentName", deploymentName)
 	fmt.Println("namespace", namespace)
 	if err != nil {
@@ -119,7 +128,7 @@ func (d *deployment) ScaleDeployment(deploymentName, namespace string, scaleNum
 	//修改副本数
 	scale.Spec.Replicas = int32(scaleNum)
 	//更新副本数，传入scale对象
-	newScale, err := K8s.ClientSet.AppsV1().Deployments(namespace).UpdateScale(context.TODO(), deploymentName, scale, metav1.UpdateOptions{})
+	newScale, err := client.AppsV1().Deployments(namespace).UpdateScale(context.TODO(), deploymentName, scale, metav1.UpdateOptions{})
 	if err != nil {
 		logger.Error(errors.New("更新Deployment副本数信息失败，" + err.Error()))
 		return 0, errors.New("更新Deployment副本数信息失败，" + err.Error())
@@ -128,7 +137,7 @@ func (d *deployment) ScaleDeployment(deploymentName, namespace string, scaleNum
 }
 
 //创建deployment，接收DeployCreate对象
-func (d *deployment) CreateDeployment(data *DeployCreate) (err error) {
+func (d *deployment) CreateDeployment(client *kubernetes.Clientset, data *DeployCreate) (err error) {
 	//将data中的数据组装成appsv1.Deployment对象
 	deployment := &appsv1.Deployment{
 		//ObjectMeta中定义资源名、命名空间以及标签
@@ -219,7 +228,7 @@ func (d *deployment) CreateDeployment(data *DeployCreate) (err error) {
 		}
 	}
 	//调用sdk创建deployment
-	_, err = K8s.ClientSet.AppsV1().Deployments(data.Namespace).Create(context.TODO(), deployment, metav1.CreateOptions{})
+	_, err = client.AppsV1().Deployments(data.Namespace).Create(context.TODO(), deployment, metav1.CreateOptions{})
 	if err != nil {
 		logger.Error(errors.New("创建Deployment失败，" + err.Error()))
 		return errors.New("创建Deployment失败," + err.Error())
@@ -228,17 +237,17 @@ func (d *deployment) CreateDeployment(data *DeployCreate) (err error) {
 }
 
 //删除deployment
-func (d *deployment) DeleteDeployment(deploymentName, namespace string) (err error) {
-	err = K8s.ClientSet.AppsV1().Deployments(namespace).Delete(context.TODO(), deploymentName, metav1.DeleteOptions{})
+func (d *deployment) DeleteDeployment(client *kubernetes.Clientset, deploymentName, namespace string) (err error) {
+	err = client.AppsV1().Deployments(namespace).Delete(context.TODO(), deploymentName, metav1.DeleteOptions{})
 	if err != nil {
 		logger.Error(errors.New("删除Deployment失败，" + err.Error()))
-		return errors.New("删除Deployment失败，" + err.Error())
+		return fmt.Errorf("删除Deployment失败，%w", err)
 	}
 	return nil
 }
 
 //重启deployment
-func (d *deployment) RestartDeployment(deploymentName, namespace, imageName, image string) (err error) {
+func (d *deployment) RestartDeployment(client *kubernetes.Clientset, deploymentName, namespace, imageName, image string) (err error) {
 	//此功能等同于以下kubectl命令
 	//kubectl deployment ${service} -p \
 	//'{"spec":{"template":{"spec":{"containers":[{"name":"'"${service}"'","env":
@@ -274,7 +283,7 @@ func (d *deployment) RestartDeployment(deploymentName, namespace, imageName, ima
 		return errors.New("json序列化失败，" + err.Error())
 	}
 	//调用patch方法更新deployment
-	_, err = K8s.ClientSet.AppsV1().Deployments(namespace).Patch(context.TODO(), deploymentName, "application/strategic-merge-patch+json", patchByte, metav1.PatchOptions{})
+	_, err = client.AppsV1().Deployments(namespace).Patch(context.TODO(), deploymentName, "application/strategic-merge-patch+json", patchByte, metav1.PatchOptions{})
 	if err != nil {
 		logger.Error(errors.New("重启Deployment失败，" + err.Error()))
 		return errors.New("重启Deployment失败，" + err.Error())
@@ -283,7 +292,7 @@ func (d *deployment) RestartDeployment(deploymentName, namespace, imageName, ima
 }
 
 //更新deployment
-func (d *deployment) UpdateDeployment(namespace, content string) (err error) {
+func (d *deployment) UpdateDeployment(client *kubernetes.Clientset, namespace, content string) (err error) {
 	var deploy = &appsv1.Deployment{}
 
 	err = json.Unmarshal([]byte(content), deploy)
@@ -292,7 +301,7 @@ func (d *deployment) UpdateDeployment(namespace, content string) (err error) {
 		return errors.New("反序列化失败，" + err.Error())
 	}
 
-	_, err = K8s.ClientSet.AppsV1().Deployments(namespace).Update(context.TODO(), deploy, metav1.UpdateOptions{})
+	_, err = client.AppsV1().Deployments(namespace).Update(context.TODO(), deploy, metav1.UpdateOptions{})
 	if err != nil {
 		logger.Error(errors.New("更新Deployment失败，" + err.Error()))
 		return errors.New("更新Deployment失败，" + err.Error())
@@ -300,22 +309,49 @@ func (d *deployment) UpdateDeployment(namespace, content string) (err error) {
 	return nil
 }
 
-//获取每个namespace的deployment数量
-func (d *deployment) GetDeployNumPerNp() (deploysNps []*DeploysNp, err error) {
-	namespaceList, err := K8s.ClientSet.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+//获取每个namespace的deployment数量，只查询一次所有namespace的deployment列表再按namespace统计
+func (d *deployment) GetDeployNumPerNp(client *kubernetes.Clientset, allowed []string) (deploysNps []*DeploysNp, err error) {
+	namespaceList, err := Namespace.list(client)
 	if err != nil {
 		return nil, err
 	}
-	for _, namespace := range namespaceList.Items {
-		deploymentList, err := K8s.ClientSet.AppsV1().Deployments(namespace.Name).List(context.TODO(), metav1.ListOptions{})
-		if err != nil {
-			return nil, err
-		}
+	deploymentList, err := d.list(client, "")
+	if err != nil {
+		return nil, err
+	}
+	counts := countByNamespace(d.toCells(deploymentList.Items))
+	for _, namespace := range filterNamespaces(namespaceList.Items, allowed) {
 		DeploysNp := &DeploysNp{
 			Namespace: namespace.Name,
-			DeployNum: len(deploymentList.Items),
+			DeployNum: counts[namespace.Name],
 		}
 		deploysNps = append(deploysNps, DeploysNp)
 	}
 	return deploysNps, nil
 }
+
+//获取deployment列表，缓存可用时从缓存中读取，否则请求apiserver
+func (d *deployment) list(client *kubernetes.Clientset, namespace string) (*appsv1.DeploymentList, error) {
+	objs, ok := K8s.CacheList(client, "deployments", namespace)
+	if !ok {
+		return client.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
+	}
+	list := &appsv1.DeploymentList{Items: make([]appsv1.Deployment, len(objs))}
+	for i, obj := range objs {
+		list.Items[i] = *obj.(*appsv1.Deployment)
+	}
+	return list, nil
+}
+
+//获取单个deployment，缓存可用时从缓存中读取，否则请求apiserver
+func (d *deployment) get(client *kubernetes.Clientset, name, namespace string) (*appsv1.Deployment, error) {
+	obj, ok, err := K8s.CacheGet(client, "deployments", namespace, name)
+	if !ok {
+		return client.AppsV1().Deployments(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	//缓存中的对象是共享的，返回副本避免被修改
+	return obj.(*appsv1.Deployment).DeepCopy(), nil
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 
 	nwv1 "k8s.io/api/networking/v1"
 
 	"github.com/wonderivan/logger"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 /**
@@ -21,8 +23,10 @@ type ingress struct{}
 
 //定义列表的返回内容，Items是ingress元素列表，Total为ingress元素数量
 type IngressesResp struct {
-	Items []nwv1.Ingress `json:"items"`
-	Total int            `json:"total"`
+	Items       []nwv1.Ingress    `json:"items"`
+	Total       int               `json:"total"`
+	Facets      []*NamespaceFacet `json:"facets"`
+	SortColumns []string          `json:"sort_columns"`
 }
 
 func (s *ingress) toCells(std []nwv1.Ingress) []DataCell {
@@ -51,15 +55,16 @@ type HttpPath struct {
 //定义IngressCreate结构体，用于创建ingress需要的参数属性的定义
 type IngressCreate struct {
 	Name      string                 `json:"name"`
+	Cluster   string                 `json:"cluster"`
 	Namespace string                 `json:"namespace"`
 	Label     map[string]string      `json:"label"`
 	Hosts     map[string][]*HttpPath `json:"hosts"`
 }
 
 //获取ingress列表，支持过滤、排序、分页
-func (i *ingress) GetIngresses(filterName, namespace string, limit, page int) (ingressesResp *IngressesResp, err error) {
+func (i *ingress) GetIngresses(client *kubernetes.Clientset, filter *FilterQuery, sort *SortQuery, namespace string, limit, page int) (ingressesResp *IngressesResp, err error) {
 	//获取ingressList类型的ingress列表
-	ingressList, err := K8s.ClientSet.NetworkingV1().Ingresses(namespace).List(context.TODO(), metav1.ListOptions{})
+	ingressList, err := i.list(client, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取Ingress列表失败，" + err.Error()))
 		return nil, errors.New("获取Ingress列表失败，" + err.Error())
@@ -68,9 +73,8 @@ func (i *ingress) GetIngresses(filterName, namespace string, limit, page int) (i
 	selectableData := &dataSelector{
 		GenericDataList: i.toCells(ingressList.Items),
 		dataSelectQuery: &DataSelectQuery{
-			FilterQuery: &FilterQuery{
-				Name: filterName,
-			},
+			FilterQuery: filter,
+			SortQuery:   sort,
 			PaginateQuery: &PaginateQuery{
 				Limit: limit,
 				Page:  page,
@@ -79,18 +83,22 @@ func (i *ingress) GetIngresses(filterName, namespace string, limit, page int) (i
 	}
 	filtered := selectableData.Filter()
 	total := len(filtered.GenericDataList)
+	//统计每个namespace的数量，需要在分页之前
+	facets := filtered.Facets()
 	data := filtered.Sort().Paginate()
 	//将[]DataCell类型的ingress列表转为v1.ingress列表
 	ingresses := i.fromCells(data.GenericDataList)
 	return &IngressesResp{
-		Items: ingresses,
-		Total: total,
+		Items:       ingresses,
+		Total:       total,
+		Facets:      facets,
+		SortColumns: IngressSortColumns,
 	}, nil
 }
 
 //获取ingress详情
-func (i *ingress) GetIngressDetail(ingressName, namespace string) (ingress *nwv1.Ingress, err error) {
-	ingress, err = K8s.ClientSet.NetworkingV1().Ingresses(namespace).Get(context.TODO(), ingressName, metav1.GetOptions{})
+func (i *ingress) GetIngressDetail(client *kubernetes.Clientset, ingressName, namespace string) (ingress *nwv1.Ingress, err error) {
+	ingress, err = i.get(client, ingressName, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取Ingress详情失败，" + err.Error()))
 		return nil, errors.New("获取Ingress详情失败，" + err.Error())
@@ -99,7 +107,7 @@ func (i *ingress) GetIngressDetail(ingressName, namespace string) (ingress *nwv1
 }
 
 //创建ingress，接收IngressCreate对象
-func (i *ingress) CreateIngress(data *IngressCreate) (err error) {
+func (i *ingress) CreateIngress(client *kubernetes.Clientset, data *IngressCreate) (err error) {
 	//声明nwv1.IngressRule和nwv1.HTTPIngressPath变量，后面组装数据用到
 	var ingressRules []nwv1.IngressRule
 	var httpIngressPATHs []nwv1.HTTPIngressPath
@@ -148,7 +156,7 @@ func (i *ingress) CreateIngress(data *IngressCreate) (err error) {
 	//将ingressRules对象加入到ingress的规则中
 	ingress.Spec.Rules = ingressRules
 	//创建ingress
-	_, err = K8s.ClientSet.NetworkingV1().Ingresses(data.Namespace).Create(context.TODO(), ingress, metav1.CreateOptions{})
+	_, err = client.NetworkingV1().Ingresses(data.Namespace).Create(context.TODO(), ingress, metav1.CreateOptions{})
 	if err != nil {
 		logger.Error(errors.New("创建Ingress失败，" + err.Error()))
 		return errors.New("创建Ingress失败，" + err.Error())
@@ -157,27 +165,53 @@ func (i *ingress) CreateIngress(data *IngressCreate) (err error) {
 }
 
 //删除ingress
-func (i *ingress) DeleteIngress(ingressName, namespace string) (err error) {
-	err = K8s.ClientSet.NetworkingV1().Ingresses(namespace).Delete(context.TODO(), ingressName, metav1.DeleteOptions{})
+func (i *ingress) DeleteIngress(client *kubernetes.Clientset, ingressName, namespace string) (err error) {
+	err = client.NetworkingV1().Ingresses(namespace).Delete(context.TODO(), ingressName, metav1.DeleteOptions{})
 	if err != nil {
 		logger.Error(errors.New("删除Ingress失败，" + err.Error()))
-		return errors.New("删除Ingress失败，" + err.Error())
+		return fmt.Errorf("删除Ingress失败，%w", err)
 	}
 	return nil
 }
 
 //更新ingress
-func (i *ingress) UpdateIngress(namespace, content string) (err error) {
+func (i *ingress) UpdateIngress(client *kubernetes.Clientset, namespace, content string) (err error) {
 	var ingress = &nwv1.Ingress{}
 	err = json.Unmarshal([]byte(content), ingress)
 	if err != nil {
 		logger.Error(errors.New("反序列化失败，" + err.Error()))
 		return errors.New("反序列化失败，" + err.Error())
 	}
-	_, err = K8s.ClientSet.NetworkingV1().Ingresses(namespace).Update(context.TODO(), ingress, metav1.UpdateOptions{})
+	_, err = client.NetworkingV1().Ingresses(namespace).Update(context.TODO(), ingress, metav1.UpdateOptions{})
 	if err != nil {
 		logger.Error(errors.New("更新ingress失败，" + err.Error()))
 		return errors.New("更新ingress失败，" + err.Error())
 	}
 	return nil
 }
+
+//获取ingress列表，缓存可用时从缓存中读取，否则请求apiserver
+func (i *ingress) list(client *kubernetes.Clientset, namespace string) (*nwv1.IngressList, error) {
+	objs, ok := K8s.CacheList(client, "ingresses", namespace)
+	if !ok {
+		return client.NetworkingV1().Ingresses(namespace).List(context.TODO(), metav1.ListOptions{})
+	}
+	list := &nwv1.IngressList{Items: make([]nwv1.Ingress, len(objs))}
+	for i, obj := range objs {
+		list.Items[i] = *obj.(*nwv1.Ingress)
+	}
+	return list, nil
+}
+
+//获取单个ingress，缓存可用时从缓存中读取，否则请求apiserver
+func (i *ingress) get(client *kubernetes.Clientset, name, namespace string) (*nwv1.Ingress, error) {
+	obj, ok, err := K8s.CacheGet(client, "ingresses", namespace, name)
+	if !ok {
+		return client.NetworkingV1().Ingresses(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	//缓存中的对象是共享的，返回副本避免被修改
+	return obj.(*nwv1.Ingress).DeepCopy(), nil
+}
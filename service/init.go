@@ -1,10 +1,15 @@
 package service
 
 import (
+	"encoding/json"
+	"errors"
 	"k8s-platform/config"
+	"k8s-platform/dao"
+	"sync"
 
 	"github.com/wonderivan/logger"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
@@ -12,22 +17,128 @@ import (
  * @author 王子龙
  * 时间：2022/9/21 21:43
  */
+//k8s结构体用于管理多集群的客户端
+//ClientMap的key为集群名，value为该集群的clientSet
+//KubeConfMap的key为集群名，value为该集群的rest配置，exec等需要SPDY连接的场景会用到
+//CacheMap的key为集群名，value为该集群的informer缓存，列表和详情接口从缓存中读取
 type k8s struct {
-	ClientSet *kubernetes.Clientset
+	ClientMap   map[string]*kubernetes.Clientset
+	KubeConfMap map[string]*rest.Config
+	CacheMap    map[string]*clusterCache
+	lock        sync.RWMutex
 }
 
 var K8s k8s
 
+//初始化config.Kubeconfigs中配置的集群，以及数据库中保存的集群
+//数据库中的集群依赖db.GORM，需要在db.Init之后调用
 func (k *k8s) Init() {
-	conf, err := clientcmd.BuildConfigFromFlags("", config.Kubeconfig)
+	kubeconfigs := map[string]string{}
+	if config.Kubeconfigs != "" {
+		if err := json.Unmarshal([]byte(config.Kubeconfigs), &kubeconfigs); err != nil {
+			panic("反序列化Kubeconfigs失败，" + err.Error())
+		}
+	}
+	for cluster, path := range kubeconfigs {
+		conf, err := clientcmd.BuildConfigFromFlags("", path)
+		if err != nil {
+			panic("创建k8s配置失败，" + err.Error())
+		}
+		if err = k.Register(cluster, conf); err != nil {
+			panic(err.Error())
+		}
+	}
+	clusters, err := dao.Cluster.GetAll()
 	if err != nil {
-		panic("创建k8s配置失败，" + err.Error())
+		panic(err.Error())
+	}
+	for _, cluster := range clusters {
+		//单个集群的kubeconfig失效不影响其他集群的初始化
+		conf, err := Cluster.decrypt(cluster)
+		if err != nil {
+			logger.Error(err.Error())
+			continue
+		}
+		if err = k.Register(cluster.Name, conf); err != nil {
+			logger.Error("注册集群" + cluster.Name + "失败，" + err.Error())
+		}
 	}
+}
+
+//注册集群，根据rest配置生成clientSet并启动informer缓存，同名集群会被覆盖
+func (k *k8s) Register(cluster string, conf *rest.Config) (err error) {
 	clientSet, err := kubernetes.NewForConfig(conf)
 	if err != nil {
-		panic("创建K8s clientSet失败，" + err.Error())
-	} else {
-		logger.Info("创建k8s clientSet成功")
+		logger.Error(errors.New("创建K8s clientSet失败，" + err.Error()))
+		return errors.New("创建K8s clientSet失败，" + err.Error())
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if k.ClientMap == nil {
+		k.ClientMap = map[string]*kubernetes.Clientset{}
+		k.KubeConfMap = map[string]*rest.Config{}
+		k.CacheMap = map[string]*clusterCache{}
+	}
+	if old, ok := k.CacheMap[cluster]; ok {
+		old.stop()
+	}
+	k.ClientMap[cluster] = clientSet
+	k.KubeConfMap[cluster] = conf
+	k.CacheMap[cluster] = newClusterCache(cluster, clientSet)
+	logger.Info("创建k8s clientSet成功，集群：%s", cluster)
+	return nil
+}
+
+//注销集群
+func (k *k8s) Unregister(cluster string) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if c, ok := k.CacheMap[cluster]; ok {
+		c.stop()
+	}
+	delete(k.ClientMap, cluster)
+	delete(k.KubeConfMap, cluster)
+	delete(k.CacheMap, cluster)
+}
+
+//根据集群名获取clientSet，集群名为空时使用默认集群
+func (k *k8s) GetClient(cluster string) (*kubernetes.Clientset, error) {
+	cluster = k.clusterName(cluster)
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	client, ok := k.ClientMap[cluster]
+	if !ok {
+		return nil, errors.New("集群" + cluster + "不存在")
+	}
+	return client, nil
+}
+
+//根据集群名获取rest配置，集群名为空时使用默认集群
+func (k *k8s) GetConfig(cluster string) (*rest.Config, error) {
+	cluster = k.clusterName(cluster)
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	conf, ok := k.KubeConfMap[cluster]
+	if !ok {
+		return nil, errors.New("集群" + cluster + "不存在")
+	}
+	return conf, nil
+}
+
+//获取已注册的集群名列表
+func (k *k8s) GetClusterNames() (names []string) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	for name := range k.ClientMap {
+		names = append(names, name)
+	}
+	return names
+}
+
+//集群名为空时使用默认集群
+func (k *k8s) clusterName(cluster string) string {
+	if cluster == "" {
+		return config.DefaultCluster
 	}
-	k.ClientSet = clientSet
+	return cluster
 }
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"k8s-platform/config"
+	"net"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var LDAP ldapAuthenticator
+
+//LDAP认证，先使用config.LDAPBindDN搜索用户条目，再使用用户的DN和密码bind校验密码
+//校验通过后根据用户所属的用户组同步平台用户和角色绑定
+type ldapAuthenticator struct{}
+
+func (l *ldapAuthenticator) Authenticate(username, password string) (string, error) {
+	conn, err := ldap.DialURL(config.LDAPURL, ldap.DialWithDialer(&net.Dialer{Timeout: config.LDAPTimeout}))
+	if err != nil {
+		return "", errors.New("连接LDAP服务器失败，" + err.Error())
+	}
+	defer conn.Close()
+	conn.SetTimeout(config.LDAPTimeout)
+	if config.LDAPBindDN != "" {
+		if err = conn.Bind(config.LDAPBindDN, config.LDAPBindPwd); err != nil {
+			return "", errors.New("LDAP bind失败，" + err.Error())
+		}
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		config.LDAPBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(config.LDAPUserFilter, ldap.EscapeFilter(username)),
+		[]string{config.LDAPGroupAttr}, nil,
+	))
+	if err != nil {
+		return "", errors.New("LDAP搜索用户失败，" + err.Error())
+	}
+	//用户不存在或者匹配到多个用户都视为认证失败
+	if len(result.Entries) != 1 {
+		return "", errInvalidCredentials
+	}
+	entry := result.Entries[0]
+	//使用用户自己的DN和密码bind，成功即表示密码正确
+	if err = conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return "", errInvalidCredentials
+		}
+		return "", errors.New("LDAP校验密码失败，" + err.Error())
+	}
+	groups := entry.GetAttributeValues(config.LDAPGroupAttr)
+	if config.LDAPGroupFilter != "" {
+		//用户bind之后可能没有搜索权限，重新使用LDAPBindDN bind
+		if config.LDAPBindDN != "" {
+			if err = conn.Bind(config.LDAPBindDN, config.LDAPBindPwd); err != nil {
+				return "", errors.New("LDAP bind失败，" + err.Error())
+			}
+		}
+		baseDN := config.LDAPGroupBaseDN
+		if baseDN == "" {
+			baseDN = config.LDAPBaseDN
+		}
+		groupResult, err := conn.Search(ldap.NewSearchRequest(
+			baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+			fmt.Sprintf(config.LDAPGroupFilter, ldap.EscapeFilter(entry.DN)),
+			[]string{"dn"}, nil,
+		))
+		if err != nil {
+			return "", errors.New("LDAP搜索用户组失败，" + err.Error())
+		}
+		for _, group := range groupResult.Entries {
+			groups = append(groups, group.DN)
+		}
+	}
+	var groupRoles []*GroupRole
+	if config.LDAPGroupRoles != "" {
+		if err = json.Unmarshal([]byte(config.LDAPGroupRoles), &groupRoles); err != nil {
+			return "", errors.New("解析ldap_group_roles失败，" + err.Error())
+		}
+	}
+	//DN不区分大小写，统一转为小写后再匹配
+	for i := range groups {
+		groups[i] = strings.ToLower(groups[i])
+	}
+	for _, gr := range groupRoles {
+		gr.Group = strings.ToLower(gr.Group)
+	}
+	//首次登录时自动创建用户，之后每次登录重新同步角色绑定
+	if err = User.SyncExternal(username, SourceLDAP, groups, groupRoles); err != nil {
+		return "", err
+	}
+	return username, nil
+}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"k8s-platform/config"
+	"k8s-platform/dao"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+//进程内的LDAP服务器，只实现bind、search和unbind，只有服务账号可以搜索
+type testLDAP struct {
+	listener net.Listener
+	lock     sync.Mutex
+	entries  []*testLDAPEntry
+}
+
+type testLDAPEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+const (
+	testLDAPAdminDN  = "cn=admin,dc=example,dc=org"
+	testLDAPAdminPwd = "admin-password"
+)
+
+func newTestLDAP(t *testing.T) *testLDAP {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &testLDAP{listener: listener}
+	l.entries = []*testLDAPEntry{
+		{dn: testLDAPAdminDN, password: testLDAPAdminPwd, attrs: map[string][]string{}},
+		{dn: "uid=alice,ou=people,dc=example,dc=org", password: "alice-password", attrs: map[string][]string{
+			"uid": {"alice"}, "memberOf": {"CN=Dev,ou=groups,dc=example,dc=org"},
+		}},
+		{dn: "uid=bob,ou=people,dc=example,dc=org", password: "bob-password", attrs: map[string][]string{
+			"uid": {"bob"},
+		}},
+		{dn: "uid=carol,ou=people,dc=example,dc=org", password: "carol-password", attrs: map[string][]string{
+			"uid": {"carol"},
+		}},
+		{dn: "uid=dup,ou=people,dc=example,dc=org", password: "dup-password", attrs: map[string][]string{"uid": {"dup"}}},
+		{dn: "uid=dup,ou=staff,dc=example,dc=org", password: "dup-password", attrs: map[string][]string{"uid": {"dup"}}},
+		{dn: "cn=ops,ou=groups,dc=example,dc=org", attrs: map[string][]string{
+			"cn": {"ops"}, "member": {"uid=bob,ou=people,dc=example,dc=org"},
+		}},
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go l.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return l
+}
+
+func (l *testLDAP) url() string {
+	return "ldap://" + l.listener.Addr().String()
+}
+
+func (l *testLDAP) serve(conn net.Conn) {
+	defer conn.Close()
+	boundDN := ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn, _ := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if entry := l.find(dn); entry != nil && entry.password != "" && entry.password == password {
+				code = ldap.LDAPResultSuccess
+				boundDN = dn
+			} else {
+				boundDN = ""
+			}
+			conn.Write(ldapResponse(id, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			if boundDN != testLDAPAdminDN {
+				conn.Write(ldapResponse(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights).Bytes())
+				continue
+			}
+			baseDN, _ := op.Children[0].Value.(string)
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			var attributes []string
+			for _, attr := range op.Children[7].Children {
+				attributes = append(attributes, attr.Value.(string))
+			}
+			for _, entry := range l.search(baseDN, filter) {
+				conn.Write(ldapEntryPacket(id, entry, attributes).Bytes())
+			}
+			conn.Write(ldapResponse(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func (l *testLDAP) find(dn string) *testLDAPEntry {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, entry := range l.entries {
+		if strings.EqualFold(entry.dn, dn) {
+			return entry
+		}
+	}
+	return nil
+}
+
+//只支持(attr=value)形式的过滤条件
+func (l *testLDAP) search(baseDN, filter string) (entries []*testLDAPEntry) {
+	attr, value, ok := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(filter, "("), ")"), "=")
+	if !ok {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, entry := range l.entries {
+		if !strings.HasSuffix(strings.ToLower(entry.dn), ","+strings.ToLower(baseDN)) {
+			continue
+		}
+		for _, v := range entry.attrs[attr] {
+			if strings.EqualFold(v, value) {
+				entries = append(entries, entry)
+				break
+			}
+		}
+	}
+	return entries
+}
+
+func (l *testLDAP) setAttr(dn, attr string, values []string) {
+	entry := l.find(dn)
+	l.lock.Lock()
+	entry.attrs[attr] = values
+	l.lock.Unlock()
+}
+
+func ldapEnvelope(id int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	packet.AppendChild(op)
+	return packet
+}
+
+func ldapResponse(id int64, tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return ldapEnvelope(id, op)
+}
+
+func ldapEntryPacket(id int64, entry *testLDAPEntry, attributes []string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, ""))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for _, name := range attributes {
+		values, ok := entry.attrs[name]
+		if !ok {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return ldapEnvelope(id, op)
+}
+
+func setupTestLDAP(t *testing.T, groupFilter string) *testLDAP {
+	setupTestDB(t)
+	server := newTestLDAP(t)
+	config.LDAPURL = server.url()
+	config.LDAPBindDN = testLDAPAdminDN
+	config.LDAPBindPwd = testLDAPAdminPwd
+	config.LDAPBaseDN = "dc=example,dc=org"
+	config.LDAPUserFilter = "(uid=%s)"
+	config.LDAPGroupAttr = "memberOf"
+	config.LDAPGroupBaseDN = "ou=groups,dc=example,dc=org"
+	config.LDAPGroupFilter = groupFilter
+	config.LDAPGroupRoles = `[
+		{"group":"cn=dev,ou=groups,dc=example,dc=org","role":"developer","namespace":"dev"},
+		{"group":"CN=Ops,ou=groups,dc=example,dc=org","role":"admin"}
+	]`
+	t.Cleanup(func() {
+		config.LDAPURL = ""
+		config.LDAPGroupFilter = ""
+		config.LDAPGroupRoles = ""
+	})
+	return server
+}
+
+//返回用户的角色列表
+func userRoles(t *testing.T, username string) (roles []string) {
+	bindings, err := dao.RoleBinding.GetByUsername(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, binding := range bindings {
+		roles = append(roles, binding.Role+"/"+binding.Namespace)
+	}
+	return roles
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	server := setupTestLDAP(t, "")
+	username, err := LDAP.Authenticate("alice", "alice-password")
+	if err != nil || username != "alice" {
+		t.Fatalf("LDAP登录失败，%v", err)
+	}
+	user, err := dao.User.GetByUsername("alice")
+	if err != nil || user == nil || user.Source != SourceLDAP {
+		t.Fatalf("应该自动创建LDAP用户，%+v，%v", user, err)
+	}
+	//memberOf中的用户组DN不区分大小写匹配
+	if roles := userRoles(t, "alice"); len(roles) != 1 || roles[0] != RoleDeveloper+"/dev" {
+		t.Fatalf("alice的角色不正确，%v", roles)
+	}
+	//没有配置用户组过滤条件时，只使用memberOf
+	if _, err = LDAP.Authenticate("bob", "bob-password"); err != nil {
+		t.Fatalf("LDAP登录失败，%v", err)
+	}
+	if roles := userRoles(t, "bob"); len(roles) != 0 {
+		t.Fatalf("bob不应该有角色，%v", roles)
+	}
+	//再次登录时重新同步角色绑定
+	server.setAttr("uid=alice,ou=people,dc=example,dc=org", "memberOf", nil)
+	if _, err = LDAP.Authenticate("alice", "alice-password"); err != nil {
+		t.Fatalf("LDAP登录失败，%v", err)
+	}
+	if roles := userRoles(t, "alice"); len(roles) != 0 {
+		t.Fatalf("移出用户组后alice不应该再有角色，%v", roles)
+	}
+}
+
+//用户组过滤条件：使用用户的DN搜索用户组，用户bind之后没有搜索权限，需要重新使用服务账号bind
+func TestLDAPGroupFilter(t *testing.T) {
+	setupTestLDAP(t, "(member=%s)")
+	if _, err := LDAP.Authenticate("bob", "bob-password"); err != nil {
+		t.Fatalf("LDAP登录失败，%v", err)
+	}
+	if roles := userRoles(t, "bob"); len(roles) != 1 || roles[0] != RoleAdmin+"/" {
+		t.Fatalf("bob应该通过用户组过滤条件获得admin角色，%v", roles)
+	}
+	if _, err := LDAP.Authenticate("alice", "alice-password"); err != nil {
+		t.Fatalf("LDAP登录失败，%v", err)
+	}
+	if roles := userRoles(t, "alice"); len(roles) != 1 || roles[0] != RoleDeveloper+"/dev" {
+		t.Fatalf("alice的角色不正确，%v", roles)
+	}
+}
+
+func TestLDAPInvalidCredentials(t *testing.T) {
+	setupTestLDAP(t, "")
+	cases := map[string]string{
+		"alice":   "wrong-password",
+		"nobody":  "nobody-password",
+		"dup":     "dup-password",
+		"alice)(": "alice-password",
+	}
+	for username, password := range cases {
+		if _, err := LDAP.Authenticate(username, password); err != errInvalidCredentials {
+			t.Errorf("%s应该返回用户名或密码错误，实际返回%v", username, err)
+		}
+	}
+	if user, _ := dao.User.GetByUsername("alice"); user != nil {
+		t.Fatal("认证失败时不能创建用户")
+	}
+}
+
+//已存在同名的本地用户时，LDAP用户不能登录，也不能修改该用户的角色绑定
+func TestLDAPSourceMismatch(t *testing.T) {
+	setupTestLDAP(t, "")
+	if err := User.CreateUser("carol", "local-password"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LDAP.Authenticate("carol", "carol-password")
+	if err == nil || !strings.Contains(err.Error(), SourceLocal) {
+		t.Fatalf("来源不一致的用户应该被拒绝，%v", err)
+	}
+	//按认证后端依次尝试时也不能登录
+	config.AuthBackends = "local,ldap"
+	t.Cleanup(func() { config.AuthBackends = SourceLocal })
+	if _, err = Login.Auth("carol", "carol-password"); err == nil {
+		t.Fatal("来源不一致的用户不能通过LDAP登录")
+	}
+	user, err := dao.User.GetByUsername("carol")
+	if err != nil || user.Source != SourceLocal {
+		t.Fatalf("本地用户不应该被修改，%+v，%v", user, err)
+	}
+}
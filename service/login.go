@@ -3,20 +3,79 @@ package service
 import (
 	"errors"
 	"k8s-platform/config"
+	"k8s-platform/dao"
+	"strings"
 
 	"github.com/wonderivan/logger"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var Login login
 
 type login struct{}
 
-//验证账号密码
-func (l *login) Auth(username, password string) (err error) {
-	if username == config.AdminUser && password == config.AdminPwd {
-		return nil
-	} else {
-		logger.Error("登录失败, 用户名或密码错误")
-		return errors.New("登录失败, 用户名或密码错误")
+//Authenticator为用户名密码登录的认证后端，校验通过后返回平台的用户名
+//返回errInvalidCredentials表示用户不存在或密码错误，会继续尝试下一个认证后端
+type Authenticator interface {
+	Authenticate(username, password string) (string, error)
+}
+
+var (
+	errInvalidCredentials = errors.New("用户名或密码错误")
+	errUserDisabled       = errors.New("用户已被禁用")
+)
+
+//已注册的认证后端，key为config.AuthBackends中的名称
+var authenticators = map[string]Authenticator{
+	SourceLocal: localAuthenticator{},
+	SourceLDAP:  &LDAP,
+}
+
+//验证账号密码，按config.AuthBackends的顺序依次尝试各认证后端，验证通过后签发token
+func (l *login) Auth(username, password string) (resp *TokenResp, err error) {
+	if username == "" || password == "" {
+		return nil, errors.New("登录失败, 用户名或密码错误")
+	}
+	for _, name := range strings.Split(config.AuthBackends, ",") {
+		name = strings.TrimSpace(name)
+		authenticator, ok := authenticators[name]
+		if !ok {
+			logger.Error("未知的认证后端：" + name)
+			continue
+		}
+		user, err := authenticator.Authenticate(username, password)
+		if err == errInvalidCredentials {
+			continue
+		}
+		if err == errUserDisabled {
+			logger.Error("登录失败, 用户" + username + "已被禁用")
+			return nil, errors.New("登录失败, 用户已被禁用")
+		}
+		//认证后端不可用时继续尝试下一个，避免单个后端故障导致无法登录
+		if err != nil {
+			logger.Error("认证后端%s校验失败，%s", name, err.Error())
+			continue
+		}
+		return Token.Issue(user)
+	}
+	//用户不存在和密码错误返回相同的提示，避免泄露用户是否存在
+	logger.Error("登录失败, 用户名或密码错误")
+	return nil, errors.New("登录失败, 用户名或密码错误")
+}
+
+//本地用户认证，校验数据库中bcrypt哈希后的密码
+type localAuthenticator struct{}
+
+func (localAuthenticator) Authenticate(username, password string) (string, error) {
+	user, err := dao.User.GetByUsername(username)
+	if err != nil {
+		return "", err
+	}
+	if user == nil || !isLocalUser(user) || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return "", errInvalidCredentials
+	}
+	if user.Disabled {
+		return "", errUserDisabled
 	}
+	return user.Username, nil
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/wonderivan/logger"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 /**
@@ -18,8 +19,9 @@ type namespace struct{}
 var Namespace namespace
 
 type NamespacesResp struct {
-	Items []corev1.Namespace `json:"items"`
-	Total int                `json:"total"`
+	Items       []corev1.Namespace `json:"items"`
+	Total       int                `json:"total"`
+	SortColumns []string           `json:"sort_columns"`
 }
 
 func (n *namespace) toCells(std []corev1.Namespace) []DataCell {
@@ -40,18 +42,19 @@ func (n *namespace) fromCells(cells []DataCell) []corev1.Namespace {
 }
 
 //获取namespace列表，支持过滤、排序、分页
-func (n *namespace) GetNamespaces(filterName string, limit, page int) (namespaceResp *NamespacesResp, err error) {
+func (n *namespace) GetNamespaces(client *kubernetes.Clientset, filter *FilterQuery, sort *SortQuery, allowed []string, limit, page int) (namespaceResp *NamespacesResp, err error) {
 	//获取namespaceList类型的namespace列表
-	namespaceList, err := K8s.ClientSet.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	namespaceList, err := n.list(client)
 	if err != nil {
 		logger.Error(errors.New("获取Namespace列表失败, " + err.Error()))
 		return nil, errors.New("获取Namespace列表失败, " + err.Error())
 	}
 	//将namespaceList中的namespace列表(Items)，放进dataselector对象中，进行排序
 	selectableData := &dataSelector{
-		GenericDataList: n.toCells(namespaceList.Items),
+		GenericDataList: n.toCells(filterNamespaces(namespaceList.Items, allowed)),
 		dataSelectQuery: &DataSelectQuery{
-			FilterQuery: &FilterQuery{Name: filterName},
+			FilterQuery: filter,
+			SortQuery:   sort,
 			PaginateQuery: &PaginateQuery{
 				Limit: limit,
 				Page:  page,
@@ -64,14 +67,15 @@ func (n *namespace) GetNamespaces(filterName string, limit, page int) (namespace
 	//将[]DataCell类型的namespace列表转为v1.namespace列表
 	namespaces := n.fromCells(data.GenericDataList)
 	return &NamespacesResp{
-		Items: namespaces,
-		Total: total,
+		Items:       namespaces,
+		Total:       total,
+		SortColumns: NamespaceSortColumns,
 	}, nil
 }
 
 //获取namespace详情
-func (n *namespace) GetNamespaceDetail(namespaceName string) (namespace *corev1.Namespace, err error) {
-	namespace, err = K8s.ClientSet.CoreV1().Namespaces().Get(context.TODO(), namespaceName, metav1.GetOptions{})
+func (n *namespace) GetNamespaceDetail(client *kubernetes.Clientset, namespaceName string) (namespace *corev1.Namespace, err error) {
+	namespace, err = n.get(client, namespaceName)
 	if err != nil {
 		logger.Error(errors.New("获取Namespace详情失败，" + err.Error()))
 		return nil, errors.New("获取Namespace详情失败，" + err.Error())
@@ -80,11 +84,51 @@ func (n *namespace) GetNamespaceDetail(namespaceName string) (namespace *corev1.
 }
 
 //删除namespace
-func (n *namespace) DeleteNamespace(namespaceName string) (err error) {
-	err = K8s.ClientSet.CoreV1().Namespaces().Delete(context.TODO(), namespaceName, metav1.DeleteOptions{})
+func (n *namespace) DeleteNamespace(client *kubernetes.Clientset, namespaceName string) (err error) {
+	err = client.CoreV1().Namespaces().Delete(context.TODO(), namespaceName, metav1.DeleteOptions{})
 	if err != nil {
 		logger.Error("删除Namespace失败，" + err.Error())
 		return errors.New("删除Namespace失败，" + err.Error())
 	}
 	return nil
 }
+
+//按有权限的namespace过滤，allowed为nil表示不限制
+func filterNamespaces(namespaces []corev1.Namespace, allowed []string) []corev1.Namespace {
+	if allowed == nil {
+		return namespaces
+	}
+	filtered := []corev1.Namespace{}
+	for _, namespace := range namespaces {
+		if contains(allowed, namespace.Name) {
+			filtered = append(filtered, namespace)
+		}
+	}
+	return filtered
+}
+
+//获取namespace列表，缓存可用时从缓存中读取，否则请求apiserver
+func (n *namespace) list(client *kubernetes.Clientset) (*corev1.NamespaceList, error) {
+	objs, ok := K8s.CacheList(client, "namespaces", "")
+	if !ok {
+		return client.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	}
+	list := &corev1.NamespaceList{Items: make([]corev1.Namespace, len(objs))}
+	for i, obj := range objs {
+		list.Items[i] = *obj.(*corev1.Namespace)
+	}
+	return list, nil
+}
+
+//获取单个namespace，缓存可用时从缓存中读取，否则请求apiserver
+func (n *namespace) get(client *kubernetes.Clientset, name string) (*corev1.Namespace, error) {
+	obj, ok, err := K8s.CacheGet(client, "namespaces", "", name)
+	if !ok {
+		return client.CoreV1().Namespaces().Get(context.TODO(), name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	//缓存中的对象是共享的，返回副本避免被修改
+	return obj.(*corev1.Namespace).DeepCopy(), nil
+}
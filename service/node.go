@@ -7,6 +7,7 @@ import (
 	"github.com/wonderivan/logger"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 var Node node
@@ -14,14 +15,15 @@ var Node node
 type node struct{}
 
 type NodesResp struct {
-	Items []corev1.Node `json:"items"`
-	Total int           `json:"total"`
+	Items       []corev1.Node `json:"items"`
+	Total       int           `json:"total"`
+	SortColumns []string      `json:"sort_columns"`
 }
 
 //获取node列表，支持过滤、排序、分页
-func (n *node) GetNodes(filterName string, limit, page int) (nodesResp *NodesResp, err error) {
+func (n *node) GetNodes(client *kubernetes.Clientset, filter *FilterQuery, sort *SortQuery, limit, page int) (nodesResp *NodesResp, err error) {
 	//获取nodeList类型的node列表
-	nodeList, err := K8s.ClientSet.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	nodeList, err := n.list(client)
 	if err != nil {
 		logger.Error(errors.New("获取Node列表失败, " + err.Error()))
 		return nil, errors.New("获取Node列表失败, " + err.Error())
@@ -30,7 +32,8 @@ func (n *node) GetNodes(filterName string, limit, page int) (nodesResp *NodesRes
 	selectableData := &dataSelector{
 		GenericDataList: n.toCells(nodeList.Items),
 		dataSelectQuery: &DataSelectQuery{
-			FilterQuery: &FilterQuery{Name: filterName},
+			FilterQuery: filter,
+			SortQuery:   sort,
 			PaginateQuery: &PaginateQuery{
 				Limit: limit,
 				Page:  page,
@@ -46,14 +49,15 @@ func (n *node) GetNodes(filterName string, limit, page int) (nodesResp *NodesRes
 	nodes := n.fromCells(data.GenericDataList)
 
 	return &NodesResp{
-		Items: nodes,
-		Total: total,
+		Items:       nodes,
+		Total:       total,
+		SortColumns: NodeSortColumns,
 	}, nil
 }
 
 //获取node详情
-func (n *node) GetNodeDetail(nodeName string) (node *corev1.Node, err error) {
-	node, err = K8s.ClientSet.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+func (n *node) GetNodeDetail(client *kubernetes.Clientset, nodeName string) (node *corev1.Node, err error) {
+	node, err = n.get(client, nodeName)
 	if err != nil {
 		logger.Error(errors.New("获取Node详情失败, " + err.Error()))
 		return nil, errors.New("获取Node详情失败, " + err.Error())
@@ -78,3 +82,29 @@ func (n *node) fromCells(cells []DataCell) []corev1.Node {
 
 	return nodes
 }
+
+//获取node列表，缓存可用时从缓存中读取，否则请求apiserver
+func (n *node) list(client *kubernetes.Clientset) (*corev1.NodeList, error) {
+	objs, ok := K8s.CacheList(client, "nodes", "")
+	if !ok {
+		return client.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	}
+	list := &corev1.NodeList{Items: make([]corev1.Node, len(objs))}
+	for i, obj := range objs {
+		list.Items[i] = *obj.(*corev1.Node)
+	}
+	return list, nil
+}
+
+//获取单个node，缓存可用时从缓存中读取，否则请求apiserver
+func (n *node) get(client *kubernetes.Clientset, name string) (*corev1.Node, error) {
+	obj, ok, err := K8s.CacheGet(client, "nodes", "", name)
+	if !ok {
+		return client.CoreV1().Nodes().Get(context.TODO(), name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	//缓存中的对象是共享的，返回副本避免被修改
+	return obj.(*corev1.Node).DeepCopy(), nil
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"k8s-platform/config"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/wonderivan/logger"
+	"golang.org/x/oauth2"
+)
+
+var OIDC oidc
+
+//oidc结构体实现OIDC授权码模式登录
+//provider和keys在第一次使用时通过discovery接口获取并缓存，keys中找不到id_token的kid时重新获取
+//states保存登录跳转时生成的state和nonce，回调时校验，防止CSRF和id_token重放
+type oidc struct {
+	lock     sync.Mutex
+	provider *oidcProvider
+	keys     map[string]interface{}
+	states   map[string]*oidcState
+}
+
+//discovery接口返回的身份提供方信息
+type oidcProvider struct {
+	Issuer   string `json:"issuer"`
+	AuthURL  string `json:"authorization_endpoint"`
+	TokenURL string `json:"token_endpoint"`
+	JWKSURL  string `json:"jwks_uri"`
+}
+
+type oidcState struct {
+	nonce    string
+	expireAt time.Time
+}
+
+//jwks接口返回的单个公钥，只支持RSA和EC公钥
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+//登录跳转的state有效期，也是保存state的cookie的有效期
+const OIDCStateExpire = 10 * time.Minute
+
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+//是否启用了OIDC登录
+func (o *oidc) Enabled() bool {
+	return config.OIDCIssuer != ""
+}
+
+//生成跳转到身份提供方的登录地址，返回的state需要由controller写入发起登录的浏览器的cookie
+func (o *oidc) LoginURL() (url, state string, err error) {
+	if !o.Enabled() {
+		return "", "", errors.New("未启用OIDC登录")
+	}
+	provider, err := o.getProvider()
+	if err != nil {
+		return "", "", err
+	}
+	state, err = randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	o.lock.Lock()
+	now := time.Now()
+	if o.states == nil {
+		o.states = map[string]*oidcState{}
+	}
+	//顺便清理过期的state，避免未完成的登录一直占用内存
+	for k, v := range o.states {
+		if now.After(v.expireAt) {
+			delete(o.states, k)
+		}
+	}
+	o.states[state] = &oidcState{nonce: nonce, expireAt: now.Add(OIDCStateExpire)}
+	o.lock.Unlock()
+	return o.oauth2Config(provider).AuthCodeURL(state, oauth2.SetAuthURLParam("nonce", nonce)), state, nil
+}
+
+//处理身份提供方的回调，用code换取id_token，校验后同步用户和角色，最后签发平台自己的token
+//cookieState为回调请求cookie中的state，必须与回调参数中的state一致，否则攻击者可以把自己发起登录得到的
+//code和state发给受害者，受害者打开后会登录到攻击者的账号(login CSRF)，不一致时不消耗state
+func (o *oidc) Callback(code, state, cookieState string) (resp *TokenResp, err error) {
+	if !o.Enabled() {
+		return nil, errors.New("未启用OIDC登录")
+	}
+	if cookieState == "" || subtle.ConstantTimeCompare([]byte(cookieState), []byte(state)) != 1 {
+		return nil, errors.New("OIDC登录失败，state与发起登录的浏览器不匹配，请重新登录")
+	}
+	o.lock.Lock()
+	s, ok := o.states[state]
+	delete(o.states, state)
+	o.lock.Unlock()
+	if !ok || time.Now().After(s.expireAt) {
+		return nil, errors.New("OIDC登录失败，state无效或已过期")
+	}
+	provider, err := o.getProvider()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, oidcHTTPClient)
+	token, err := o.oauth2Config(provider).Exchange(ctx, code)
+	if err != nil {
+		logger.Error("OIDC获取token失败，" + err.Error())
+		return nil, errors.New("OIDC获取token失败，" + err.Error())
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("OIDC登录失败，响应中没有id_token")
+	}
+	claims, err := o.verifyIDToken(provider, rawIDToken, s.nonce)
+	if err != nil {
+		logger.Error("OIDC校验id_token失败，" + err.Error())
+		return nil, errors.New("OIDC校验id_token失败，" + err.Error())
+	}
+	username, _ := claims[config.OIDCUsernameClaim].(string)
+	if username == "" {
+		return nil, errors.New("OIDC登录失败，id_token中没有" + config.OIDCUsernameClaim)
+	}
+	var groupRoles []*GroupRole
+	if config.OIDCGroupRoles != "" {
+		if err = json.Unmarshal([]byte(config.OIDCGroupRoles), &groupRoles); err != nil {
+			return nil, errors.New("解析oidc_group_roles失败，" + err.Error())
+		}
+	}
+	if err = User.SyncExternal(username, SourceOIDC, claimStrings(claims[config.OIDCGroupsClaim]), groupRoles); err != nil {
+		logger.Error("OIDC登录失败，" + err.Error())
+		return nil, errors.New("OIDC登录失败，" + err.Error())
+	}
+	return Token.Issue(username)
+}
+
+func (o *oidc) oauth2Config(provider *oidcProvider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     config.OIDCClientID,
+		ClientSecret: config.OIDCClientSecret,
+		RedirectURL:  config.OIDCRedirectURL,
+		Scopes:       strings.Fields(config.OIDCScopes),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  provider.AuthURL,
+			TokenURL: provider.TokenURL,
+		},
+	}
+}
+
+//获取身份提供方信息，成功后缓存
+func (o *oidc) getProvider() (provider *oidcProvider, err error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.provider != nil {
+		return o.provider, nil
+	}
+	provider = new(oidcProvider)
+	if err = getJSON(strings.TrimSuffix(config.OIDCIssuer, "/")+"/.well-known/openid-configuration", provider); err != nil {
+		logger.Error("获取OIDC配置失败，" + err.Error())
+		return nil, errors.New("获取OIDC配置失败，" + err.Error())
+	}
+	//issuer必须与配置一致，防止被引导到其他身份提供方
+	if provider.Issuer != config.OIDCIssuer {
+		return nil, errors.New("OIDC配置中的issuer与oidc_issuer不一致：" + provider.Issuer)
+	}
+	o.provider = provider
+	return provider, nil
+}
+
+//根据kid获取校验id_token的公钥，找不到时重新拉取jwks，以支持身份提供方的密钥轮换
+func (o *oidc) getKey(provider *oidcProvider, kid string) (key interface{}, err error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+	jwks := new(struct {
+		Keys []*jsonWebKey `json:"keys"`
+	})
+	if err = getJSON(provider.JWKSURL, jwks); err != nil {
+		return nil, errors.New("获取OIDC公钥失败，" + err.Error())
+	}
+	keys := map[string]interface{}{}
+	for _, jwk := range jwks.Keys {
+		k, err := jwk.publicKey()
+		if err != nil {
+			//不支持的公钥类型直接跳过，不影响其他公钥
+			logger.Warn("解析OIDC公钥%s失败，%s", jwk.Kid, err.Error())
+			continue
+		}
+		keys[jwk.Kid] = k
+	}
+	o.keys = keys
+	key, ok := o.keys[kid]
+	if !ok {
+		return nil, errors.New("未知的kid：" + kid)
+	}
+	return key, nil
+}
+
+//校验id_token的签名、issuer、audience、有效期以及nonce
+func (o *oidc) verifyIDToken(provider *oidcProvider, rawIDToken, nonce string) (claims jwt.MapClaims, err error) {
+	claims = jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, errors.New("不支持的签名算法：" + token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, err := o.getKey(provider, kid)
+		if err != nil {
+			return nil, err
+		}
+		//签名算法必须与公钥类型一致
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, errors.New("签名算法不匹配：" + token.Method.Alg())
+			}
+		case *ecdsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+				return nil, errors.New("签名算法不匹配：" + token.Method.Alg())
+			}
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); iss != provider.Issuer {
+		return nil, errors.New("issuer不匹配：" + iss)
+	}
+	if !contains(claimStrings(claims["aud"]), config.OIDCClientID) {
+		return nil, errors.New("audience不匹配")
+	}
+	//jwt-go只在exp存在时校验，id_token必须包含exp
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("id_token缺少exp")
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, errors.New("nonce不匹配")
+	}
+	return claims, nil
+}
+
+//将jwk转换为公钥
+func (k *jsonWebKey) publicKey() (key interface{}, err error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("不支持的曲线：" + k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, errors.New("不支持的公钥类型：" + k.Kty)
+}
+
+//claim的值可能是字符串或字符串数组，统一转换为字符串数组
+func claimStrings(value interface{}) (values []string) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+func getJSON(url string, v interface{}) error {
+	resp, err := oidcHTTPClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("请求%s失败，状态码%d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.New("生成随机数失败，" + err.Error())
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,304 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"k8s-platform/config"
+	"k8s-platform/dao"
+	"k8s-platform/model"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+//本地模拟的OIDC身份提供方，token接口返回的id_token由测试指定claims，使用当前密钥签名
+type testIdP struct {
+	*httptest.Server
+	lock   sync.Mutex
+	kid    string
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	idp := &testIdP{}
+	idp.rotate(t, "k1")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/auth",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	//只返回当前密钥，模拟轮换后旧密钥下线
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.lock.Lock()
+		defer idp.lock.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": idp.kid,
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idp.lock.Lock()
+		defer idp.lock.Unlock()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+		token.Header["kid"] = idp.kid
+		idToken, err := token.SignedString(idp.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     idToken,
+		})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+//更换签名密钥
+func (idp *testIdP) rotate(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.lock.Lock()
+	idp.kid = kid
+	idp.key = key
+	idp.lock.Unlock()
+}
+
+func (idp *testIdP) setClaims(claims jwt.MapClaims) {
+	idp.lock.Lock()
+	idp.claims = claims
+	idp.lock.Unlock()
+}
+
+//设置OIDC配置，并清空OIDC中缓存的身份提供方信息和公钥
+func setupTestOIDC(t *testing.T, idp *testIdP) {
+	setupTestDB(t)
+	setupTestJWT(t)
+	config.OIDCIssuer = idp.URL
+	config.OIDCClientID = "k8s-platform"
+	config.OIDCClientSecret = "secret"
+	config.OIDCRedirectURL = "http://platform/api/oidc/callback"
+	config.OIDCGroupRoles = `[{"group":"dev","role":"developer","namespace":"dev"}]`
+	OIDC = oidc{}
+	t.Cleanup(func() {
+		config.OIDCIssuer = ""
+		config.OIDCGroupRoles = ""
+		OIDC = oidc{}
+	})
+}
+
+//模拟浏览器跳转到身份提供方，返回state和nonce
+func oidcLogin(t *testing.T) (state, nonce string) {
+	loginURL, cookieState, err := OIDC.LoginURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(loginURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Query().Get("state") != cookieState {
+		t.Fatal("写入cookie的state与跳转地址中的state不一致")
+	}
+	return u.Query().Get("state"), u.Query().Get("nonce")
+}
+
+func idTokenClaims(idp *testIdP, nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":                idp.URL,
+		"aud":                "k8s-platform",
+		"sub":                "alice-id",
+		"exp":                time.Now().Add(time.Minute).Unix(),
+		"nonce":              nonce,
+		"preferred_username": "alice",
+		"groups":             []string{"dev"},
+	}
+}
+
+func TestOIDCCallback(t *testing.T) {
+	idp := newTestIdP(t)
+	setupTestOIDC(t, idp)
+	state, nonce := oidcLogin(t)
+	idp.setClaims(idTokenClaims(idp, nonce))
+	resp, err := OIDC.Callback("code", state, state)
+	if err != nil {
+		t.Fatalf("OIDC登录失败，%v", err)
+	}
+	if resp.Username != "alice" || resp.Token == "" {
+		t.Fatalf("登录结果不正确，%+v", resp)
+	}
+	user, err := dao.User.GetByUsername("alice")
+	if err != nil || user == nil || user.Source != SourceOIDC {
+		t.Fatalf("应该自动创建OIDC用户，%+v，%v", user, err)
+	}
+	bindings, err := dao.RoleBinding.GetByUsername("alice")
+	if err != nil || len(bindings) != 1 || bindings[0].Role != RoleDeveloper || bindings[0].Namespace != "dev" {
+		t.Fatalf("应该根据用户组生成角色绑定，%v", err)
+	}
+	//state只能使用一次
+	if _, err = OIDC.Callback("code", state, state); err == nil || !strings.Contains(err.Error(), "state") {
+		t.Fatalf("重复使用的state应该被拒绝，%v", err)
+	}
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(claims jwt.MapClaims)
+		reason string
+	}{
+		{"nonce不匹配", func(claims jwt.MapClaims) { claims["nonce"] = "other" }, "nonce"},
+		{"缺少nonce", func(claims jwt.MapClaims) { delete(claims, "nonce") }, "nonce"},
+		{"issuer不匹配", func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" }, "issuer"},
+		{"audience不匹配", func(claims jwt.MapClaims) { claims["aud"] = []string{"other-client"} }, "audience"},
+		{"已过期", func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }, "expired"},
+		{"缺少exp", func(claims jwt.MapClaims) { delete(claims, "exp") }, "exp"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			idp := newTestIdP(t)
+			setupTestOIDC(t, idp)
+			state, nonce := oidcLogin(t)
+			claims := idTokenClaims(idp, nonce)
+			c.modify(claims)
+			idp.setClaims(claims)
+			_, err := OIDC.Callback("code", state, state)
+			if err == nil || !strings.Contains(err.Error(), c.reason) {
+				t.Fatalf("%s的id_token应该因为%s被拒绝，%v", c.name, c.reason, err)
+			}
+			if user, _ := dao.User.GetByUsername("alice"); user != nil {
+				t.Fatal("校验失败时不能创建用户")
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackInvalidState(t *testing.T) {
+	idp := newTestIdP(t)
+	setupTestOIDC(t, idp)
+	_, nonce := oidcLogin(t)
+	idp.setClaims(idTokenClaims(idp, nonce))
+	if _, err := OIDC.Callback("code", "forged-state", "forged-state"); err == nil || !strings.Contains(err.Error(), "state") {
+		t.Fatalf("未知的state应该被拒绝，%v", err)
+	}
+}
+
+//回调请求的cookie中没有state或state不一致时拒绝，且不消耗state
+func TestOIDCCallbackStateCookie(t *testing.T) {
+	idp := newTestIdP(t)
+	setupTestOIDC(t, idp)
+	//攻击者发起登录，得到自己的state
+	attackerState, nonce := oidcLogin(t)
+	idp.setClaims(idTokenClaims(idp, nonce))
+	//受害者的浏览器没有发起过登录，或者cookie中是受害者自己发起登录的state
+	victimState, _ := oidcLogin(t)
+	for _, cookieState := range []string{"", victimState, attackerState + "x"} {
+		_, err := OIDC.Callback("code", attackerState, cookieState)
+		if err == nil || !strings.Contains(err.Error(), "state") {
+			t.Fatalf("cookie为%q时应该拒绝，%v", cookieState, err)
+		}
+		if user, _ := dao.User.GetByUsername("alice"); user != nil {
+			t.Fatal("state不匹配时不能创建用户")
+		}
+	}
+	//校验失败没有消耗state，攻击者自己的浏览器仍然可以完成登录
+	if _, err := OIDC.Callback("code", attackerState, attackerState); err != nil {
+		t.Fatalf("cookie匹配时应该登录成功，%v", err)
+	}
+}
+
+//身份提供方轮换密钥后，平台根据新的kid重新获取jwks
+func TestOIDCKeyRotation(t *testing.T) {
+	idp := newTestIdP(t)
+	setupTestOIDC(t, idp)
+	state, nonce := oidcLogin(t)
+	idp.setClaims(idTokenClaims(idp, nonce))
+	if _, err := OIDC.Callback("code", state, state); err != nil {
+		t.Fatalf("OIDC登录失败，%v", err)
+	}
+	idp.rotate(t, "k2")
+	state, nonce = oidcLogin(t)
+	idp.setClaims(idTokenClaims(idp, nonce))
+	if _, err := OIDC.Callback("code", state, state); err != nil {
+		t.Fatalf("密钥轮换后OIDC登录失败，%v", err)
+	}
+	if _, ok := OIDC.keys["k1"]; ok {
+		t.Fatal("重新获取jwks后下线的k1不应该继续使用")
+	}
+
+	//使用未公布的密钥签名的id_token被拒绝
+	unpublished, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, nonce = oidcLogin(t)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, idTokenClaims(idp, nonce))
+	token.Header["kid"] = "k2"
+	forged, err := token.SignedString(unpublished)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := OIDC.getProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = OIDC.verifyIDToken(provider, forged, nonce); err == nil {
+		t.Fatal("签名不正确的id_token应该被拒绝")
+	}
+}
+
+//同名的本地用户不能通过OIDC登录
+func TestOIDCSourceMismatch(t *testing.T) {
+	idp := newTestIdP(t)
+	setupTestOIDC(t, idp)
+	if err := User.CreateUser("alice", "alice-password"); err != nil {
+		t.Fatal(err)
+	}
+	state, nonce := oidcLogin(t)
+	idp.setClaims(idTokenClaims(idp, nonce))
+	_, err := OIDC.Callback("code", state, state)
+	if err == nil || !strings.Contains(err.Error(), SourceLocal) {
+		t.Fatalf("来源不一致的用户应该被拒绝，%v", err)
+	}
+	bindings, _ := dao.RoleBinding.GetByUsername("alice")
+	for _, binding := range bindings {
+		if binding.Source == SourceOIDC {
+			t.Fatal("来源不一致时不能生成角色绑定")
+		}
+	}
+	//被禁用的OIDC用户不能登录
+	if err = dao.User.Add(&model.User{Username: "bob", Source: SourceOIDC, Disabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	state, nonce = oidcLogin(t)
+	claims := idTokenClaims(idp, nonce)
+	claims["preferred_username"] = "bob"
+	idp.setClaims(claims)
+	if _, err = OIDC.Callback("code", state, state); err == nil {
+		t.Fatal("被禁用的用户应该被拒绝")
+	}
+}
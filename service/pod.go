@@ -5,13 +5,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"k8s-platform/config"
+	"time"
 
 	"github.com/wonderivan/logger"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
 )
 
 /**
@@ -43,9 +47,45 @@ func (p *pod) fromCells(cells []DataCell) []corev1.Pod {
 }
 
 //定义列表的返回内容，Item是pod元素列表，Total为pod元素数量
+//view为full时Items为[]corev1.Pod，为summary时Items为[]*PodSummary
 type PodsResp struct {
-	Items []corev1.Pod `json:"items"`
-	Total int          `json:"total"`
+	Items       interface{}       `json:"items"`
+	Total       int               `json:"total"`
+	Facets      []*NamespaceFacet `json:"facets"`
+	SortColumns []string          `json:"sort_columns"`
+}
+
+//pod列表的返回格式
+const (
+	PodViewFull    = "full"
+	PodViewSummary = "summary"
+)
+
+//PodSummary为pod的摘要信息，状态、就绪数和重启次数的计算方式与kubectl get pods一致，前端无需再根据原始对象计算
+type PodSummary struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	Status          string            `json:"status"`
+	Ready           string            `json:"ready"`
+	ReadyContainers int               `json:"ready_containers"`
+	TotalContainers int               `json:"total_containers"`
+	Restarts        int               `json:"restarts"`
+	LastRestartTime *time.Time        `json:"last_restart_time"`
+	Age             string            `json:"age"`
+	CreationTime    time.Time         `json:"creation_time"`
+	Node            string            `json:"node"`
+	QOSClass        string            `json:"qos_class"`
+	Owner           *PodOwner         `json:"owner"`
+	PodIP           string            `json:"pod_ip"`
+	PodIPs          []string          `json:"pod_ips"`
+	HostIP          string            `json:"host_ip"`
+	Labels          map[string]string `json:"labels"`
+}
+
+//PodOwner为pod的控制器，如ReplicaSet、StatefulSet、DaemonSet、Job
+type PodOwner struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
 }
 
 //定义PodsNp类型，用于返回namespace中pod的数量
@@ -55,13 +95,13 @@ type PodsNp struct {
 }
 
 //获取pod列表，支持过滤、排序、分页
-func (p *pod) GetPods(filterName, namespace string, limit, page int) (podsResp *PodsResp, err error) {
+//view为summary时返回PodSummary列表，否则返回原始的pod对象
+func (p *pod) GetPods(client *kubernetes.Clientset, filter *FilterQuery, sort *SortQuery, namespace, view string, limit, page int) (podsResp *PodsResp, err error) {
 	//获取podList类型的pod列表
 	//context.TODO() 用于声明一个空的context上下文，用于List方法内设置这个请求的超时（源码），这里的常用用法
 	//metav1.ListOptions{}用于过滤List数据，如使用label，field等
 	//kubectl get services --all-namespace --field-seletor metadata.namespace != default
-	podList, err := K8s.ClientSet.CoreV1().Pods(namespace).List(context.TODO(),
-		metav1.ListOptions{})
+	podList, err := p.list(client, namespace)
 	if err != nil {
 		//logger用于打印日志
 		//return用于返回response内容
@@ -72,7 +112,8 @@ func (p *pod) GetPods(filterName, namespace string, limit, page int) (podsResp *
 	selectableData := &dataSelector{
 		GenericDataList: p.toCells(podList.Items),
 		dataSelectQuery: &DataSelectQuery{
-			FilterQuery: &FilterQuery{Name: filterName},
+			FilterQuery: filter,
+			SortQuery:   sort,
 			PaginateQuery: &PaginateQuery{
 				Limit: limit,
 				Page:  page,
@@ -82,20 +123,134 @@ func (p *pod) GetPods(filterName, namespace string, limit, page int) (podsResp *
 	//先过滤
 	filtered := selectableData.Filter()
 	total := len(filtered.GenericDataList)
+	//统计每个namespace的数量，需要在分页之前
+	facets := filtered.Facets()
 	//再排序和分页
 	data := filtered.Sort().Paginate()
 	//将[]DataCell类型的pod列表转为v1.pod列表
 	pods := p.fromCells(data.GenericDataList)
+	var items interface{} = pods
+	if view == PodViewSummary {
+		summaries := make([]*PodSummary, len(pods))
+		for i := range pods {
+			summaries[i] = p.summarize(&pods[i])
+		}
+		items = summaries
+	}
 	return &PodsResp{
-		Items: pods,
-		Total: total,
+		Items:       items,
+		Total:       total,
+		Facets:      facets,
+		SortColumns: PodSortColumns,
 	}, nil
 }
 
+//生成pod的摘要信息，状态的计算逻辑参考kubectl的printPod
+func (p *pod) summarize(pod *corev1.Pod) *PodSummary {
+	summary := &PodSummary{
+		Name:            pod.Name,
+		Namespace:       pod.Namespace,
+		TotalContainers: len(pod.Spec.Containers),
+		Age:             duration.HumanDuration(time.Since(pod.CreationTimestamp.Time)),
+		CreationTime:    pod.CreationTimestamp.Time,
+		Node:            pod.Spec.NodeName,
+		QOSClass:        string(pod.Status.QOSClass),
+		PodIP:           pod.Status.PodIP,
+		HostIP:          pod.Status.HostIP,
+		Labels:          pod.Labels,
+	}
+	for _, ip := range pod.Status.PodIPs {
+		summary.PodIPs = append(summary.PodIPs, ip.IP)
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		summary.Owner = &PodOwner{Kind: owner.Kind, Name: owner.Name}
+	}
+	//记录容器上次退出的时间，取所有容器中最近的一次
+	lastRestart := func(status corev1.ContainerStatus) {
+		terminated := status.LastTerminationState.Terminated
+		if terminated == nil {
+			return
+		}
+		finishedAt := terminated.FinishedAt.Time
+		if summary.LastRestartTime == nil || finishedAt.After(*summary.LastRestartTime) {
+			summary.LastRestartTime = &finishedAt
+		}
+	}
+
+	reason := string(pod.Status.Phase)
+	if pod.Status.Reason != "" {
+		reason = pod.Status.Reason
+	}
+	//init容器未全部成功时，状态为Init:<原因>或Init:<已完成数>/<总数>
+	initializing := false
+	for i, container := range pod.Status.InitContainerStatuses {
+		summary.Restarts += int(container.RestartCount)
+		lastRestart(container)
+		switch {
+		case container.State.Terminated != nil && container.State.Terminated.ExitCode == 0:
+			continue
+		case container.State.Terminated != nil:
+			if container.State.Terminated.Reason != "" {
+				reason = "Init:" + container.State.Terminated.Reason
+			} else if container.State.Terminated.Signal != 0 {
+				reason = fmt.Sprintf("Init:Signal:%d", container.State.Terminated.Signal)
+			} else {
+				reason = fmt.Sprintf("Init:ExitCode:%d", container.State.Terminated.ExitCode)
+			}
+		case container.State.Waiting != nil && container.State.Waiting.Reason != "" && container.State.Waiting.Reason != "PodInitializing":
+			reason = "Init:" + container.State.Waiting.Reason
+		default:
+			reason = fmt.Sprintf("Init:%d/%d", i, len(pod.Spec.InitContainers))
+		}
+		initializing = true
+		break
+	}
+	if !initializing {
+		summary.Restarts = 0
+		hasRunning := false
+		//与kubectl一致，倒序遍历，状态取第一个异常容器的原因
+		for i := len(pod.Status.ContainerStatuses) - 1; i >= 0; i-- {
+			container := pod.Status.ContainerStatuses[i]
+			summary.Restarts += int(container.RestartCount)
+			lastRestart(container)
+			if container.State.Waiting != nil && container.State.Waiting.Reason != "" {
+				reason = container.State.Waiting.Reason
+			} else if container.State.Terminated != nil && container.State.Terminated.Reason != "" {
+				reason = container.State.Terminated.Reason
+			} else if container.State.Terminated != nil {
+				if container.State.Terminated.Signal != 0 {
+					reason = fmt.Sprintf("Signal:%d", container.State.Terminated.Signal)
+				} else {
+					reason = fmt.Sprintf("ExitCode:%d", container.State.Terminated.ExitCode)
+				}
+			} else if container.Ready && container.State.Running != nil {
+				hasRunning = true
+				summary.ReadyContainers++
+			}
+		}
+		//还有容器在运行时，状态改回Running或NotReady
+		if reason == "Completed" && hasRunning {
+			reason = "NotReady"
+			for _, condition := range pod.Status.Conditions {
+				if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+					reason = "Running"
+				}
+			}
+		}
+	}
+	if pod.DeletionTimestamp != nil && pod.Status.Reason == "NodeLost" {
+		reason = "Unknown"
+	} else if pod.DeletionTimestamp != nil {
+		reason = "Terminating"
+	}
+	summary.Status = reason
+	summary.Ready = fmt.Sprintf("%d/%d", summary.ReadyContainers, summary.TotalContainers)
+	return summary
+}
+
 //获取pod详情
-func (p *pod) GetPodDetail(podName, namespace string) (pod *corev1.Pod, err error) {
-	pod, err = K8s.ClientSet.CoreV1().Pods(namespace).
-		Get(context.TODO(), podName, metav1.GetOptions{})
+func (p *pod) GetPodDetail(client *kubernetes.Clientset, podName, namespace string) (pod *corev1.Pod, err error) {
+	pod, err = p.get(client, podName, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取Pod详情失败，" + err.Error()))
 		return nil, errors.New("获取Pod详情失败，" + err.Error())
@@ -104,8 +259,8 @@ func (p *pod) GetPodDetail(podName, namespace string) (pod *corev1.Pod, err erro
 }
 
 //删除pod
-func (p *pod) DeletePod(podName, namespace string) (err error) {
-	err = K8s.ClientSet.CoreV1().Pods(namespace).
+func (p *pod) DeletePod(client *kubernetes.Clientset, podName, namespace string) (err error) {
+	err = client.CoreV1().Pods(namespace).
 		Delete(context.TODO(), podName, metav1.DeleteOptions{})
 	if err != nil {
 		logger.Error(errors.New("删除pod失败，" + err.Error()))
@@ -116,7 +271,7 @@ func (p *pod) DeletePod(podName, namespace string) (err error) {
 
 //更新pod
 //content参数是请求中传入的pod对象的json数据
-func (p *pod) UpdatePod(namespace, content string) (err error) {
+func (p *pod) UpdatePod(client *kubernetes.Clientset, namespace, content string) (err error) {
 	var pod = &corev1.Pod{}
 	//反序列化为pod对象
 	err = json.Unmarshal([]byte(content), pod)
@@ -125,7 +280,7 @@ func (p *pod) UpdatePod(namespace, content string) (err error) {
 		return errors.New("反序列化失败, " + err.Error())
 	}
 	//更新pod podName用不到，此处用pod
-	_, err = K8s.ClientSet.CoreV1().Pods(namespace).
+	_, err = client.CoreV1().Pods(namespace).
 		Update(context.TODO(), pod, metav1.UpdateOptions{})
 	if err != nil {
 		logger.Error(errors.New("更新Pod失败, " + err.Error()))
@@ -135,9 +290,9 @@ func (p *pod) UpdatePod(namespace, content string) (err error) {
 }
 
 //获取Pod中的容器名
-func (p *pod) GetPodContainer(podName, namespace string) (containers []string, err error) {
+func (p *pod) GetPodContainer(client *kubernetes.Clientset, podName, namespace string) (containers []string, err error) {
 	//获取pod详情
-	pod, err := p.GetPodDetail(podName, namespace)
+	pod, err := p.GetPodDetail(client, podName, namespace)
 	if err != nil {
 		return nil, err
 	}
@@ -149,7 +304,7 @@ func (p *pod) GetPodContainer(podName, namespace string) (containers []string, e
 }
 
 //获取pod内容器日志
-func (p *pod) GetPodLog(containerName, podName, namespace string) (log string, err error) {
+func (p *pod) GetPodLog(client *kubernetes.Clientset, containerName, podName, namespace string) (log string, err error) {
 	//设置日志的配置，容器名、tail的行数
 	lineLimit := int64(config.PodLogTailLine)
 	option := &corev1.PodLogOptions{
@@ -157,7 +312,7 @@ func (p *pod) GetPodLog(containerName, podName, namespace string) (log string, e
 		TailLines: &lineLimit,
 	}
 	//获取request实例
-	req := K8s.ClientSet.CoreV1().Pods(namespace).GetLogs(podName, option)
+	req := client.CoreV1().Pods(namespace).GetLogs(podName, option)
 	//发起request请求，返回一个io.ReadCloser类型（等同于response.boby)
 	podLogs, err := req.Stream(context.TODO())
 	if err != nil {
@@ -175,27 +330,53 @@ func (p *pod) GetPodLog(containerName, podName, namespace string) (log string, e
 	return buf.String(), nil
 }
 
-//获取每个namespace的pod数量
-func (p *pod) GetPodNumPerNp() (podsNps []*PodsNp, err error) {
+//获取每个namespace的pod数量，只查询一次所有namespace的pod列表再按namespace统计
+func (p *pod) GetPodNumPerNp(client *kubernetes.Clientset, allowed []string) (podsNps []*PodsNp, err error) {
 	//获取namespace列表
-	namespaceList, err := K8s.ClientSet.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	namespaceList, err := Namespace.list(client)
 	if err != nil {
 		return nil, err
 	}
-	for _, namespace := range namespaceList.Items {
-		//获取pod列表
-		podList, err := K8s.ClientSet.CoreV1().Pods(namespace.Name).
-			List(context.TODO(), metav1.ListOptions{})
-		if err != nil {
-			return nil, err
-		}
+	//获取所有namespace的pod列表
+	podList, err := p.list(client, "")
+	if err != nil {
+		return nil, err
+	}
+	counts := countByNamespace(p.toCells(podList.Items))
+	for _, namespace := range filterNamespaces(namespaceList.Items, allowed) {
 		//组装数据
 		PodsNp := &PodsNp{
 			Namespace: namespace.Name,
-			PodNum:    len(podList.Items),
+			PodNum:    counts[namespace.Name],
 		}
 		//添加到podsNps数组中
 		podsNps = append(podsNps, PodsNp)
 	}
 	return podsNps, nil
 }
+
+//获取pod列表，缓存可用时从缓存中读取，否则请求apiserver
+func (p *pod) list(client *kubernetes.Clientset, namespace string) (*corev1.PodList, error) {
+	objs, ok := K8s.CacheList(client, "pods", namespace)
+	if !ok {
+		return client.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+	}
+	list := &corev1.PodList{Items: make([]corev1.Pod, len(objs))}
+	for i, obj := range objs {
+		list.Items[i] = *obj.(*corev1.Pod)
+	}
+	return list, nil
+}
+
+//获取单个pod，缓存可用时从缓存中读取，否则请求apiserver
+func (p *pod) get(client *kubernetes.Clientset, name, namespace string) (*corev1.Pod, error) {
+	obj, ok, err := K8s.CacheGet(client, "pods", namespace, name)
+	if !ok {
+		return client.CoreV1().Pods(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	//缓存中的对象是共享的，返回副本避免被修改
+	return obj.(*corev1.Pod).DeepCopy(), nil
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"k8s-platform/config"
+	"k8s-platform/model"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/wonderivan/logger"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+//容器文件传输的参数，path为容器中的绝对路径，下载时为文件或目录，上传时为目标目录
+//format为下载的打包格式，支持tar和zip，默认tar
+type PodFileQuery struct {
+	Cluster       string `form:"cluster"`
+	Namespace     string `form:"namespace"`
+	PodName       string `form:"pod_name"`
+	ContainerName string `form:"container_name"`
+	Path          string `form:"path"`
+	Format        string `form:"format"`
+}
+
+//下载的打包格式
+const (
+	PodFileFormatTar = "tar"
+	PodFileFormatZip = "zip"
+)
+
+//文件大小超过config.PodFileMaxSize
+var ErrPodFileTooLarge = errors.New("文件大小超过上限")
+
+//容器文件传输的大小上限，单位字节
+func PodFileMaxBytes() int64 {
+	return int64(config.PodFileMaxSize) << 20
+}
+
+//从容器中下载文件或目录，与kubectl cp一样在容器中执行tar，容器中需要有tar命令
+//输出边读边写到w，不在内存中保存，写出第一个字节之前的错误返回给调用方，之后的错误只能中断下载
+func (t *terminal) DownloadFile(w http.ResponseWriter, query *PodFileQuery, username, ip string) (err error) {
+	dir, base, err := podFilePath(query)
+	if err != nil {
+		return err
+	}
+	if query.Format == "" {
+		query.Format = PodFileFormatTar
+	}
+	if query.Format != PodFileFormatTar && query.Format != PodFileFormatZip {
+		return errors.New("format只支持tar和zip")
+	}
+	conf, err := K8s.GetConfig(query.Cluster)
+	if err != nil {
+		logger.Error("获取k8s配置失败，" + err.Error())
+		return err
+	}
+	client, err := K8s.GetClient(query.Cluster)
+	if err != nil {
+		logger.Error("获取k8s clientSet失败，" + err.Error())
+		return err
+	}
+	//下载接口是GET请求，不经过审计中间件，在这里记录审计日志
+	start := time.Now()
+	record := &model.Audit{
+		Username:  username,
+		IP:        ip,
+		Cluster:   K8s.clusterName(query.Cluster),
+		Namespace: query.Namespace,
+		Resource:  "pod",
+		Name:      query.PodName,
+		Verb:      "exec",
+		Method:    http.MethodGet,
+		Path:      "/api/k8s/pod/file/download",
+		Message:   fmt.Sprintf("container: %s, download: %s", query.ContainerName, query.Path),
+	}
+	defer func() {
+		record.Latency = time.Since(start).Milliseconds()
+		if err != nil {
+			record.Result = AuditFailure
+			record.Message += ", " + err.Error()
+		}
+		Audit.Record(record)
+	}()
+
+	name := base
+	if name == "." {
+		name = "root"
+	}
+	out := &podFileWriter{w: w, header: func() {
+		w.Header().Set("Content-Disposition", podFileDisposition(name+"."+query.Format))
+		if query.Format == PodFileFormatZip {
+			w.Header().Set("Content-Type", "application/zip")
+		} else {
+			w.Header().Set("Content-Type", "application/x-tar")
+		}
+	}}
+	//写出失败或超过大小上限时关闭连接，结束容器中的tar
+	conn := &terminalConn{}
+	stdout := &podFileLimitWriter{limit: PodFileMaxBytes(), onError: func() { conn.Close() }}
+	stderr := &limitedBuffer{limit: 4 << 10}
+	command := []string{"tar", "cf", "-", "-C", dir, base}
+	options := remotecommand.StreamOptions{Stdout: stdout, Stderr: stderr}
+	if query.Format == PodFileFormatTar {
+		stdout.w = out
+		err = t.stream(conf, client, query.Namespace, query.PodName, query.ContainerName, command, options, conn.set)
+	} else {
+		//zip需要把tar流逐个文件转换，通过pipe边读边写
+		reader, writer := io.Pipe()
+		stdout.w = writer
+		done := make(chan error, 1)
+		go func() {
+			err := tarToZip(reader, out)
+			reader.CloseWithError(err)
+			done <- err
+		}()
+		err = t.stream(conf, client, query.Namespace, query.PodName, query.ContainerName, command, options, conn.set)
+		writer.CloseWithError(err)
+		if zipErr := <-done; err == nil {
+			err = zipErr
+		}
+	}
+	if stdout.err != nil {
+		err = stdout.err
+	}
+	if err != nil {
+		err = podFileError(err, stderr)
+		if out.written {
+			//响应头已经写出，只能中断下载
+			logger.Error("下载容器文件失败，" + err.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+//上传文件到容器的目录中，文件内容以tar流写入容器中tar命令的标准输入，不在内存中保存
+func (t *terminal) UploadFile(query *PodFileQuery, filename string, size int64, file io.Reader) error {
+	if size > PodFileMaxBytes() {
+		return ErrPodFileTooLarge
+	}
+	filename = path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	if filename == "." || filename == "/" || filename == ".." {
+		return errors.New("文件名不合法")
+	}
+	if query.Namespace == "" || query.PodName == "" {
+		return errors.New("namespace和pod_name不能为空")
+	}
+	if !path.IsAbs(query.Path) {
+		return errors.New("path必须是容器中的绝对路径")
+	}
+	conf, err := K8s.GetConfig(query.Cluster)
+	if err != nil {
+		logger.Error("获取k8s配置失败，" + err.Error())
+		return err
+	}
+	client, err := K8s.GetClient(query.Cluster)
+	if err != nil {
+		logger.Error("获取k8s clientSet失败，" + err.Error())
+		return err
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(writer)
+		err := tw.WriteHeader(&tar.Header{
+			Name:    filename,
+			Mode:    0644,
+			Size:    size,
+			ModTime: time.Now(),
+		})
+		if err == nil {
+			_, err = io.CopyN(tw, file, size)
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+	stderr := &limitedBuffer{limit: 4 << 10}
+	err = t.stream(conf, client, query.Namespace, query.PodName, query.ContainerName,
+		[]string{"tar", "xf", "-", "-C", path.Clean(query.Path)},
+		remotecommand.StreamOptions{Stdin: reader, Stderr: stderr}, nil)
+	//tar提前退出时结束写入协程
+	reader.Close()
+	if err != nil {
+		err = podFileError(err, stderr)
+		logger.Error("上传文件到容器失败，" + err.Error())
+		return err
+	}
+	return nil
+}
+
+//校验下载参数，返回容器中tar命令的工作目录和打包的文件名
+func podFilePath(query *PodFileQuery) (dir, base string, err error) {
+	if query.Namespace == "" || query.PodName == "" {
+		return "", "", errors.New("namespace和pod_name不能为空")
+	}
+	if !path.IsAbs(query.Path) {
+		return "", "", errors.New("path必须是容器中的绝对路径")
+	}
+	p := path.Clean(query.Path)
+	if p == "/" {
+		return "/", ".", nil
+	}
+	return path.Dir(p), path.Base(p), nil
+}
+
+//生成下载的Content-Disposition，文件名来自容器中的路径，可能包含引号、分号和非ASCII字符，需要转义
+func podFileDisposition(filename string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+}
+
+//tar命令失败时使用标准错误中的内容作为错误信息
+func podFileError(err error, stderr *limitedBuffer) error {
+	if errors.Is(err, ErrPodFileTooLarge) {
+		return err
+	}
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return errors.New("执行tar失败，" + msg)
+	}
+	return errors.New("执行tar失败，" + err.Error())
+}
+
+//把tar流转换为zip流，目录和普通文件之外的文件（如软链接）跳过
+func tarToZip(r io.Reader, w io.Writer) error {
+	tr := tar.NewReader(r)
+	zw := zip.NewWriter(w)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir {
+			continue
+		}
+		fh, err := zip.FileInfoHeader(header.FileInfo())
+		if err != nil {
+			return err
+		}
+		fh.Name = strings.TrimPrefix(header.Name, "./")
+		fh.Method = zip.Deflate
+		if header.Typeflag == tar.TypeDir {
+			fh.Name = strings.TrimSuffix(fh.Name, "/") + "/"
+			fh.Method = zip.Store
+		}
+		if fh.Name == "" || fh.Name == "/" {
+			continue
+		}
+		fw, err := zw.CreateHeader(fh)
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err = io.Copy(fw, tr); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+//第一次写入时才写响应头，这样开始下载前的错误还可以返回json
+type podFileWriter struct {
+	w       http.ResponseWriter
+	header  func()
+	written bool
+}
+
+func (p *podFileWriter) Write(b []byte) (int, error) {
+	if !p.written {
+		p.header()
+		p.written = true
+	}
+	return p.w.Write(b)
+}
+
+//限制写入的总大小，超过limit或写入失败时调用onError
+type podFileLimitWriter struct {
+	w       io.Writer
+	limit   int64
+	size    int64
+	err     error
+	onError func()
+}
+
+func (p *podFileLimitWriter) Write(b []byte) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	p.size += int64(len(b))
+	if p.size > p.limit {
+		p.err = ErrPodFileTooLarge
+	} else if _, err := p.w.Write(b); err != nil {
+		p.err = err
+	}
+	if p.err != nil {
+		p.onError()
+		return 0, p.err
+	}
+	return len(b), nil
+}
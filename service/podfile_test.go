@@ -0,0 +1,17 @@
+package service
+
+import (
+	"mime"
+	"testing"
+)
+
+//文件名中的引号、分号和非ASCII字符不能破坏Content-Disposition，浏览器解析出的文件名与原文件名一致
+func TestPodFileDisposition(t *testing.T) {
+	for _, filename := range []string{"app.tar", "my file.tar", `a"b.tar`, "a;b=c.zip", "日志.tar"} {
+		disposition := podFileDisposition(filename)
+		mediaType, params, err := mime.ParseMediaType(disposition)
+		if err != nil || mediaType != "attachment" || params["filename"] != filename {
+			t.Errorf("%q生成的Content-Disposition为%q，解析结果为%s %v，%v", filename, disposition, mediaType, params, err)
+		}
+	}
+}
@@ -0,0 +1,530 @@
+package service
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"k8s-platform/config"
+	"k8s-platform/utils"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"github.com/wonderivan/logger"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+//PodLogQuery为流式日志的查询参数，与kubectl logs的参数一致
+//TailLines为空时使用config.PodLogTailLine，小于0时返回全部日志
+//SinceTime为RFC3339格式的时间，与SinceSeconds只能传一个
+type PodLogQuery struct {
+	Cluster       string `form:"cluster"`
+	Namespace     string `form:"namespace"`
+	PodName       string `form:"pod_name"`
+	ContainerName string `form:"container_name"`
+	Follow        bool   `form:"follow"`
+	Previous      bool   `form:"previous"`
+	SinceSeconds  *int64 `form:"since_seconds"`
+	SinceTime     string `form:"since_time"`
+	Timestamps    bool   `form:"timestamps"`
+	TailLines     *int64 `form:"tail_lines"`
+	LimitBytes    *int64 `form:"limit_bytes"`
+}
+
+const (
+	//单条消息的最大长度，超过时拆分为多条发送
+	podLogChunkSize = 32 * 1024
+	//follow模式下没有新日志时发送心跳的间隔，防止被代理断开
+	podLogPingInterval = 30 * time.Second
+)
+
+//将查询参数转换为PodLogOptions，参数不合法时返回错误
+func (q *PodLogQuery) logOptions() (option *corev1.PodLogOptions, err error) {
+	if q.PodName == "" || q.Namespace == "" {
+		return nil, errors.New("pod_name和namespace不能为空")
+	}
+	option = &corev1.PodLogOptions{
+		Container:    q.ContainerName,
+		Follow:       q.Follow,
+		Previous:     q.Previous,
+		Timestamps:   q.Timestamps,
+		SinceSeconds: q.SinceSeconds,
+		LimitBytes:   q.LimitBytes,
+	}
+	if q.SinceSeconds != nil && q.SinceTime != "" {
+		return nil, errors.New("since_seconds和since_time只能传一个")
+	}
+	if q.SinceSeconds != nil && *q.SinceSeconds <= 0 {
+		return nil, errors.New("since_seconds必须大于0")
+	}
+	if q.SinceTime != "" {
+		sinceTime, err := time.Parse(time.RFC3339, q.SinceTime)
+		if err != nil {
+			return nil, errors.New("since_time格式错误，" + err.Error())
+		}
+		option.SinceTime = &metav1.Time{Time: sinceTime}
+	}
+	if q.LimitBytes != nil && *q.LimitBytes <= 0 {
+		return nil, errors.New("limit_bytes必须大于0")
+	}
+	tailLines := int64(config.PodLogTailLine)
+	if q.TailLines != nil {
+		tailLines = *q.TailLines
+	}
+	if tailLines >= 0 {
+		option.TailLines = &tailLines
+	}
+	return option, nil
+}
+
+//PodLogSearch为日志搜索的条件，Regex为false时Keyword按子串匹配
+//Context为匹配行前后各返回的行数，MaxMatches为最多返回的匹配行数
+type PodLogSearch struct {
+	Keyword    string
+	Regex      bool
+	IgnoreCase bool
+	Context    int
+	MaxMatches int
+}
+
+//PodLogLine为搜索结果中的一行日志，LineNumber从1开始，Match为false的是上下文行
+type PodLogLine struct {
+	LineNumber int    `json:"line_number"`
+	Text       string `json:"text"`
+	Match      bool   `json:"match"`
+}
+
+//PodLogSearchResp为日志搜索的结果，匹配行超过MaxMatches时Truncated为true
+type PodLogSearchResp struct {
+	Lines     []*PodLogLine `json:"lines"`
+	Matches   int           `json:"matches"`
+	Truncated bool          `json:"truncated"`
+}
+
+const (
+	//搜索日志时默认和最多返回的匹配行数
+	podLogSearchDefaultMatches = 1000
+	podLogSearchMaxMatches     = 10000
+	//搜索日志时上下文的最大行数
+	podLogSearchMaxContext = 100
+)
+
+//下载容器的全部日志，gzip压缩后写入w
+func (p *pod) DownloadPodLog(w io.Writer, client *kubernetes.Clientset, containerName, podName, namespace string, previous bool) (err error) {
+	stream, err := client.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{
+		Container: containerName,
+		Previous:  previous,
+	}).Stream(context.TODO())
+	if err != nil {
+		logger.Error(errors.New("获取PodLog失败，" + err.Error()))
+		return errors.New("获取PodLog失败，" + err.Error())
+	}
+	defer stream.Close()
+	gz := gzip.NewWriter(w)
+	if _, err = io.Copy(gz, stream); err != nil {
+		logger.Error(errors.New("下载PodLog失败，" + err.Error()))
+		return errors.New("下载PodLog失败，" + err.Error())
+	}
+	return gz.Close()
+}
+
+//在服务端搜索容器的全部日志，只返回匹配的行及其上下文
+func (p *pod) SearchPodLog(client *kubernetes.Clientset, containerName, podName, namespace string, previous bool, search *PodLogSearch) (resp *PodLogSearchResp, err error) {
+	match, err := search.matcher()
+	if err != nil {
+		return nil, err
+	}
+	maxMatches := search.MaxMatches
+	if maxMatches <= 0 {
+		maxMatches = podLogSearchDefaultMatches
+	}
+	if maxMatches > podLogSearchMaxMatches {
+		maxMatches = podLogSearchMaxMatches
+	}
+	if search.Context < 0 || search.Context > podLogSearchMaxContext {
+		return nil, fmt.Errorf("context必须在0到%d之间", podLogSearchMaxContext)
+	}
+	stream, err := client.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{
+		Container: containerName,
+		Previous:  previous,
+	}).Stream(context.TODO())
+	if err != nil {
+		logger.Error(errors.New("获取PodLog失败，" + err.Error()))
+		return nil, errors.New("获取PodLog失败，" + err.Error())
+	}
+	defer stream.Close()
+
+	resp = &PodLogSearchResp{Lines: []*PodLogLine{}}
+	//before保存最近的未返回的行，作为下一个匹配行的上文；after为当前还需要返回的下文行数
+	var before []*PodLogLine
+	after := 0
+	reader := bufio.NewReader(stream)
+	for lineNumber := 1; ; lineNumber++ {
+		text, readErr := reader.ReadString('\n')
+		if text != "" {
+			line := &PodLogLine{LineNumber: lineNumber, Text: strings.TrimRight(text, "\r\n")}
+			switch {
+			case !resp.Truncated && match(line.Text):
+				line.Match = true
+				resp.Matches++
+				resp.Lines = append(resp.Lines, before...)
+				resp.Lines = append(resp.Lines, line)
+				before = before[:0]
+				after = search.Context
+				if resp.Matches >= maxMatches {
+					resp.Truncated = true
+				}
+			case after > 0:
+				resp.Lines = append(resp.Lines, line)
+				after--
+			case search.Context > 0:
+				before = append(before, line)
+				if len(before) > search.Context {
+					before = before[1:]
+				}
+			}
+			//达到最大匹配数并返回完下文后停止读取
+			if resp.Truncated && after == 0 {
+				return resp, nil
+			}
+		}
+		if readErr == io.EOF {
+			return resp, nil
+		}
+		if readErr != nil {
+			logger.Error(errors.New("读取PodLog失败，" + readErr.Error()))
+			return nil, errors.New("读取PodLog失败，" + readErr.Error())
+		}
+	}
+}
+
+//根据搜索条件生成匹配函数
+func (s *PodLogSearch) matcher() (match func(string) bool, err error) {
+	if s.Keyword == "" {
+		return nil, errors.New("keyword不能为空")
+	}
+	if s.Regex {
+		expr := s.Keyword
+		if s.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.New("keyword不是合法的正则表达式，" + err.Error())
+		}
+		return re.MatchString, nil
+	}
+	if s.IgnoreCase {
+		keyword := strings.ToLower(s.Keyword)
+		return func(line string) bool {
+			return strings.Contains(strings.ToLower(line), keyword)
+		}, nil
+	}
+	return func(line string) bool {
+		return strings.Contains(line, s.Keyword)
+	}, nil
+}
+
+//推送日志的连接，由WebSocket和SSE分别实现
+type podLogSink interface {
+	//发送一段日志内容
+	send(data []byte) error
+	//发送心跳
+	ping() error
+	//发送错误信息，发送后连接即将关闭
+	fail(msg string)
+	//日志结束，follow为false时读完日志、或者容器退出时调用
+	end()
+	close()
+}
+
+//StreamPodLog推送pod日志，WebSocket升级请求使用WebSocket，其他请求使用Server-Sent Events
+//客户端断开时取消对apiserver的请求；客户端消费过慢时，读取apiserver的速度随之降低，
+//超过config.PodLogWriteTimeout仍无法写入时断开连接
+func (p *pod) StreamPodLog(w http.ResponseWriter, r *http.Request, client *kubernetes.Clientset, query *PodLogQuery) error {
+	option, err := query.logOptions()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	sink, err := newPodLogSink(w, r, ctx, cancel)
+	if err != nil {
+		return err
+	}
+	defer sink.close()
+
+	stream, err := client.CoreV1().Pods(query.Namespace).GetLogs(query.PodName, option).Stream(ctx)
+	if err != nil {
+		logger.Error(errors.New("获取PodLog失败，" + err.Error()))
+		sink.fail("获取PodLog失败，" + err.Error())
+		return nil
+	}
+	defer stream.Close()
+
+	if option.Follow {
+		go podLogKeepalive(ctx, cancel, sink)
+	}
+
+	reader := bufio.NewReaderSize(stream, podLogChunkSize)
+	batch := make([]byte, 0, podLogChunkSize)
+	for {
+		line, err := reader.ReadSlice('\n')
+		batch = append(batch, line...)
+		//缓冲区中没有更多数据或者批次已满时发送，减少消息数量的同时不延迟实时日志
+		if len(batch) > 0 && (err != nil || reader.Buffered() == 0 || len(batch) >= podLogChunkSize) {
+			if sendErr := sink.send(batch); sendErr != nil {
+				logger.Warn("推送PodLog失败，" + sendErr.Error())
+				return nil
+			}
+			batch = batch[:0]
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			sink.end()
+			return nil
+		}
+		if err != nil {
+			//客户端断开导致的取消不需要再通知客户端
+			if ctx.Err() == nil {
+				sink.fail("读取PodLog失败，" + err.Error())
+			}
+			return nil
+		}
+	}
+}
+
+//WebSocket升级请求使用WebSocket，其他请求使用Server-Sent Events，客户端断开时调用cancel
+func newPodLogSink(w http.ResponseWriter, r *http.Request, ctx context.Context, cancel context.CancelFunc) (podLogSink, error) {
+	if websocket.IsWebSocketUpgrade(r) {
+		return newWsLogSink(w, r, cancel)
+	}
+	return newSSELogSink(w, r, ctx, cancel)
+}
+
+//follow模式下定时发送心跳，与日志的写入共用sink的锁，发送失败时取消日志请求
+func podLogKeepalive(ctx context.Context, cancel context.CancelFunc, sink podLogSink) {
+	ticker := time.NewTicker(podLogPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := sink.ping(); err != nil {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+//日志按字节分批发送，批次可能在多字节字符中间截断，容器日志也不保证是UTF-8
+//不完整的字符留到下一批，非法的字节替换为U+FFFD，保证发送的是合法的UTF-8文本，
+//否则浏览器收到非法的WebSocket文本消息后会以1007关闭连接
+type logText struct {
+	rest []byte
+}
+
+//返回可以发送的文本，last为true时日志已经结束，不再保留不完整的字符
+func (l *logText) convert(data []byte, last bool) string {
+	data = append(l.rest, data...)
+	end := len(data)
+	if !last {
+		end = utf8Boundary(data)
+	}
+	l.rest = append([]byte(nil), data[end:]...)
+	return strings.ToValidUTF8(string(data[:end]), string(utf8.RuneError))
+}
+
+//返回末尾被截断的多字节字符的起始位置，没有截断时返回len(data)
+//最多向前查找3个字节，非法的字节不算截断
+func utf8Boundary(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax+1; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(data)
+}
+
+//WebSocket推送日志，日志内容以文本消息发送，错误和结束以关闭帧的原因发送
+type wsLogSink struct {
+	lock sync.Mutex
+	conn *websocket.Conn
+	text logText
+}
+
+func newWsLogSink(w http.ResponseWriter, r *http.Request, cancel context.CancelFunc) (*wsLogSink, error) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	//只读取客户端的控制帧，读取失败说明客户端已断开，取消日志请求
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	return &wsLogSink{conn: conn}, nil
+}
+
+func (s *wsLogSink) write(messageType int, data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(config.PodLogWriteTimeout))
+	return s.conn.WriteMessage(messageType, data)
+}
+
+func (s *wsLogSink) send(data []byte) error {
+	text := s.text.convert(data, false)
+	if text == "" {
+		return nil
+	}
+	return s.write(websocket.TextMessage, []byte(text))
+}
+
+func (s *wsLogSink) ping() error {
+	return s.write(websocket.PingMessage, nil)
+}
+
+func (s *wsLogSink) fail(msg string) {
+	s.write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, truncateCloseReason(msg)))
+}
+
+func (s *wsLogSink) end() {
+	if text := s.text.convert(nil, true); text != "" {
+		s.write(websocket.TextMessage, []byte(text))
+	}
+	s.write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "EOF"))
+}
+
+func (s *wsLogSink) close() {
+	s.conn.Close()
+}
+
+//关闭帧的payload不能超过125字节，去掉2字节的状态码后原因最多123字节，按字符截断
+func truncateCloseReason(msg string) string {
+	size := 0
+	for i, r := range msg {
+		size += utf8.RuneLen(r)
+		if size > 123 {
+			return msg[:i]
+		}
+	}
+	return msg
+}
+
+//Server-Sent Events推送日志，日志内容为log事件，错误为error事件，结束为end事件
+//controller用于设置写入超时，客户端消费过慢时阻塞中的写入在超时后返回错误
+type sseLogSink struct {
+	lock       sync.Mutex
+	w          http.ResponseWriter
+	flusher    http.Flusher
+	controller *http.ResponseController
+	ctx        context.Context
+	cancel     context.CancelFunc
+	text       logText
+}
+
+func newSSELogSink(w http.ResponseWriter, r *http.Request, ctx context.Context, cancel context.CancelFunc) (*sseLogSink, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("不支持Server-Sent Events")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	//关闭nginx的缓冲，保证日志实时推送
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &sseLogSink{
+		w:          w,
+		flusher:    flusher,
+		controller: http.NewResponseController(utils.RawWriter(r, w)),
+		ctx:        ctx,
+		cancel:     cancel,
+	}, nil
+}
+
+//SSE的data中不能包含换行，每一行作为一个data字段，客户端收到后以换行拼接
+func (s *sseLogSink) event(event string, data string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var b strings.Builder
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", strings.TrimSuffix(line, "\r"))
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+//每次写入前设置写入超时，超时后阻塞中的写入返回错误，同时取消日志请求，释放与apiserver的连接
+func (s *sseLogSink) write(data string) error {
+	//不支持设置写入超时时(如测试中的ResponseRecorder)只依赖取消日志请求
+	err := s.controller.SetWriteDeadline(time.Now().Add(config.PodLogWriteTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return errors.New("设置写入超时失败，" + err.Error())
+	}
+	timer := time.AfterFunc(config.PodLogWriteTimeout, s.cancel)
+	defer timer.Stop()
+	if _, err := io.WriteString(s.w, data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	if s.ctx.Err() != nil {
+		return errors.New("写入超时或客户端已断开")
+	}
+	return nil
+}
+
+func (s *sseLogSink) send(data []byte) error {
+	text := s.text.convert(data, false)
+	if text == "" {
+		return nil
+	}
+	return s.event("log", text)
+}
+
+func (s *sseLogSink) ping() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.write(": ping\n\n")
+}
+
+func (s *sseLogSink) fail(msg string) {
+	s.event("error", msg)
+}
+
+func (s *sseLogSink) end() {
+	if text := s.text.convert(nil, true); text != "" {
+		s.event("log", text)
+	}
+	s.event("end", "EOF")
+}
+
+//清除写入超时，连接复用时不影响后续的请求
+func (s *sseLogSink) close() {
+	s.controller.SetWriteDeadline(time.Time{})
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"k8s-platform/config"
+	"k8s-platform/utils"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+//批次在多字节字符中间截断时，不完整的字符留到下一批，非法的字节替换为U+FFFD
+func TestLogTextConvert(t *testing.T) {
+	data := []byte("日志\xff中文")
+	var (
+		text logText
+		got  []string
+	)
+	//按单个字节分批，每一批都会截断多字节字符
+	for i := range data {
+		if s := text.convert(data[i:i+1], false); s != "" {
+			got = append(got, s)
+		}
+	}
+	//末尾被截断的字符在日志结束时替换为U+FFFD
+	if s := text.convert([]byte("\xe4\xb8"), false); s != "" {
+		t.Fatalf("不完整的字符不应该发送，%q", s)
+	}
+	got = append(got, text.convert(nil, true))
+	for _, s := range got {
+		if !utf8.ValidString(s) {
+			t.Fatalf("发送了非法的UTF-8文本，%q", s)
+		}
+	}
+	if joined := strings.Join(got, ""); joined != "日志�中文�" {
+		t.Fatalf("转换结果为%q", joined)
+	}
+}
+
+//客户端不读取时，阻塞中的写入在写入超时后返回，不会一直占用连接
+func TestSSELogSinkWriteDeadline(t *testing.T) {
+	old := config.PodLogWriteTimeout
+	config.PodLogWriteTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { config.PodLogWriteTimeout = old })
+
+	result := make(chan error, 1)
+	engine := gin.New()
+	engine.GET("/log", func(c *gin.Context) {
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		sink, err := newSSELogSink(c.Writer, c.Request, ctx, cancel)
+		if err != nil {
+			result <- err
+			return
+		}
+		defer sink.close()
+		chunk := []byte(strings.Repeat("x", podLogChunkSize) + "\n")
+		for {
+			if err = sink.send(chunk); err != nil {
+				result <- err
+				return
+			}
+		}
+	})
+	srv := httptest.NewServer(utils.KeepRawWriter(engine))
+	t.Cleanup(srv.Close)
+
+	//只发送请求，不读取响应
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/log", nil)
+	if err = req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-result:
+		if err == nil {
+			t.Fatal("写入超时应该返回错误")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("写入超时后阻塞中的写入没有返回")
+	}
+}
@@ -0,0 +1,423 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"k8s-platform/config"
+	"k8s-platform/model"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/wonderivan/logger"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+var PortForward portForward
+
+//portForward登记所有进行中的端口转发，用于并发数量限制和管理员查看、终止转发
+type portForward struct {
+	lock     sync.Mutex
+	forwards map[string]*portForwardEntry
+}
+
+//端口转发的参数，pod_name和service_name只能传一个，port为pod端口或service端口
+type PortForwardQuery struct {
+	Cluster     string `form:"cluster"`
+	Namespace   string `form:"namespace"`
+	PodName     string `form:"pod_name"`
+	ServiceName string `form:"service_name"`
+	Port        int    `form:"port"`
+}
+
+//端口转发的信息，Pod和PodPort为实际转发的pod和端口，BytesIn、BytesOut为发往pod和从pod返回的字节数
+type PortForwardInfo struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	IP        string    `json:"ip"`
+	Cluster   string    `json:"cluster"`
+	Namespace string    `json:"namespace"`
+	Service   string    `json:"service"`
+	Pod       string    `json:"pod"`
+	Port      int       `json:"port"`
+	PodPort   int       `json:"pod_port"`
+	StartTime time.Time `json:"start_time"`
+	BytesIn   int64     `json:"bytes_in"`
+	BytesOut  int64     `json:"bytes_out"`
+}
+
+type portForwardEntry struct {
+	info     PortForwardInfo
+	bytesIn  int64
+	bytesOut int64
+	close    func(reason string)
+}
+
+//超过端口转发并发数量上限，controller据此返回429
+var ErrPortForwardLimit = errors.New("端口转发数量超过上限")
+
+const (
+	//从pod返回的数据每次最多读取的字节数
+	portForwardChunkSize = 32 * 1024
+	//pod关闭连接后等待error流的时间
+	portForwardErrorTimeout = 5 * time.Second
+)
+
+//通过WebSocket转发到pod的端口，一个WebSocket连接对应一个TCP连接，数据以二进制消息传输
+//service会解析为一个就绪的后端pod，建立websocket连接之前的错误返回给调用方
+func (p *portForward) Handler(w http.ResponseWriter, r *http.Request, query *PortForwardQuery, username, ip string) (err error) {
+	if query.Namespace == "" {
+		return errors.New("namespace不能为空")
+	}
+	if (query.PodName == "") == (query.ServiceName == "") {
+		return errors.New("pod_name和service_name必须传且只能传一个")
+	}
+	if query.Port <= 0 || query.Port > 65535 {
+		return errors.New("port不合法")
+	}
+	conf, err := K8s.GetConfig(query.Cluster)
+	if err != nil {
+		logger.Error("获取k8s配置失败，" + err.Error())
+		return err
+	}
+	client, err := K8s.GetClient(query.Cluster)
+	if err != nil {
+		logger.Error("获取k8s clientSet失败，" + err.Error())
+		return err
+	}
+	podName, podPort, err := p.resolve(client, query)
+	if err != nil {
+		return err
+	}
+	entry := &portForwardEntry{info: PortForwardInfo{
+		Username:  username,
+		IP:        ip,
+		Cluster:   K8s.clusterName(query.Cluster),
+		Namespace: query.Namespace,
+		Service:   query.ServiceName,
+		Pod:       podName,
+		Port:      query.Port,
+		PodPort:   podPort,
+		StartTime: time.Now(),
+	}}
+	//端口转发不经过审计中间件，在这里记录审计日志，Latency为转发时长
+	record := &model.Audit{
+		Username:  username,
+		IP:        ip,
+		Cluster:   entry.info.Cluster,
+		Namespace: query.Namespace,
+		Resource:  "pod",
+		Name:      podName,
+		Verb:      "portforward",
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Message:   fmt.Sprintf("service: %s, port: %d", query.ServiceName, podPort),
+	}
+	defer func() {
+		record.Latency = time.Since(entry.info.StartTime).Milliseconds()
+		if err != nil {
+			record.Result = AuditFailure
+			record.Message += ", " + err.Error()
+		}
+		Audit.Record(record)
+	}()
+	id, err := p.acquire(entry)
+	if err != nil {
+		return err
+	}
+	defer p.release(id)
+	streamConn, err := p.dial(conf, client, query.Namespace, podName)
+	if err != nil {
+		return err
+	}
+	defer streamConn.Close()
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		//升级失败时upgrader已经返回了http错误
+		logger.Error("升级websocket失败，" + err.Error())
+		record.Result = AuditFailure
+		record.Message += ", " + err.Error()
+		return nil
+	}
+	defer ws.Close()
+	reason := p.forward(entry, ws, streamConn, podPort)
+	if reason != "" {
+		record.Result = AuditFailure
+		record.Message += ", " + reason
+	}
+	return nil
+}
+
+//解析实际转发的pod和端口，service按端口找到targetPort，再从endpoints中选择一个就绪的pod
+func (p *portForward) resolve(client *kubernetes.Clientset, query *PortForwardQuery) (podName string, podPort int, err error) {
+	if query.PodName != "" {
+		pod, err := client.CoreV1().Pods(query.Namespace).Get(context.TODO(), query.PodName, metav1.GetOptions{})
+		if err != nil {
+			logger.Error("获取Pod详情失败，" + err.Error())
+			return "", 0, errors.New("获取Pod详情失败，" + err.Error())
+		}
+		if pod.Status.Phase != corev1.PodRunning {
+			return "", 0, fmt.Errorf("Pod状态为%s，只能转发到运行中的Pod", pod.Status.Phase)
+		}
+		return pod.Name, query.Port, nil
+	}
+	svc, err := client.CoreV1().Services(query.Namespace).Get(context.TODO(), query.ServiceName, metav1.GetOptions{})
+	if err != nil {
+		logger.Error("获取Service详情失败，" + err.Error())
+		return "", 0, errors.New("获取Service详情失败，" + err.Error())
+	}
+	var servicePort *corev1.ServicePort
+	for i := range svc.Spec.Ports {
+		if int(svc.Spec.Ports[i].Port) == query.Port && svc.Spec.Ports[i].Protocol == corev1.ProtocolTCP {
+			servicePort = &svc.Spec.Ports[i]
+			break
+		}
+	}
+	if servicePort == nil {
+		return "", 0, fmt.Errorf("Service %s没有TCP端口%d", query.ServiceName, query.Port)
+	}
+	endpoints, err := client.CoreV1().Endpoints(query.Namespace).Get(context.TODO(), query.ServiceName, metav1.GetOptions{})
+	if err != nil {
+		logger.Error("获取Endpoints详情失败，" + err.Error())
+		return "", 0, errors.New("获取Endpoints详情失败，" + err.Error())
+	}
+	//endpoints中的端口已经是解析后的targetPort，按端口名对应
+	for _, subset := range endpoints.Subsets {
+		for _, port := range subset.Ports {
+			if port.Name != servicePort.Name {
+				continue
+			}
+			for _, address := range subset.Addresses {
+				if address.TargetRef != nil && address.TargetRef.Kind == "Pod" {
+					return address.TargetRef.Name, int(port.Port), nil
+				}
+			}
+		}
+	}
+	return "", 0, fmt.Errorf("Service %s没有就绪的后端Pod", query.ServiceName)
+}
+
+//与apiserver建立端口转发的SPDY连接，协议与kubectl port-forward一致
+func (p *portForward) dial(conf *rest.Config, client *kubernetes.Clientset, namespace, podName string) (httpstream.Connection, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(conf)
+	if err != nil {
+		return nil, err
+	}
+	url := client.CoreV1().RESTClient().Post().Resource("pods").
+		Namespace(namespace).Name(podName).SubResource("portforward").URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+	conn, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+	if err != nil {
+		logger.Error("建立端口转发连接失败，" + err.Error())
+		return nil, errors.New("建立端口转发连接失败，" + err.Error())
+	}
+	return conn, nil
+}
+
+//在websocket和pod端口之间双向转发数据，直到任意一方关闭、超过最长时间或被管理员终止，返回异常结束的原因
+func (p *portForward) forward(entry *portForwardEntry, ws *websocket.Conn, streamConn httpstream.Connection, port int) (reason string) {
+	var (
+		writeLock sync.Mutex
+		closeOnce sync.Once
+	)
+	//结束转发，向客户端发送关闭帧后关闭两端的连接
+	closeFn := func(msg string) {
+		closeOnce.Do(func() {
+			reason = msg
+			code := websocket.CloseNormalClosure
+			if msg != "" {
+				code = websocket.CloseInternalServerErr
+			}
+			writeLock.Lock()
+			ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, truncateCloseReason(msg)), time.Now().Add(terminalWriteTimeout))
+			writeLock.Unlock()
+			streamConn.Close()
+			ws.Close()
+		})
+	}
+	p.lock.Lock()
+	entry.close = closeFn
+	p.lock.Unlock()
+	if config.PortForwardMaxDuration > 0 {
+		timer := time.AfterFunc(config.PortForwardMaxDuration, func() {
+			closeFn(fmt.Sprintf("端口转发时长超过%s，已断开", config.PortForwardMaxDuration))
+		})
+		defer timer.Stop()
+	}
+	//与kubectl port-forward一样，先建立error流再建立data流
+	headers := http.Header{}
+	headers.Set(corev1.StreamType, corev1.StreamTypeError)
+	headers.Set(corev1.PortHeader, strconv.Itoa(port))
+	headers.Set(corev1.PortForwardRequestIDHeader, "0")
+	errorStream, err := streamConn.CreateStream(headers)
+	if err != nil {
+		closeFn("创建error流失败，" + err.Error())
+		return reason
+	}
+	errorStream.Close()
+	errorChan := make(chan string, 1)
+	go func() {
+		message, err := io.ReadAll(errorStream)
+		switch {
+		case err != nil:
+			errorChan <- "读取error流失败，" + err.Error()
+		case len(message) > 0:
+			errorChan <- "转发到端口" + strconv.Itoa(port) + "失败，" + string(message)
+		default:
+			errorChan <- ""
+		}
+	}()
+	headers.Set(corev1.StreamType, corev1.StreamTypeData)
+	dataStream, err := streamConn.CreateStream(headers)
+	if err != nil {
+		closeFn("创建data流失败，" + err.Error())
+		return reason
+	}
+	//客户端到pod，客户端关闭后关闭data流的写端，通知pod不再有数据
+	localDone := make(chan struct{})
+	go func() {
+		defer close(localDone)
+		defer dataStream.Close()
+		for {
+			messageType, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType != websocket.BinaryMessage && messageType != websocket.TextMessage {
+				continue
+			}
+			if _, err = dataStream.Write(data); err != nil {
+				return
+			}
+			atomic.AddInt64(&entry.bytesIn, int64(len(data)))
+		}
+	}()
+	//pod到客户端
+	//writeFailed表示客户端写入失败，此时不再等待error流
+	var writeFailed bool
+	remoteDone := make(chan struct{})
+	go func() {
+		defer close(remoteDone)
+		buf := make([]byte, portForwardChunkSize)
+		for {
+			n, err := dataStream.Read(buf)
+			if n > 0 {
+				writeLock.Lock()
+				ws.SetWriteDeadline(time.Now().Add(terminalWriteTimeout))
+				werr := ws.WriteMessage(websocket.BinaryMessage, buf[:n])
+				writeLock.Unlock()
+				if werr != nil {
+					writeFailed = true
+					return
+				}
+				atomic.AddInt64(&entry.bytesOut, int64(n))
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case <-remoteDone:
+		if writeFailed {
+			closeFn("")
+			break
+		}
+		//pod关闭连接时等待error流，获取转发失败的原因
+		select {
+		case msg := <-errorChan:
+			closeFn(msg)
+		case <-time.After(portForwardErrorTimeout):
+			closeFn("")
+		}
+	case <-localDone:
+		closeFn("")
+	}
+	<-remoteDone
+	<-localDone
+	return reason
+}
+
+//登记端口转发，超过全局或单个用户的并发数量上限时返回ErrPortForwardLimit
+func (p *portForward) acquire(entry *portForwardEntry) (id string, err error) {
+	id, err = randomString()
+	if err != nil {
+		return "", err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if config.PortForwardMaxSessions > 0 && len(p.forwards) >= config.PortForwardMaxSessions {
+		return "", fmt.Errorf("%w，平台最多同时转发%d个连接", ErrPortForwardLimit, config.PortForwardMaxSessions)
+	}
+	if config.PortForwardMaxUserSessions > 0 {
+		count := 0
+		for _, forward := range p.forwards {
+			if forward.info.Username == entry.info.Username {
+				count++
+			}
+		}
+		if count >= config.PortForwardMaxUserSessions {
+			return "", fmt.Errorf("%w，每个用户最多同时转发%d个连接", ErrPortForwardLimit, config.PortForwardMaxUserSessions)
+		}
+	}
+	if p.forwards == nil {
+		p.forwards = map[string]*portForwardEntry{}
+	}
+	entry.info.ID = id
+	p.forwards[id] = entry
+	return id, nil
+}
+
+func (p *portForward) release(id string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.forwards, id)
+}
+
+//获取进行中的端口转发列表，按开始时间排序
+func (p *portForward) List() []*PortForwardInfo {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	infos := make([]*PortForwardInfo, 0, len(p.forwards))
+	for _, entry := range p.forwards {
+		info := entry.info
+		info.BytesIn = atomic.LoadInt64(&entry.bytesIn)
+		info.BytesOut = atomic.LoadInt64(&entry.bytesOut)
+		infos = append(infos, &info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].StartTime.Before(infos[j].StartTime)
+	})
+	return infos
+}
+
+//管理员强制终止端口转发，operator为执行操作的管理员
+func (p *portForward) Kill(id, operator string) error {
+	p.lock.Lock()
+	entry, ok := p.forwards[id]
+	var closeFn func(string)
+	if ok {
+		closeFn = entry.close
+	}
+	p.lock.Unlock()
+	if !ok {
+		return errors.New("端口转发不存在或已经结束")
+	}
+	if closeFn == nil {
+		return errors.New("端口转发正在建立连接，请稍后重试")
+	}
+	closeFn(fmt.Sprintf("端口转发已被管理员%s终止", operator))
+	return nil
+}
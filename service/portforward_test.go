@@ -0,0 +1,42 @@
+package service
+
+import (
+	"errors"
+	"k8s-platform/config"
+	"testing"
+)
+
+//全局上限对所有用户生效，单个用户上限只统计该用户自己的连接
+func TestPortForwardAcquireLimits(t *testing.T) {
+	oldMax, oldUser := config.PortForwardMaxSessions, config.PortForwardMaxUserSessions
+	config.PortForwardMaxSessions, config.PortForwardMaxUserSessions = 3, 2
+	t.Cleanup(func() {
+		config.PortForwardMaxSessions, config.PortForwardMaxUserSessions = oldMax, oldUser
+	})
+	p := new(portForward)
+	acquire := func(username string) (string, error) {
+		return p.acquire(&portForwardEntry{info: PortForwardInfo{Username: username}})
+	}
+
+	first, err := acquire("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = acquire("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = acquire("alice"); !errors.Is(err, ErrPortForwardLimit) {
+		t.Fatalf("超过单个用户上限时返回%v", err)
+	}
+	if _, err = acquire("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = acquire("carol"); !errors.Is(err, ErrPortForwardLimit) {
+		t.Fatalf("超过全局上限时返回%v", err)
+	}
+	//释放后可以重新登记
+	p.release(first)
+	if _, err = acquire("carol"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/wonderivan/logger"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 var Pv pv
@@ -14,14 +15,15 @@ var Pv pv
 type pv struct{}
 
 type PvsResp struct {
-	Items []corev1.PersistentVolume `json:"items"`
-	Total int                       `json:"total"`
+	Items       []corev1.PersistentVolume `json:"items"`
+	Total       int                       `json:"total"`
+	SortColumns []string                  `json:"sort_columns"`
 }
 
 //获取pv列表，支持过滤、排序、分页
-func (p *pv) GetPvs(filterName string, limit, page int) (pvsResp *PvsResp, err error) {
+func (p *pv) GetPvs(client *kubernetes.Clientset, filter *FilterQuery, sort *SortQuery, limit, page int) (pvsResp *PvsResp, err error) {
 	//获取pvList类型的pv列表
-	pvList, err := K8s.ClientSet.CoreV1().PersistentVolumes().List(context.TODO(), metav1.ListOptions{})
+	pvList, err := p.list(client)
 	if err != nil {
 		logger.Error(errors.New("获取Pv列表失败, " + err.Error()))
 		return nil, errors.New("获取Pv列表失败, " + err.Error())
@@ -30,7 +32,8 @@ func (p *pv) GetPvs(filterName string, limit, page int) (pvsResp *PvsResp, err e
 	selectableData := &dataSelector{
 		GenericDataList: p.toCells(pvList.Items),
 		dataSelectQuery: &DataSelectQuery{
-			FilterQuery: &FilterQuery{Name: filterName},
+			FilterQuery: filter,
+			SortQuery:   sort,
 			PaginateQuery: &PaginateQuery{
 				Limit: limit,
 				Page:  page,
@@ -46,14 +49,15 @@ func (p *pv) GetPvs(filterName string, limit, page int) (pvsResp *PvsResp, err e
 	pvs := p.fromCells(data.GenericDataList)
 
 	return &PvsResp{
-		Items: pvs,
-		Total: total,
+		Items:       pvs,
+		Total:       total,
+		SortColumns: PvSortColumns,
 	}, nil
 }
 
 //获取pv详情
-func (p *pv) GetPvDetail(pvName string) (pv *corev1.PersistentVolume, err error) {
-	pv, err = K8s.ClientSet.CoreV1().PersistentVolumes().Get(context.TODO(), pvName, metav1.GetOptions{})
+func (p *pv) GetPvDetail(client *kubernetes.Clientset, pvName string) (pv *corev1.PersistentVolume, err error) {
+	pv, err = p.get(client, pvName)
 	if err != nil {
 		logger.Error(errors.New("获取Pv详情失败, " + err.Error()))
 		return nil, errors.New("获取Pv详情失败, " + err.Error())
@@ -63,8 +67,8 @@ func (p *pv) GetPvDetail(pvName string) (pv *corev1.PersistentVolume, err error)
 }
 
 //删除pv
-func (p *pv) DeletePv(pvName string) (err error) {
-	err = K8s.ClientSet.CoreV1().PersistentVolumes().Delete(context.TODO(), pvName, metav1.DeleteOptions{})
+func (p *pv) DeletePv(client *kubernetes.Clientset, pvName string) (err error) {
+	err = client.CoreV1().PersistentVolumes().Delete(context.TODO(), pvName, metav1.DeleteOptions{})
 	if err != nil {
 		logger.Error(errors.New("删除Pv失败, " + err.Error()))
 		return errors.New("删除Pv失败, " + err.Error())
@@ -89,3 +93,29 @@ func (p *pv) fromCells(cells []DataCell) []corev1.PersistentVolume {
 
 	return pvs
 }
+
+//获取pv列表，缓存可用时从缓存中读取，否则请求apiserver
+func (p *pv) list(client *kubernetes.Clientset) (*corev1.PersistentVolumeList, error) {
+	objs, ok := K8s.CacheList(client, "persistentvolumes", "")
+	if !ok {
+		return client.CoreV1().PersistentVolumes().List(context.TODO(), metav1.ListOptions{})
+	}
+	list := &corev1.PersistentVolumeList{Items: make([]corev1.PersistentVolume, len(objs))}
+	for i, obj := range objs {
+		list.Items[i] = *obj.(*corev1.PersistentVolume)
+	}
+	return list, nil
+}
+
+//获取单个pv，缓存可用时从缓存中读取，否则请求apiserver
+func (p *pv) get(client *kubernetes.Clientset, name string) (*corev1.PersistentVolume, error) {
+	obj, ok, err := K8s.CacheGet(client, "persistentvolumes", "", name)
+	if !ok {
+		return client.CoreV1().PersistentVolumes().Get(context.TODO(), name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	//缓存中的对象是共享的，返回副本避免被修改
+	return obj.(*corev1.PersistentVolume).DeepCopy(), nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/wonderivan/logger"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 var Pvc pvc
@@ -15,14 +16,16 @@ var Pvc pvc
 type pvc struct{}
 
 type PvcsResp struct {
-	Items []corev1.PersistentVolumeClaim `json:"items"`
-	Total int                            `json:"total"`
+	Items       []corev1.PersistentVolumeClaim `json:"items"`
+	Total       int                            `json:"total"`
+	Facets      []*NamespaceFacet              `json:"facets"`
+	SortColumns []string                       `json:"sort_columns"`
 }
 
 //获取pvc列表，支持过滤、排序、分页
-func (p *pvc) GetPvcs(filterName, namespace string, limit, page int) (pvcsResp *PvcsResp, err error) {
+func (p *pvc) GetPvcs(client *kubernetes.Clientset, filter *FilterQuery, sort *SortQuery, namespace string, limit, page int) (pvcsResp *PvcsResp, err error) {
 	//获取pvcList类型的pvc列表
-	pvcList, err := K8s.ClientSet.CoreV1().PersistentVolumeClaims(namespace).List(context.TODO(), metav1.ListOptions{})
+	pvcList, err := p.list(client, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取Pvc列表失败, " + err.Error()))
 		return nil, errors.New("获取Pvc列表失败, " + err.Error())
@@ -31,7 +34,8 @@ func (p *pvc) GetPvcs(filterName, namespace string, limit, page int) (pvcsResp *
 	selectableData := &dataSelector{
 		GenericDataList: p.toCells(pvcList.Items),
 		dataSelectQuery: &DataSelectQuery{
-			FilterQuery: &FilterQuery{Name: filterName},
+			FilterQuery: filter,
+			SortQuery:   sort,
 			PaginateQuery: &PaginateQuery{
 				Limit: limit,
 				Page:  page,
@@ -41,20 +45,24 @@ func (p *pvc) GetPvcs(filterName, namespace string, limit, page int) (pvcsResp *
 
 	filtered := selectableData.Filter()
 	total := len(filtered.GenericDataList)
+	//统计每个namespace的数量，需要在分页之前
+	facets := filtered.Facets()
 	data := filtered.Sort().Paginate()
 
 	//将[]DataCell类型的pvc列表转为v1.pvc列表
 	pvcs := p.fromCells(data.GenericDataList)
 
 	return &PvcsResp{
-		Items: pvcs,
-		Total: total,
+		Items:       pvcs,
+		Total:       total,
+		Facets:      facets,
+		SortColumns: PvcSortColumns,
 	}, nil
 }
 
 //获取pvc详情
-func (p *pvc) GetPvcDetail(pvcName, namespace string) (pvc *corev1.PersistentVolumeClaim, err error) {
-	pvc, err = K8s.ClientSet.CoreV1().PersistentVolumeClaims(namespace).Get(context.TODO(), pvcName, metav1.GetOptions{})
+func (p *pvc) GetPvcDetail(client *kubernetes.Clientset, pvcName, namespace string) (pvc *corev1.PersistentVolumeClaim, err error) {
+	pvc, err = p.get(client, pvcName, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取Pvc详情失败, " + err.Error()))
 		return nil, errors.New("获取Pvc详情失败, " + err.Error())
@@ -64,8 +72,8 @@ func (p *pvc) GetPvcDetail(pvcName, namespace string) (pvc *corev1.PersistentVol
 }
 
 //删除pvc
-func (p *pvc) DeletePvc(pvcName, namespace string) (err error) {
-	err = K8s.ClientSet.CoreV1().PersistentVolumeClaims(namespace).Delete(context.TODO(), pvcName, metav1.DeleteOptions{})
+func (p *pvc) DeletePvc(client *kubernetes.Clientset, pvcName, namespace string) (err error) {
+	err = client.CoreV1().PersistentVolumeClaims(namespace).Delete(context.TODO(), pvcName, metav1.DeleteOptions{})
 	if err != nil {
 		logger.Error(errors.New("删除Pvc失败, " + err.Error()))
 		return errors.New("删除Pvc失败, " + err.Error())
@@ -75,7 +83,7 @@ func (p *pvc) DeletePvc(pvcName, namespace string) (err error) {
 }
 
 //更新pvc
-func (p *pvc) UpdatePvc(namespace, content string) (err error) {
+func (p *pvc) UpdatePvc(client *kubernetes.Clientset, namespace, content string) (err error) {
 	var pvc = &corev1.PersistentVolumeClaim{}
 
 	err = json.Unmarshal([]byte(content), pvc)
@@ -84,7 +92,7 @@ func (p *pvc) UpdatePvc(namespace, content string) (err error) {
 		return errors.New("反序列化失败, " + err.Error())
 	}
 
-	_, err = K8s.ClientSet.CoreV1().PersistentVolumeClaims(namespace).Update(context.TODO(), pvc, metav1.UpdateOptions{})
+	_, err = client.CoreV1().PersistentVolumeClaims(namespace).Update(context.TODO(), pvc, metav1.UpdateOptions{})
 	if err != nil {
 		logger.Error(errors.New("更新Pvc失败, " + err.Error()))
 		return errors.New("更新Pvc失败, " + err.Error())
@@ -108,3 +116,29 @@ func (p *pvc) fromCells(cells []DataCell) []corev1.PersistentVolumeClaim {
 
 	return pvcs
 }
+
+//获取pvc列表，缓存可用时从缓存中读取，否则请求apiserver
+func (p *pvc) list(client *kubernetes.Clientset, namespace string) (*corev1.PersistentVolumeClaimList, error) {
+	objs, ok := K8s.CacheList(client, "persistentvolumeclaims", namespace)
+	if !ok {
+		return client.CoreV1().PersistentVolumeClaims(namespace).List(context.TODO(), metav1.ListOptions{})
+	}
+	list := &corev1.PersistentVolumeClaimList{Items: make([]corev1.PersistentVolumeClaim, len(objs))}
+	for i, obj := range objs {
+		list.Items[i] = *obj.(*corev1.PersistentVolumeClaim)
+	}
+	return list, nil
+}
+
+//获取单个pvc，缓存可用时从缓存中读取，否则请求apiserver
+func (p *pvc) get(client *kubernetes.Clientset, name, namespace string) (*corev1.PersistentVolumeClaim, error) {
+	obj, ok, err := K8s.CacheGet(client, "persistentvolumeclaims", namespace, name)
+	if !ok {
+		return client.CoreV1().PersistentVolumeClaims(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	//缓存中的对象是共享的，返回副本避免被修改
+	return obj.(*corev1.PersistentVolumeClaim).DeepCopy(), nil
+}
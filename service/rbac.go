@@ -0,0 +1,166 @@
+package service
+
+import (
+	"errors"
+	"k8s-platform/dao"
+	"k8s-platform/model"
+)
+
+var RBAC rbac
+
+type rbac struct{}
+
+//内置角色
+const (
+	RoleViewer    = "viewer"
+	RoleDeveloper = "developer"
+	RoleAdmin     = "admin"
+)
+
+//权限范围
+const (
+	//namespace级资源，按请求中的cluster和namespace匹配角色绑定
+	ScopeNamespace = "namespace"
+	//集群级资源，如node、pv，需要集群范围（namespace为空）的角色绑定
+	ScopeCluster = "cluster"
+	//平台管理，如集群、用户、角色绑定，需要所有集群范围（cluster和namespace都为空）的角色绑定
+	ScopePlatform = "platform"
+	//登录用户即可访问，如修改自己的密码
+	ScopeSelf = "self"
+)
+
+//rule定义角色可以对哪些资源执行哪些操作，*表示全部
+type rule struct {
+	resources []string
+	verbs     []string
+}
+
+//viewer可以查看的资源，secret中包含敏感数据，不对viewer开放
+var viewableResources = []string{
+	"workflow", "pod", "deployment", "daemonset", "statefulset", "service", "ingress",
+	"configmap", "pvc", "node", "namespace", "pv",
+}
+
+//developer可以修改的资源
+var editableResources = []string{
+	"workflow", "pod", "deployment", "daemonset", "statefulset", "service", "ingress",
+	"configmap", "secret", "pvc",
+}
+
+var roleRules = map[string][]rule{
+	RoleViewer: {
+		{resources: viewableResources, verbs: []string{"get", "list"}},
+		{resources: []string{"pod"}, verbs: []string{"log"}},
+	},
+	RoleDeveloper: {
+		{resources: viewableResources, verbs: []string{"get", "list"}},
+		{resources: editableResources, verbs: []string{"get", "list", "create", "update", "delete"}},
+		{resources: []string{"pod"}, verbs: []string{"log", "exec", "portforward"}},
+	},
+	RoleAdmin: {
+		{resources: []string{"*"}, verbs: []string{"*"}},
+	},
+}
+
+//Permission定义一次请求需要的权限
+type Permission struct {
+	Cluster   string
+	Namespace string
+	Resource  string
+	Verb      string
+	Scope     string
+}
+
+//判断用户是否拥有权限
+func (r *rbac) Authorize(username string, perm *Permission) (allowed bool, err error) {
+	if perm.Scope == ScopeSelf {
+		return true, nil
+	}
+	bindings, err := dao.RoleBinding.GetByUsername(username)
+	if err != nil {
+		return false, err
+	}
+	for _, binding := range bindings {
+		if matchScope(binding, perm) && roleAllows(binding.Role, perm.Resource, perm.Verb) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//获取用户在集群中对某类资源有权限的namespace
+//all为true时表示拥有集群内所有namespace的权限，此时namespaces为空
+func (r *rbac) AllowedNamespaces(username, cluster, resource, verb string) (all bool, namespaces []string, err error) {
+	bindings, err := dao.RoleBinding.GetByUsername(username)
+	if err != nil {
+		return false, nil, err
+	}
+	for _, binding := range bindings {
+		if binding.Cluster != "" && binding.Cluster != cluster {
+			continue
+		}
+		if !roleAllows(binding.Role, resource, verb) {
+			continue
+		}
+		if binding.Namespace == "" {
+			return true, nil, nil
+		}
+		namespaces = append(namespaces, binding.Namespace)
+	}
+	return false, namespaces, nil
+}
+
+//获取角色绑定列表
+func (r *rbac) GetBindings(username string, page, limit int) (data *dao.RoleBindingResp, err error) {
+	return dao.RoleBinding.GetList(username, page, limit)
+}
+
+//创建角色绑定
+func (r *rbac) CreateBinding(binding *model.RoleBinding) (err error) {
+	if _, ok := roleRules[binding.Role]; !ok {
+		return errors.New("角色" + binding.Role + "不存在")
+	}
+	if _, err = User.getUser(binding.Username); err != nil {
+		return err
+	}
+	return dao.RoleBinding.Add(binding)
+}
+
+//删除角色绑定
+func (r *rbac) DeleteBinding(id int) (err error) {
+	return dao.RoleBinding.DelById(id)
+}
+
+//判断角色绑定的范围是否覆盖请求的cluster和namespace
+func matchScope(binding *model.RoleBinding, perm *Permission) bool {
+	switch perm.Scope {
+	case ScopePlatform:
+		return binding.Cluster == "" && binding.Namespace == ""
+	case ScopeCluster:
+		return (binding.Cluster == "" || binding.Cluster == perm.Cluster) && binding.Namespace == ""
+	case ScopeNamespace:
+		//请求的namespace为空表示查询所有namespace，需要集群范围的绑定
+		return (binding.Cluster == "" || binding.Cluster == perm.Cluster) &&
+			(binding.Namespace == "" || binding.Namespace == perm.Namespace)
+	}
+	return false
+}
+
+//判断角色是否允许对资源执行操作
+func roleAllows(role, resource, verb string) bool {
+	for _, rule := range roleRules[role] {
+		if contains(rule.resources, resource) && contains(rule.verbs, verb) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, item string) bool {
+	for _, v := range list {
+		if v == "*" || v == item {
+			return true
+		}
+	}
+	return false
+}
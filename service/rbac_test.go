@@ -0,0 +1,57 @@
+package service
+
+import (
+	"k8s-platform/model"
+	"testing"
+)
+
+func TestMatchScope(t *testing.T) {
+	cases := []struct {
+		name    string
+		binding *model.RoleBinding
+		perm    *Permission
+		match   bool
+	}{
+		{"所有集群绑定覆盖平台管理", &model.RoleBinding{}, &Permission{Scope: ScopePlatform}, true},
+		{"集群绑定不覆盖平台管理", &model.RoleBinding{Cluster: "prod"}, &Permission{Scope: ScopePlatform}, false},
+		{"namespace绑定不覆盖平台管理", &model.RoleBinding{Namespace: "dev"}, &Permission{Scope: ScopePlatform}, false},
+		{"所有集群绑定覆盖集群资源", &model.RoleBinding{}, &Permission{Cluster: "prod", Scope: ScopeCluster}, true},
+		{"同集群绑定覆盖集群资源", &model.RoleBinding{Cluster: "prod"}, &Permission{Cluster: "prod", Scope: ScopeCluster}, true},
+		{"其他集群绑定不覆盖集群资源", &model.RoleBinding{Cluster: "test"}, &Permission{Cluster: "prod", Scope: ScopeCluster}, false},
+		{"namespace绑定不覆盖集群资源", &model.RoleBinding{Cluster: "prod", Namespace: "dev"}, &Permission{Cluster: "prod", Scope: ScopeCluster}, false},
+		{"集群绑定覆盖namespace", &model.RoleBinding{Cluster: "prod"}, &Permission{Cluster: "prod", Namespace: "dev", Scope: ScopeNamespace}, true},
+		{"同namespace绑定", &model.RoleBinding{Cluster: "prod", Namespace: "dev"}, &Permission{Cluster: "prod", Namespace: "dev", Scope: ScopeNamespace}, true},
+		{"其他namespace绑定", &model.RoleBinding{Cluster: "prod", Namespace: "dev"}, &Permission{Cluster: "prod", Namespace: "kube-system", Scope: ScopeNamespace}, false},
+		{"其他集群的同名namespace", &model.RoleBinding{Cluster: "test", Namespace: "dev"}, &Permission{Cluster: "prod", Namespace: "dev", Scope: ScopeNamespace}, false},
+		{"namespace绑定不覆盖所有namespace", &model.RoleBinding{Cluster: "prod", Namespace: "dev"}, &Permission{Cluster: "prod", Scope: ScopeNamespace}, false},
+		{"未知范围", &model.RoleBinding{}, &Permission{Scope: "unknown"}, false},
+	}
+	for _, c := range cases {
+		if got := matchScope(c.binding, c.perm); got != c.match {
+			t.Errorf("%s：期望%v，实际%v", c.name, c.match, got)
+		}
+	}
+}
+
+func TestRoleAllows(t *testing.T) {
+	cases := []struct {
+		role, resource, verb string
+		allowed              bool
+	}{
+		{RoleViewer, "pod", "list", true},
+		{RoleViewer, "pod", "log", true},
+		{RoleViewer, "pod", "exec", false},
+		{RoleViewer, "secret", "get", false},
+		{RoleDeveloper, "secret", "update", true},
+		{RoleDeveloper, "pod", "portforward", true},
+		{RoleDeveloper, "node", "delete", false},
+		{RoleDeveloper, "user", "create", false},
+		{RoleAdmin, "user", "create", true},
+		{"unknown", "pod", "get", false},
+	}
+	for _, c := range cases {
+		if got := roleAllows(c.role, c.resource, c.verb); got != c.allowed {
+			t.Errorf("%s对%s执行%s：期望%v，实际%v", c.role, c.resource, c.verb, c.allowed, got)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/wonderivan/logger"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 var Secret secret
@@ -15,14 +16,16 @@ var Secret secret
 type secret struct{}
 
 type SecretsResp struct {
-	Items []corev1.Secret `json:"items"`
-	Total int             `json:"total"`
+	Items       []corev1.Secret   `json:"items"`
+	Total       int               `json:"total"`
+	Facets      []*NamespaceFacet `json:"facets"`
+	SortColumns []string          `json:"sort_columns"`
 }
 
 //获取secret列表，支持过滤、排序、分页
-func (s *secret) GetSecrets(filterName, namespace string, limit, page int) (secretsResp *SecretsResp, err error) {
+func (s *secret) GetSecrets(client *kubernetes.Clientset, filter *FilterQuery, sort *SortQuery, namespace string, limit, page int) (secretsResp *SecretsResp, err error) {
 	//获取secretList类型的secret列表
-	secretList, err := K8s.ClientSet.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{})
+	secretList, err := s.list(client, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取Secret列表失败, " + err.Error()))
 		return nil, errors.New("获取Secret列表失败, " + err.Error())
@@ -31,7 +34,8 @@ func (s *secret) GetSecrets(filterName, namespace string, limit, page int) (secr
 	selectableData := &dataSelector{
 		GenericDataList: s.toCells(secretList.Items),
 		dataSelectQuery: &DataSelectQuery{
-			FilterQuery: &FilterQuery{Name: filterName},
+			FilterQuery: filter,
+			SortQuery:   sort,
 			PaginateQuery: &PaginateQuery{
 				Limit: limit,
 				Page:  page,
@@ -41,20 +45,24 @@ func (s *secret) GetSecrets(filterName, namespace string, limit, page int) (secr
 
 	filtered := selectableData.Filter()
 	total := len(filtered.GenericDataList)
+	//统计每个namespace的数量，需要在分页之前
+	facets := filtered.Facets()
 	data := filtered.Sort().Paginate()
 
 	//将[]DataCell类型的secret列表转为v1.secret列表
 	secrets := s.fromCells(data.GenericDataList)
 
 	return &SecretsResp{
-		Items: secrets,
-		Total: total,
+		Items:       secrets,
+		Total:       total,
+		Facets:      facets,
+		SortColumns: SecretSortColumns,
 	}, nil
 }
 
 //获取secret详情
-func (s *secret) GetSecretDetail(secretName, namespace string) (secret *corev1.Secret, err error) {
-	secret, err = K8s.ClientSet.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+func (s *secret) GetSecretDetail(client *kubernetes.Clientset, secretName, namespace string) (secret *corev1.Secret, err error) {
+	secret, err = s.get(client, secretName, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取Secret详情失败, " + err.Error()))
 		return nil, errors.New("获取Secret详情失败, " + err.Error())
@@ -64,8 +72,8 @@ func (s *secret) GetSecretDetail(secretName, namespace string) (secret *corev1.S
 }
 
 //删除secret
-func (s *secret) DeleteSecret(secretName, namespace string) (err error) {
-	err = K8s.ClientSet.CoreV1().Secrets(namespace).Delete(context.TODO(), secretName, metav1.DeleteOptions{})
+func (s *secret) DeleteSecret(client *kubernetes.Clientset, secretName, namespace string) (err error) {
+	err = client.CoreV1().Secrets(namespace).Delete(context.TODO(), secretName, metav1.DeleteOptions{})
 	if err != nil {
 		logger.Error(errors.New("删除Secret失败, " + err.Error()))
 		return errors.New("删除Secret失败, " + err.Error())
@@ -75,7 +83,7 @@ func (s *secret) DeleteSecret(secretName, namespace string) (err error) {
 }
 
 //更新secret
-func (s *secret) UpdateSecret(namespace, content string) (err error) {
+func (s *secret) UpdateSecret(client *kubernetes.Clientset, namespace, content string) (err error) {
 	var secret = &corev1.Secret{}
 
 	err = json.Unmarshal([]byte(content), secret)
@@ -84,7 +92,7 @@ func (s *secret) UpdateSecret(namespace, content string) (err error) {
 		return errors.New("反序列化失败, " + err.Error())
 	}
 
-	_, err = K8s.ClientSet.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+	_, err = client.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
 	if err != nil {
 		logger.Error(errors.New("更新Secret失败, " + err.Error()))
 		return errors.New("更新Secret失败, " + err.Error())
@@ -108,3 +116,29 @@ func (s *secret) fromCells(cells []DataCell) []corev1.Secret {
 
 	return secrets
 }
+
+//获取secret列表，缓存可用时从缓存中读取，否则请求apiserver
+func (s *secret) list(client *kubernetes.Clientset, namespace string) (*corev1.SecretList, error) {
+	objs, ok := K8s.CacheList(client, "secrets", namespace)
+	if !ok {
+		return client.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{})
+	}
+	list := &corev1.SecretList{Items: make([]corev1.Secret, len(objs))}
+	for i, obj := range objs {
+		list.Items[i] = *obj.(*corev1.Secret)
+	}
+	return list, nil
+}
+
+//获取单个secret，缓存可用时从缓存中读取，否则请求apiserver
+func (s *secret) get(client *kubernetes.Clientset, name, namespace string) (*corev1.Secret, error) {
+	obj, ok, err := K8s.CacheGet(client, "secrets", namespace, name)
+	if !ok {
+		return client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	//缓存中的对象是共享的，返回副本避免被修改
+	return obj.(*corev1.Secret).DeepCopy(), nil
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/wonderivan/logger"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
 )
 
 /**
@@ -21,8 +23,10 @@ type service struct{}
 
 //定义列表的返回内容，Items是deployment元素列表，Total为deployment元素数量
 type ServicesResp struct {
-	Items []corev1.Service `json:"items"`
-	Total int              `json:"total"`
+	Items       []corev1.Service  `json:"items"`
+	Total       int               `json:"total"`
+	Facets      []*NamespaceFacet `json:"facets"`
+	SortColumns []string          `json:"sort_columns"`
 }
 
 //定义DeploysNp类型，用于返回namespace中deployment的数量
@@ -49,6 +53,7 @@ func (s *service) fromCells(cells []DataCell) []corev1.Service {
 //定义ServiceCreate结构体，用于创建service需要的参数属性的定义
 type ServiceCreate struct {
 	Name          string            `json:"name"`
+	Cluster       string            `json:"cluster"`
 	Namespace     string            `json:"namespace"`
 	Type          string            `json:"type"`
 	ContainerPort int32             `json:"container_port"`
@@ -58,9 +63,9 @@ type ServiceCreate struct {
 }
 
 //获取service列表，支持过滤、排序、分页
-func (s *service) GetServices(filterName, namespace string, limit, page int) (servicesResp *ServicesResp, err error) {
+func (s *service) GetServices(client *kubernetes.Clientset, filter *FilterQuery, sort *SortQuery, namespace string, limit, page int) (servicesResp *ServicesResp, err error) {
 	//获取serviceList类型的service列表
-	serviceList, err := K8s.ClientSet.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{})
+	serviceList, err := s.list(client, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取Service列表失败," + err.Error()))
 		return nil, errors.New("获取Service列表失败，" + err.Error())
@@ -69,7 +74,8 @@ func (s *service) GetServices(filterName, namespace string, limit, page int) (se
 	selectableData := &dataSelector{
 		GenericDataList: s.toCells(serviceList.Items),
 		dataSelectQuery: &DataSelectQuery{
-			FilterQuery: &FilterQuery{Name: filterName},
+			FilterQuery: filter,
+			SortQuery:   sort,
 			PaginateQuery: &PaginateQuery{
 				Limit: limit,
 				Page:  page,
@@ -78,18 +84,22 @@ func (s *service) GetServices(filterName, namespace string, limit, page int) (se
 	}
 	filtered := selectableData.Filter()
 	total := len(filtered.GenericDataList)
+	//统计每个namespace的数量，需要在分页之前
+	facets := filtered.Facets()
 	data := filtered.Sort().Paginate()
 	//将[]DataCell类型的service列表转为v1.service列表
 	services := s.fromCells(data.GenericDataList)
 	return &ServicesResp{
-		Items: services,
-		Total: total,
+		Items:       services,
+		Total:       total,
+		Facets:      facets,
+		SortColumns: ServiceSortColumns,
 	}, nil
 }
 
 //获取service详情
-func (s *service) GetServiceDetail(serviceName, namespace string) (service *corev1.Service, err error) {
-	service, err = K8s.ClientSet.CoreV1().Services(namespace).Get(context.TODO(), serviceName, metav1.GetOptions{})
+func (s *service) GetServiceDetail(client *kubernetes.Clientset, serviceName, namespace string) (service *corev1.Service, err error) {
+	service, err = s.get(client, serviceName, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取Service详情失败，" + err.Error()))
 		return nil, errors.New("获取Service详情失败，" + err.Error())
@@ -98,7 +108,7 @@ func (s *service) GetServiceDetail(serviceName, namespace string) (service *core
 }
 
 //创建service，接收ServiceCreate对象
-func (s *service) CreateService(data *ServiceCreate) (err error) {
+func (s *service) CreateService(client *kubernetes.Clientset, data *ServiceCreate) (err error) {
 	//将data中的数据组装成corev1.Service对象
 	service := &corev1.Service{
 		//ObjectMeta中定义资源名、命名空间以及标签
@@ -129,7 +139,7 @@ func (s *service) CreateService(data *ServiceCreate) (err error) {
 		service.Spec.Ports[0].NodePort = data.NodePort
 	}
 	//创建Service
-	_, err = K8s.ClientSet.CoreV1().Services(data.Namespace).Create(context.TODO(), service, metav1.CreateOptions{})
+	_, err = client.CoreV1().Services(data.Namespace).Create(context.TODO(), service, metav1.CreateOptions{})
 	if err != nil {
 		logger.Error(errors.New("创建Service失败，" + err.Error()))
 		return errors.New("创建Service失败，" + err.Error())
@@ -138,27 +148,53 @@ func (s *service) CreateService(data *ServiceCreate) (err error) {
 }
 
 //删除service
-func (s *service) DeleteService(serviceName, namespace string) (err error) {
-	err = K8s.ClientSet.CoreV1().Services(namespace).Delete(context.TODO(), serviceName, metav1.DeleteOptions{})
+func (s *service) DeleteService(client *kubernetes.Clientset, serviceName, namespace string) (err error) {
+	err = client.CoreV1().Services(namespace).Delete(context.TODO(), serviceName, metav1.DeleteOptions{})
 	if err != nil {
 		logger.Error(errors.New("删除Service失败，" + err.Error()))
-		return errors.New("删除Service失败，" + err.Error())
+		return fmt.Errorf("删除Service失败，%w", err)
 	}
 	return nil
 }
 
 //更新service
-func (s *service) UpdateService(namespace, content string) (err error) {
+func (s *service) UpdateService(client *kubernetes.Clientset, namespace, content string) (err error) {
 	var service = &corev1.Service{}
 	err = json.Unmarshal([]byte(content), service)
 	if err != nil {
 		logger.Error(errors.New("反序列化失败，" + err.Error()))
 		return errors.New("反序列化失败," + err.Error())
 	}
-	_, err = K8s.ClientSet.CoreV1().Services(namespace).Update(context.TODO(), service, metav1.UpdateOptions{})
+	_, err = client.CoreV1().Services(namespace).Update(context.TODO(), service, metav1.UpdateOptions{})
 	if err != nil {
 		logger.Error(errors.New("更新service失败，" + err.Error()))
 		return errors.New("更新service失败，" + err.Error())
 	}
 	return nil
 }
+
+//获取service列表，缓存可用时从缓存中读取，否则请求apiserver
+func (s *service) list(client *kubernetes.Clientset, namespace string) (*corev1.ServiceList, error) {
+	objs, ok := K8s.CacheList(client, "services", namespace)
+	if !ok {
+		return client.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{})
+	}
+	list := &corev1.ServiceList{Items: make([]corev1.Service, len(objs))}
+	for i, obj := range objs {
+		list.Items[i] = *obj.(*corev1.Service)
+	}
+	return list, nil
+}
+
+//获取单个service，缓存可用时从缓存中读取，否则请求apiserver
+func (s *service) get(client *kubernetes.Clientset, name, namespace string) (*corev1.Service, error) {
+	obj, ok, err := K8s.CacheGet(client, "services", namespace, name)
+	if !ok {
+		return client.CoreV1().Services(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	//缓存中的对象是共享的，返回副本避免被修改
+	return obj.(*corev1.Service).DeepCopy(), nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/wonderivan/logger"
 	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 var StatefulSet statefulSet
@@ -15,14 +16,16 @@ var StatefulSet statefulSet
 type statefulSet struct{}
 
 type StatusfulSetsResp struct {
-	Items []appsv1.StatefulSet `json:"items"`
-	Total int                  `json:"total"`
+	Items       []appsv1.StatefulSet `json:"items"`
+	Total       int                  `json:"total"`
+	Facets      []*NamespaceFacet    `json:"facets"`
+	SortColumns []string             `json:"sort_columns"`
 }
 
 //获取statefulset列表，支持过滤、排序、分页
-func (s *statefulSet) GetStatefulSets(filterName, namespace string, limit, page int) (statusfulSetsResp *StatusfulSetsResp, err error) {
+func (s *statefulSet) GetStatefulSets(client *kubernetes.Clientset, filter *FilterQuery, sort *SortQuery, namespace string, limit, page int) (statusfulSetsResp *StatusfulSetsResp, err error) {
 	//获取statefulSetList类型的statefulSet列表
-	statefulSetList, err := K8s.ClientSet.AppsV1().StatefulSets(namespace).List(context.TODO(), metav1.ListOptions{})
+	statefulSetList, err := s.list(client, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取StatefulSet列表失败, " + err.Error()))
 		return nil, errors.New("获取StatefulSet列表失败, " + err.Error())
@@ -31,7 +34,8 @@ func (s *statefulSet) GetStatefulSets(filterName, namespace string, limit, page
 	selectableData := &dataSelector{
 		GenericDataList: s.toCells(statefulSetList.Items),
 		dataSelectQuery: &DataSelectQuery{
-			FilterQuery: &FilterQuery{Name: filterName},
+			FilterQuery: filter,
+			SortQuery:   sort,
 			PaginateQuery: &PaginateQuery{
 				Limit: limit,
 				Page:  page,
@@ -41,20 +45,24 @@ func (s *statefulSet) GetStatefulSets(filterName, namespace string, limit, page
 
 	filtered := selectableData.Filter()
 	total := len(filtered.GenericDataList)
+	//统计每个namespace的数量，需要在分页之前
+	facets := filtered.Facets()
 	data := filtered.Sort().Paginate()
 
 	//将[]DataCell类型的statefulset列表转为v1.statefulset列表
 	statefulSets := s.fromCells(data.GenericDataList)
 
 	return &StatusfulSetsResp{
-		Items: statefulSets,
-		Total: total,
+		Items:       statefulSets,
+		Total:       total,
+		Facets:      facets,
+		SortColumns: StatefulSetSortColumns,
 	}, nil
 }
 
 //获取statefulset详情
-func (s *statefulSet) GetStatefulSetDetail(statefulSetName, namespace string) (statefulSet *appsv1.StatefulSet, err error) {
-	statefulSet, err = K8s.ClientSet.AppsV1().StatefulSets(namespace).Get(context.TODO(), statefulSetName, metav1.GetOptions{})
+func (s *statefulSet) GetStatefulSetDetail(client *kubernetes.Clientset, statefulSetName, namespace string) (statefulSet *appsv1.StatefulSet, err error) {
+	statefulSet, err = s.get(client, statefulSetName, namespace)
 	if err != nil {
 		logger.Error(errors.New("获取StatefulSet详情失败, " + err.Error()))
 		return nil, errors.New("获取StatefulSet详情失败, " + err.Error())
@@ -64,8 +72,8 @@ func (s *statefulSet) GetStatefulSetDetail(statefulSetName, namespace string) (s
 }
 
 //删除statefulset
-func (s *statefulSet) DeleteStatefulSet(statefulSetName, namespace string) (err error) {
-	err = K8s.ClientSet.AppsV1().StatefulSets(namespace).Delete(context.TODO(), statefulSetName, metav1.DeleteOptions{})
+func (s *statefulSet) DeleteStatefulSet(client *kubernetes.Clientset, statefulSetName, namespace string) (err error) {
+	err = client.AppsV1().StatefulSets(namespace).Delete(context.TODO(), statefulSetName, metav1.DeleteOptions{})
 	if err != nil {
 		logger.Error(errors.New("删除StatefulSet失败, " + err.Error()))
 		return errors.New("删除StatefulSet失败, " + err.Error())
@@ -75,7 +83,7 @@ func (s *statefulSet) DeleteStatefulSet(statefulSetName, namespace string) (err
 }
 
 //更新statefulset
-func (s *statefulSet) UpdateStatefulSet(namespace, content string) (err error) {
+func (s *statefulSet) UpdateStatefulSet(client *kubernetes.Clientset, namespace, content string) (err error) {
 	var statefulSet = &appsv1.StatefulSet{}
 
 	err = json.Unmarshal([]byte(content), statefulSet)
@@ -84,7 +92,7 @@ func (s *statefulSet) UpdateStatefulSet(namespace, content string) (err error) {
 		return errors.New("反序列化失败, " + err.Error())
 	}
 
-	_, err = K8s.ClientSet.AppsV1().StatefulSets(namespace).Update(context.TODO(), statefulSet, metav1.UpdateOptions{})
+	_, err = client.AppsV1().StatefulSets(namespace).Update(context.TODO(), statefulSet, metav1.UpdateOptions{})
 	if err != nil {
 		logger.Error(errors.New("更新StatefulSet失败, " + err.Error()))
 		return errors.New("更新StatefulSet失败, " + err.Error())
@@ -108,3 +116,29 @@ func (s *statefulSet) fromCells(cells []DataCell) []appsv1.StatefulSet {
 
 	return statefulSets
 }
+
+//获取statefulset列表，缓存可用时从缓存中读取，否则请求apiserver
+func (s *statefulSet) list(client *kubernetes.Clientset, namespace string) (*appsv1.StatefulSetList, error) {
+	objs, ok := K8s.CacheList(client, "statefulsets", namespace)
+	if !ok {
+		return client.AppsV1().StatefulSets(namespace).List(context.TODO(), metav1.ListOptions{})
+	}
+	list := &appsv1.StatefulSetList{Items: make([]appsv1.StatefulSet, len(objs))}
+	for i, obj := range objs {
+		list.Items[i] = *obj.(*appsv1.StatefulSet)
+	}
+	return list, nil
+}
+
+//获取单个statefulset，缓存可用时从缓存中读取，否则请求apiserver
+func (s *statefulSet) get(client *kubernetes.Clientset, name, namespace string) (*appsv1.StatefulSet, error) {
+	obj, ok, err := K8s.CacheGet(client, "statefulsets", namespace, name)
+	if !ok {
+		return client.AppsV1().StatefulSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	//缓存中的对象是共享的，返回副本避免被修改
+	return obj.(*appsv1.StatefulSet).DeepCopy(), nil
+}
@@ -1,12 +1,19 @@
 package service
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"k8s-platform/config"
+	"k8s-platform/model"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"k8s.io/client-go/kubernetes/scheme"
@@ -14,8 +21,12 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/wonderivan/logger"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+	utilexec "k8s.io/client-go/util/exec"
 )
 
 /**
@@ -27,31 +38,220 @@ var Terminal terminal
 type terminal struct{}
 
 //定义websocket的handler方法
-func (t *terminal) WsHandler(w http.ResponseWriter, r *http.Request) {
-	//加载K8s配置
-	conf, err := clientcmd.BuildConfigFromFlags("", config.Kubeconfig)
+//username和ip为发起请求的用户和客户端地址，用于审计日志；建立websocket连接之前的错误返回给调用方
+func (t *terminal) WsHandler(w http.ResponseWriter, r *http.Request, username, ip string) error {
+	return t.serve(w, r, username, ip, false)
+}
+
+//在pod中添加临时调试容器，共享container_name指定容器的进程命名空间，容器启动后连接到调试容器的终端
+//用于没有shell的镜像，调试容器的镜像为config.DebugImage
+func (t *terminal) DebugHandler(w http.ResponseWriter, r *http.Request, username, ip string) error {
+	return t.serve(w, r, username, ip, true)
+}
+
+//debug为true时先创建临时调试容器，再attach到调试容器，否则在容器中执行shell
+func (t *terminal) serve(w http.ResponseWriter, r *http.Request, username, ip string, debug bool) error {
+	//解析form入参，获取cluster、namespacce、podName、containerName参数
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	cluster := r.Form.Get("cluster")
+	//加载集群对应的K8s配置和clientSet
+	conf, err := K8s.GetConfig(cluster)
 	if err != nil {
-		logger.Error("创建k8s配置失败，" + err.Error())
+		logger.Error("获取k8s配置失败，" + err.Error())
+		return err
 	}
-	//解析form入参，获取namespacce、podName、containerName参数
-	if err := r.ParseForm(); err != nil {
-		return
+	client, err := K8s.GetClient(cluster)
+	if err != nil {
+		logger.Error("获取k8s clientSet失败，" + err.Error())
+		return err
 	}
 	namespace := r.Form.Get("namespace")
 	podName := r.Form.Get("pod_name")
 	containerName := r.Form.Get("container_name")
+	if namespace == "" || podName == "" {
+		return errors.New("namespace和pod_name不能为空")
+	}
+	//指定command时只执行该命令，否则按config.TerminalShells的顺序依次尝试，使用第一个能启动的shell
+	//调试容器的主进程就是shell，command为nil表示attach到容器
+	var commands [][]string
+	recordCommand := config.TerminalShells
+	if debug {
+		commands = [][]string{nil}
+		recordCommand = "debug " + config.DebugImage
+	} else if command := r.Form["command"]; len(command) > 0 {
+		commands = [][]string{command}
+		recordCommand = strings.Join(command, " ")
+	} else {
+		commands = terminalShells()
+	}
 	logger.Info("exec pod: %s,container: %s,namespace: %s\n", podName, containerName, namespace)
+	//记录终端会话的审计日志，Latency为会话时长
+	start := time.Now()
+	record := &model.Audit{
+		Username:  username,
+		IP:        ip,
+		Cluster:   cluster,
+		Namespace: namespace,
+		Resource:  "pod",
+		Name:      podName,
+		Verb:      "exec",
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Message:   "container: " + containerName,
+	}
+	if record.Cluster == "" {
+		record.Cluster = config.DefaultCluster
+	}
+	defer func() {
+		record.Latency = time.Since(start).Milliseconds()
+		Audit.Record(record)
+	}()
+	//登记会话，超过并发数量上限时拒绝
+	id, err := TerminalSessions.Acquire(&TerminalSessionInfo{
+		Username:  username,
+		IP:        ip,
+		Cluster:   record.Cluster,
+		Namespace: namespace,
+		Pod:       podName,
+		Container: containerName,
+		Command:   recordCommand,
+		StartTime: start,
+	})
+	if err != nil {
+		record.Result = AuditFailure
+		record.Message = err.Error()
+		return err
+	}
+	defer TerminalSessions.Release(id)
 	//new一个TerminalSession类型的pty实例
 	pty, err := NewTerminalSession(w, r, nil)
 	if err != nil {
+		//升级失败时upgrader已经返回了http错误
 		logger.Error("get pty failed: %v\n", err)
-		return
+		record.Result = AuditFailure
+		record.Message = err.Error()
+		return nil
 	}
 	//处理关闭
 	defer func() {
 		logger.Info("close session.")
 		pty.Close()
 	}()
+	//录制会话，录像无法创建时不允许使用终端
+	pty.recorder, err = TerminalRecord.Start(&model.TerminalRecord{
+		Username:  username,
+		IP:        ip,
+		Cluster:   record.Cluster,
+		Namespace: namespace,
+		Pod:       podName,
+		Container: containerName,
+		Command:   recordCommand,
+	})
+	if err != nil {
+		record.Result = AuditFailure
+		record.Message = err.Error()
+		pty.Write([]byte(err.Error()))
+		return nil
+	}
+	defer pty.recorder.Close()
+	pty.Listen()
+	//管理员在升级前已经终止会话时直接结束
+	if !TerminalSessions.Attach(id, pty) {
+		record.Result = AuditFailure
+		record.Message = pty.Terminated()
+		return nil
+	}
+	go t.watch(pty, start)
+	if debug {
+		containerName, err = t.startDebugContainer(client, namespace, podName, containerName, pty)
+		if err != nil {
+			record.Result = AuditFailure
+			record.Message = err.Error()
+			pty.Write([]byte(err.Error()))
+			return nil
+		}
+	}
+	for i, command := range commands {
+		record.Message = fmt.Sprintf("container: %s, command: %s", containerName, strings.Join(command, " "))
+		if command == nil {
+			record.Message = fmt.Sprintf("container: %s, attach", containerName)
+		}
+		//建立链接之后从请求的stream中发送、读取数据
+		stdin, stop := pty.stdin()
+		err = t.stream(conf, client, namespace, podName, containerName, command, remotecommand.StreamOptions{
+			Stdin:             stdin,
+			Stdout:            pty,
+			Stderr:            pty,
+			TerminalSizeQueue: pty,
+			Tty:               pty.tty,
+		}, pty.conn.set)
+		stop()
+		//会话被终止时不再尝试其他shell
+		if reason := pty.Terminated(); reason != "" {
+			record.Result = AuditFailure
+			record.Message = fmt.Sprintf("container: %s, command: %s, %s", containerName, strings.Join(command, " "), reason)
+			break
+		}
+		if err == nil {
+			break
+		}
+		//shell不存在时终端没有任何输出，继续尝试下一个shell
+		if pty.Written() == 0 && i < len(commands)-1 {
+			logger.Info("exec pod: %s, command: %s failed, try next shell: %v", podName, strings.Join(command, " "), err)
+			continue
+		}
+		msg := fmt.Sprintf("Exec to pod error! err: %v", err)
+		if pty.Written() == 0 && len(commands) > 1 {
+			msg = fmt.Sprintf("容器中没有可用的shell，已尝试%s，最后一次错误：%v", config.TerminalShells, err)
+		}
+		logger.Info(msg)
+		record.Result = AuditFailure
+		record.Message = msg
+		//将报错返回出去
+		pty.Write([]byte(msg))
+		//标记退出stream流
+		pty.Done()
+		break
+	}
+	return nil
+}
+
+//检查会话的空闲时间和持续时间，超过config.TerminalIdleTimeout或config.TerminalMaxDuration时终止会话
+func (t *terminal) watch(pty *TerminalSession, start time.Time) {
+	ticker := time.NewTicker(terminalCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-pty.doneChan:
+			return
+		case <-ticker.C:
+		}
+		if config.TerminalMaxDuration > 0 && time.Since(start) > config.TerminalMaxDuration {
+			pty.Terminate(fmt.Sprintf("会话时长超过%s，已断开", config.TerminalMaxDuration))
+			return
+		}
+		if config.TerminalIdleTimeout > 0 && time.Since(pty.LastActive()) > config.TerminalIdleTimeout {
+			pty.Terminate(fmt.Sprintf("会话空闲超过%s，已断开", config.TerminalIdleTimeout))
+			return
+		}
+	}
+}
+
+//解析config.TerminalShells，每一项为一个命令，参数以空格分隔
+func terminalShells() (shells [][]string) {
+	for _, shell := range strings.Split(config.TerminalShells, ",") {
+		if command := strings.Fields(shell); len(command) > 0 {
+			shells = append(shells, command)
+		}
+	}
+	return shells
+}
+
+//在容器中执行命令，options中的Stdin、Stdout、Stderr为空时不建立对应的流，command为nil时attach到容器的主进程
+//track不为空时在连接建立后回调，关闭该连接可以强制结束命令
+func (t *terminal) stream(conf *rest.Config, client *kubernetes.Clientset, namespace, podName, containerName string, command []string, options remotecommand.StreamOptions, track func(io.Closer)) error {
 	//初始化pod所在的corev1资源组
 	//PodExecOptions struct包括Container stdout Command等结构
 	//scheme.ParameterCodec 应该是pod的GVK(GroupVersion &Kind)之类的
@@ -59,41 +259,208 @@ func (t *terminal) WsHandler(w http.ResponseWriter, r *http.Request) {
 	//https://192.168.1.11:6443/api/v1/namespaces/default/pods/nginx-wf2-778d88d7c-
 	//7rmsk/exec?command=%2Fbin%2Fbash&container=nginx-
 	//wf2&stderr=true&stdin=true&stdout=true&tty=true
-	req := K8s.ClientSet.CoreV1().RESTClient().Post().Resource("pods").
+	req := client.CoreV1().RESTClient().Post().Resource("pods").
 		Name(podName).Namespace(namespace).SubResource("exec").
 		VersionedParams(&corev1.PodExecOptions{
 			Container: containerName,
-			Command:   []string{"/bin/bash"},
-			Stdin:     true,
-			Stdout:    true,
-			Stderr:    true,
-			TTY:       true,
+			Command:   command,
+			Stdin:     options.Stdin != nil,
+			Stdout:    options.Stdout != nil,
+			Stderr:    options.Stderr != nil,
+			TTY:       options.Tty,
 		}, scheme.ParameterCodec)
-	fmt.Println("req.URL()", req.URL())
+	if command == nil {
+		req = client.CoreV1().RESTClient().Post().Resource("pods").
+			Name(podName).Namespace(namespace).SubResource("attach").
+			VersionedParams(&corev1.PodAttachOptions{
+				Container: containerName,
+				Stdin:     options.Stdin != nil,
+				Stdout:    options.Stdout != nil,
+				Stderr:    options.Stderr != nil,
+				TTY:       options.Tty,
+			}, scheme.ParameterCodec)
+	}
 	//remotecommand主要实现了http转SPDY添加X-Stream-Protocol-Version相关header并发送请求
-	executor, err := remotecommand.NewSPDYExecutor(conf, "POST", req.URL())
+	transport, upgrader, err := spdy.RoundTripperFor(conf)
+	if err != nil {
+		return err
+	}
+	if track != nil {
+		upgrader = trackingUpgrader{Upgrader: upgrader, track: track}
+	}
+	executor, err := remotecommand.NewSPDYExecutorForTransports(transport, upgrader, "POST", req.URL())
 	if err != nil {
+		return err
+	}
+	return executor.Stream(options)
+}
+
+//client-go的Stream不支持取消，记录建立的SPDY连接，需要结束命令时直接关闭连接
+type trackingUpgrader struct {
+	spdy.Upgrader
+	track func(io.Closer)
+}
+
+//记录命令当前使用的连接，Close之后建立的连接会被立即关闭
+type terminalConn struct {
+	lock   sync.Mutex
+	conn   io.Closer
+	closed bool
+}
+
+func (c *terminalConn) set(conn io.Closer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		conn.Close()
 		return
 	}
-	//建立链接之后从请求的stream中发送、读取数据
-	err = executor.Stream(remotecommand.StreamOptions{
-		Stdin:             pty,
-		Stdout:            pty,
-		Stderr:            pty,
-		TerminalSizeQueue: pty,
-		Tty:               pty.tty,
-	})
+	c.conn = conn
+}
+
+func (c *terminalConn) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+func (u trackingUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := u.Upgrader.NewConnection(resp)
+	if err == nil {
+		u.track(conn)
+	}
+	return conn, err
+}
+
+//一次性执行命令的参数
+type ExecCreate struct {
+	Cluster        string   `json:"cluster"`
+	Namespace      string   `json:"namespace"`
+	PodName        string   `json:"pod_name"`
+	ContainerName  string   `json:"container_name"`
+	Command        []string `json:"command"`
+	TimeoutSeconds int      `json:"timeout_seconds"`
+}
+
+//一次性执行命令的结果，输出超过execOutputLimit时截断
+type ExecResp struct {
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	ExitCode  int    `json:"exit_code"`
+	Truncated bool   `json:"truncated"`
+}
+
+const (
+	execDefaultTimeout = 30 * time.Second
+	execMaxTimeout     = 300 * time.Second
+	execOutputLimit    = 1 << 20
+)
+
+//在容器中执行一次命令，不分配tty也不发送输入，命令结束后返回输出和退出码
+//命令以非0退出码结束时不返回错误，由ExitCode体现
+func (t *terminal) Exec(exec *ExecCreate) (*ExecResp, error) {
+	if exec.Namespace == "" || exec.PodName == "" {
+		return nil, errors.New("namespace和pod_name不能为空")
+	}
+	if len(exec.Command) == 0 {
+		return nil, errors.New("command不能为空")
+	}
+	timeout := execDefaultTimeout
+	if exec.TimeoutSeconds > 0 {
+		timeout = time.Duration(exec.TimeoutSeconds) * time.Second
+	}
+	if timeout > execMaxTimeout {
+		return nil, fmt.Errorf("timeout_seconds不能超过%d", int(execMaxTimeout.Seconds()))
+	}
+	conf, err := K8s.GetConfig(exec.Cluster)
 	if err != nil {
-		msg := fmt.Sprintf("Exec to pod error! err: %v", err)
-		logger.Info(msg)
-		//将报错返回出去
-		pty.Write([]byte(msg))
-		//标记退出stream流
-		pty.Done()
+		logger.Error("获取k8s配置失败，" + err.Error())
+		return nil, err
+	}
+	client, err := K8s.GetClient(exec.Cluster)
+	if err != nil {
+		logger.Error("获取k8s clientSet失败，" + err.Error())
+		return nil, err
+	}
+	stdout := &limitedBuffer{limit: execOutputLimit}
+	stderr := &limitedBuffer{limit: execOutputLimit}
+	//超时后关闭连接结束命令
+	conn := &terminalConn{}
+	done := make(chan error, 1)
+	go func() {
+		done <- t.stream(conf, client, exec.Namespace, exec.PodName, exec.ContainerName, exec.Command, remotecommand.StreamOptions{
+			Stdout: stdout,
+			Stderr: stderr,
+		}, conn.set)
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		conn.Close()
+		return nil, fmt.Errorf("执行命令超时，超过%s未结束", timeout)
+	}
+	resp := &ExecResp{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.Truncated() || stderr.Truncated(),
+	}
+	if err != nil {
+		var exitErr utilexec.ExitError
+		if !errors.As(err, &exitErr) {
+			logger.Error("执行命令失败，" + err.Error())
+			return nil, errors.New("执行命令失败，" + err.Error())
+		}
+		resp.ExitCode = exitErr.ExitStatus()
+	}
+	return resp, nil
+}
+
+//限制大小的输出缓冲区，超过limit的内容丢弃并标记截断
+type limitedBuffer struct {
+	lock      sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if remain := b.limit - b.buf.Len(); len(p) > remain {
+		b.buf.Write(p[:remain])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
 	}
+	//返回完整长度，避免截断后remotecommand报错中断执行
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func (b *limitedBuffer) Truncated() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.truncated
 }
 
 const END_OF_TRANSMISSION = "\u0004" //终止符
+
+const (
+	//检查会话空闲和超时的间隔
+	terminalCheckInterval = 5 * time.Second
+	//向web端写入消息的超时时间
+	terminalWriteTimeout = 10 * time.Second
+)
+
 // TerminalMessage is the messaging protocol between ShellController and TerminalSession.
 //TerminalMessage定义了终端和容器shell交互内容的格式
 //Operation是操作类型
@@ -106,47 +473,97 @@ type TerminalMessage struct {
 	Cols      uint16 `json:"cols"`
 }
 
+//WebSocket子协议，浏览器无法为WebSocket设置header，token可以通过子协议"bearer.<token>"传递
+//通过子协议传递token时需要同时传WsSubprotocol，服务端只会选择WsSubprotocol作为响应的子协议
+const (
+	WsSubprotocol         = "k8s-platform"
+	WsTokenProtocolPrefix = "bearer."
+)
+
 //初始化一个websocket.Upgrader类型的对象，用于http协议升级为websocket协议
 var upgrader = func() websocket.Upgrader {
 	upgrader := websocket.Upgrader{}
 	upgrader.HandshakeTimeout = time.Second * 2
-	upgrader.CheckOrigin = func(r *http.Request) bool {
-		return true
-	}
+	upgrader.CheckOrigin = checkOrigin
+	upgrader.Subprotocols = []string{WsSubprotocol}
 	return upgrader
 }()
 
+//校验WebSocket请求的Origin，防止其他站点的页面借用户的浏览器建立连接
+//config.WsAllowedOrigins为空时只允许与平台同域的页面，*表示允许所有；非浏览器客户端不带Origin，直接放行
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if config.WsAllowedOrigins == "" {
+		u, err := url.Parse(origin)
+		if err == nil && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+	}
+	for _, allowed := range strings.Split(config.WsAllowedOrigins, ",") {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	logger.Warn("拒绝来自%s的WebSocket连接", origin)
+	return false
+}
+
 // TerminalSession implements PtyHandler
 //定义TerminalSession结构体，实现PtyHandler接口
 //wsConn是websocket连接
 //sizeChan用来定义终端输入和输出的宽和高
 //doneChan用于标记退出终端
+//stdinChan保存web端的输入，websocket只能有一个读取方，由readLoop统一读取后分发，
+//这样shell启动失败后可以在同一个连接上重新执行命令
+//recorder不为空时录制会话的输入、输出和终端大小变化
+//conn为当前命令使用的SPDY连接，lastActive为最后一次输入的时间，用于空闲超时
 type TerminalSession struct {
-	wsConn   *websocket.Conn
-	sizeChan chan remotecommand.TerminalSize
-	doneChan chan struct{}
-	tty      bool
+	wsConn    *websocket.Conn
+	sizeChan  chan remotecommand.TerminalSize
+	doneChan  chan struct{}
+	doneOnce  sync.Once
+	stdinChan chan []byte
+	pending   []byte
+	readLock  sync.Mutex
+	writeLock sync.Mutex
+	written   int64
+	tty       bool
+	recorder  *terminalRecorder
+	conn      terminalConn
+	//lastActive为unix纳秒时间戳，原子读写
+	lastActive    int64
+	terminateOnce sync.Once
+	terminated    atomic.Value
 }
 
 //该方法用于升级http协议至websocket，并new一个TerminalSession类型的对象返回
+//返回后不会读取web端的消息，设置好recorder后再调用Listen开始读取，避免readLoop与recorder的赋值并发
 func NewTerminalSession(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (*TerminalSession, error) {
 	conn, err := upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
 		return nil, err
 	}
 	session := &TerminalSession{
-		wsConn:   conn,
-		sizeChan: make(chan remotecommand.TerminalSize),
-		doneChan: make(chan struct{}),
-		tty:      true,
+		wsConn:    conn,
+		sizeChan:  make(chan remotecommand.TerminalSize),
+		doneChan:  make(chan struct{}),
+		stdinChan: make(chan []byte),
+		tty:       true,
 	}
+	session.touch()
 	return session, nil
 }
 
 // Done done, must call Done() before connection close, or Next() would not exits.
-//关闭doneChan，关闭后触发退出终端
+//关闭doneChan，关闭后触发退出终端，可以重复调用
 func (t *TerminalSession) Done() {
-	close(t.doneChan)
+	t.doneOnce.Do(func() {
+		close(t.doneChan)
+	})
 }
 
 // Next called in a loop from remotecommand as long as the process is running
@@ -160,53 +577,185 @@ func (t *TerminalSession) Next() *remotecommand.TerminalSize {
 	}
 }
 
+//开始读取web端的消息
+func (t *TerminalSession) Listen() {
+	go t.readLoop()
+}
+
+//读取web端的消息，输入放入stdinChan，resize放入sizeChan
+//连接断开或消息格式错误时发送终止符，使容器中的shell退出
+func (t *TerminalSession) readLoop() {
+	defer close(t.stdinChan)
+	for {
+		_, message, err := t.wsConn.ReadMessage()
+		if err != nil {
+			log.Printf("read message err: %v", err)
+			t.sendStdin([]byte(END_OF_TRANSMISSION))
+			return
+		}
+		var msg TerminalMessage
+		if err := json.Unmarshal([]byte(message), &msg); err != nil {
+			log.Printf("read parse message err: %v", err)
+			t.sendStdin([]byte(END_OF_TRANSMISSION))
+			return
+		}
+		switch msg.Operation {
+		case "stdin":
+			t.touch()
+			if !t.sendStdin([]byte(msg.Data)) {
+				return
+			}
+		case "resize":
+			t.touch()
+			t.recorder.Resize(msg.Cols, msg.Rows)
+			select {
+			case t.sizeChan <- remotecommand.TerminalSize{Width: msg.Cols, Height: msg.Rows}:
+			case <-t.doneChan:
+				return
+			}
+		//心跳只用于保持连接，不算作输入，不影响空闲超时
+		case "ping":
+			if err := t.writeMessage(TerminalMessage{Operation: "pong"}); err != nil {
+				log.Printf("write pong err: %v", err)
+			}
+		default:
+			log.Printf("unknown message type '%s'", msg.Operation)
+			t.sendStdin([]byte(END_OF_TRANSMISSION))
+			return
+		}
+	}
+}
+
+func (t *TerminalSession) sendStdin(data []byte) bool {
+	select {
+	case t.stdinChan <- data:
+		return true
+	case <-t.doneChan:
+		return false
+	}
+}
+
 //用于读取web端的输入，接收web端输入的指令内容
 func (t *TerminalSession) Read(p []byte) (int, error) {
-	_, message, err := t.wsConn.ReadMessage()
-	if err != nil {
-		log.Printf("read message err: %v", err)
-		return copy(p, END_OF_TRANSMISSION), err
-	}
-	var msg TerminalMessage
-	if err := json.Unmarshal([]byte(message), &msg); err != nil {
-		log.Printf("read parse message err: %v", err)
-		//return 0,nil
-		return copy(p, END_OF_TRANSMISSION), err
-	}
-	switch msg.Operation {
-	case "stdin":
-		return copy(p, msg.Data), nil
-	case "resize":
-		t.sizeChan <- remotecommand.TerminalSize{Width: msg.Cols, Height: msg.Rows}
-		return 0, nil
-	case "ping":
-		return 0, nil
-	default:
-		log.Printf("unknown message type '%s'", msg.Operation)
-		//return 0,nil
-		return copy(p, END_OF_TRANSMISSION), fmt.Errorf("unknown message type '%s'", msg.Operation)
+	return t.read(p, nil)
+}
+
+//stop关闭后不再读取输入，已经取出的输入放回pending，留给下一次执行的命令
+func (t *TerminalSession) read(p []byte, stop <-chan struct{}) (int, error) {
+	t.readLock.Lock()
+	if len(t.pending) > 0 {
+		n := copy(p, t.pending)
+		t.pending = t.pending[n:]
+		t.readLock.Unlock()
+		t.recorder.Input(p[:n])
+		return n, nil
 	}
+	t.readLock.Unlock()
+	select {
+	case data, ok := <-t.stdinChan:
+		if !ok {
+			return 0, io.EOF
+		}
+		t.readLock.Lock()
+		defer t.readLock.Unlock()
+		select {
+		case <-stop:
+			t.pending = append(data, t.pending...)
+			return 0, io.EOF
+		default:
+		}
+		n := copy(p, data)
+		t.pending = append(data[n:], t.pending...)
+		t.recorder.Input(p[:n])
+		return n, nil
+	case <-stop:
+		return 0, io.EOF
+	case <-t.doneChan:
+		return 0, io.EOF
+	}
+}
+
+//每次执行命令使用单独的输入流，命令退出后调用stop，
+//避免remotecommand遗留的读取协程取走下一个命令的输入
+func (t *TerminalSession) stdin() (io.Reader, func()) {
+	stop := make(chan struct{})
+	var once sync.Once
+	return stdinReader{session: t, stop: stop}, func() {
+		once.Do(func() {
+			close(stop)
+		})
+	}
+}
+
+type stdinReader struct {
+	session *TerminalSession
+	stop    <-chan struct{}
+}
+
+func (r stdinReader) Read(p []byte) (int, error) {
+	return r.session.read(p, r.stop)
 }
 
 //用于向web端输出，接收web端的指令后，将结果返回出去
 func (t *TerminalSession) Write(p []byte) (int, error) {
-	msg, err := json.Marshal(TerminalMessage{
+	if err := t.writeMessage(TerminalMessage{
 		Operation: "stdout",
 		Data:      string(p),
-	})
-	if err != nil {
-		log.Printf("write parse message err: %v", err)
-		return 0, err
-	}
-	if err := t.wsConn.WriteMessage(websocket.TextMessage, msg); err != nil {
+	}); err != nil {
 		log.Printf("write message err: %v", err)
 		return 0, err
 	}
+	atomic.AddInt64(&t.written, int64(len(p)))
+	t.recorder.Output(p)
 	return len(p), nil
 }
 
+//向web端发送消息，web端长时间不读取时写入超时，避免阻塞会话
+func (t *TerminalSession) writeMessage(message TerminalMessage) error {
+	msg, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	t.wsConn.SetWriteDeadline(time.Now().Add(terminalWriteTimeout))
+	return t.wsConn.WriteMessage(websocket.TextMessage, msg)
+}
+
+//记录最后一次输入的时间
+func (t *TerminalSession) touch() {
+	atomic.StoreInt64(&t.lastActive, time.Now().UnixNano())
+}
+
+//最后一次输入的时间
+func (t *TerminalSession) LastActive() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&t.lastActive))
+}
+
+//终止会话，向web端输出原因后关闭到容器的连接，正在执行的命令随之结束
+func (t *TerminalSession) Terminate(reason string) {
+	t.terminateOnce.Do(func() {
+		t.terminated.Store(reason)
+		t.Write([]byte("\r\n" + reason + "\r\n"))
+		t.conn.Close()
+		t.Done()
+	})
+}
+
+//会话被终止的原因，未被终止时为空
+func (t *TerminalSession) Terminated() string {
+	reason, _ := t.terminated.Load().(string)
+	return reason
+}
+
+//已经输出到web端的字节数
+func (t *TerminalSession) Written() int64 {
+	return atomic.LoadInt64(&t.written)
+}
+
 //用于关闭websocket连接
 func (t *TerminalSession) Close() error {
+	t.Done()
 	return t.wsConn.Close()
 }
 
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"k8s-platform/config"
+	"k8s-platform/dao"
+	"k8s-platform/model"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/wonderivan/logger"
+)
+
+var TerminalRecord terminalRecord
+
+type terminalRecord struct{}
+
+//asciicast v2录像的文件头，见https://docs.asciinema.org/manual/asciicast/v2/
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     uint16            `json:"width"`
+	Height    uint16            `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title"`
+	Env       map[string]string `json:"env"`
+}
+
+//asciicast的事件类型，i为输入，o为输出，r为终端大小变化
+const (
+	asciicastInput  = "i"
+	asciicastOutput = "o"
+	asciicastResize = "r"
+)
+
+//录像开始时的默认终端大小，web端resize后以r事件记录
+const (
+	terminalRecordWidth  = 80
+	terminalRecordHeight = 24
+)
+
+//终端录像，记录会话的输入输出，写入失败后停止录像，不影响终端本身
+type terminalRecorder struct {
+	lock   sync.Mutex
+	file   *os.File
+	record *model.TerminalRecord
+	start  time.Time
+	size   int64
+	err    error
+	//websocket消息可能在多字节字符中间截断，未写完的字节留到下一次写入
+	inputRest  []byte
+	outputRest []byte
+}
+
+//开始录像，创建录像文件并写入索引，config.TerminalRecordDir为空时不录像，返回nil
+func (t *terminalRecord) Start(record *model.TerminalRecord) (recorder *terminalRecorder, err error) {
+	if config.TerminalRecordDir == "" {
+		return nil, nil
+	}
+	//文件名只使用时间和随机数，pod名来自请求参数，拼到路径中可能包含../
+	id, err := randomString()
+	if err != nil {
+		logger.Error("创建终端录像文件失败，" + err.Error())
+		return nil, errors.New("创建终端录像文件失败，" + err.Error())
+	}
+	start := time.Now()
+	record.File = filepath.Join(start.Format("20060102"), fmt.Sprintf("%d-%s.cast", start.UnixNano(), id))
+	path := filepath.Join(config.TerminalRecordDir, record.File)
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		logger.Error("创建终端录像目录失败，" + err.Error())
+		return nil, errors.New("创建终端录像目录失败，" + err.Error())
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		logger.Error("创建终端录像文件失败，" + err.Error())
+		return nil, errors.New("创建终端录像文件失败，" + err.Error())
+	}
+	recorder = &terminalRecorder{file: file, record: record, start: start}
+	header, _ := json.Marshal(&asciicastHeader{
+		Version:   2,
+		Width:     terminalRecordWidth,
+		Height:    terminalRecordHeight,
+		Timestamp: start.Unix(),
+		Title:     fmt.Sprintf("%s@%s/%s/%s/%s", record.Username, record.Cluster, record.Namespace, record.Pod, record.Container),
+		Env:       map[string]string{"TERM": "xterm", "SHELL": record.Command},
+	})
+	if err = recorder.writeLine(header); err != nil {
+		file.Close()
+		os.Remove(path)
+		logger.Error("写入终端录像失败，" + err.Error())
+		return nil, errors.New("写入终端录像失败，" + err.Error())
+	}
+	if err = dao.TerminalRecord.Add(record); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return recorder, nil
+}
+
+//获取终端录像列表，支持过滤、分页
+func (t *terminalRecord) GetRecords(filter *dao.TerminalRecordFilter, page, limit int) (data *dao.TerminalRecordResp, err error) {
+	return dao.TerminalRecord.GetList(filter, page, limit)
+}
+
+//打开录像文件用于下载，调用方负责关闭文件
+func (t *terminalRecord) Open(id int) (record *model.TerminalRecord, file *os.File, err error) {
+	record, err = dao.TerminalRecord.GetById(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if record == nil {
+		return nil, nil, errors.New("终端录像不存在")
+	}
+	file, err = os.Open(filepath.Join(config.TerminalRecordDir, record.File))
+	if err != nil {
+		logger.Error("打开终端录像文件失败，" + err.Error())
+		return nil, nil, errors.New("打开终端录像文件失败，" + err.Error())
+	}
+	return record, file, nil
+}
+
+//记录web端的输入
+func (r *terminalRecorder) Input(p []byte) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.inputRest = r.event(asciicastInput, append(r.inputRest, p...))
+}
+
+//记录输出到web端的内容
+func (r *terminalRecorder) Output(p []byte) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.outputRest = r.event(asciicastOutput, append(r.outputRest, p...))
+}
+
+//记录终端大小变化
+func (r *terminalRecorder) Resize(width, height uint16) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.event(asciicastResize, []byte(fmt.Sprintf("%dx%d", width, height)))
+}
+
+//结束录像，关闭文件并更新索引中的时长和文件大小
+func (r *terminalRecorder) Close() {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err := r.file.Close(); err != nil && r.err == nil {
+		logger.Error("关闭终端录像文件失败，" + err.Error())
+	}
+	//关闭后的输入输出不再记录
+	r.err = os.ErrClosed
+	dao.TerminalRecord.Finish(r.record.ID, time.Since(r.start).Milliseconds(), r.size)
+}
+
+//写入一个事件，返回末尾不完整的utf8字节
+func (r *terminalRecorder) event(code string, data []byte) (rest []byte) {
+	if r.err != nil {
+		return nil
+	}
+	//判断末尾是否是被截断的多字节字符
+	end := utf8Boundary(data)
+	if end == 0 {
+		return data
+	}
+	line, _ := json.Marshal([]interface{}{time.Since(r.start).Seconds(), code, string(data[:end])})
+	if r.err = r.writeLine(line); r.err != nil {
+		logger.Error("写入终端录像失败，停止录像，" + r.err.Error())
+		return nil
+	}
+	return append([]byte(nil), data[end:]...)
+}
+
+func (r *terminalRecorder) writeLine(line []byte) error {
+	n, err := r.file.Write(append(line, '\n'))
+	r.size += int64(n)
+	return err
+}
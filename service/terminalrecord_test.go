@@ -0,0 +1,39 @@
+package service
+
+import (
+	"k8s-platform/config"
+	"k8s-platform/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//pod名来自请求参数，不能影响录像文件的路径
+func TestTerminalRecordFileName(t *testing.T) {
+	setupTestDB(t)
+	dir := t.TempDir()
+	old := config.TerminalRecordDir
+	config.TerminalRecordDir = filepath.Join(dir, "recordings")
+	t.Cleanup(func() { config.TerminalRecordDir = old })
+
+	record := &model.TerminalRecord{Username: "alice", Namespace: "default", Pod: "../../../escape", Container: "app"}
+	recorder, err := TerminalRecord.Start(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.Close()
+	if strings.Contains(record.File, "..") || strings.Contains(record.File, "escape") {
+		t.Fatalf("录像文件名包含pod名：%s", record.File)
+	}
+	path := filepath.Join(config.TerminalRecordDir, record.File)
+	if !strings.HasPrefix(path, config.TerminalRecordDir+string(filepath.Separator)) {
+		t.Fatalf("录像文件不在录像目录中：%s", path)
+	}
+	if _, err = os.Stat(path); err != nil {
+		t.Fatalf("录像文件不存在：%v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "escape")); !os.IsNotExist(err) {
+		t.Fatalf("在录像目录之外创建了文件")
+	}
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"k8s-platform/config"
+	"sort"
+	"sync"
+	"time"
+)
+
+var TerminalSessions terminalSessions
+
+//terminalSessions登记所有打开中的终端会话，用于并发数量限制和管理员查看、终止会话
+type terminalSessions struct {
+	lock     sync.Mutex
+	sessions map[string]*terminalSessionEntry
+}
+
+//终端会话的信息，LastActive为最后一次输入的时间
+type TerminalSessionInfo struct {
+	ID         string    `json:"id"`
+	Username   string    `json:"username"`
+	IP         string    `json:"ip"`
+	Cluster    string    `json:"cluster"`
+	Namespace  string    `json:"namespace"`
+	Pod        string    `json:"pod"`
+	Container  string    `json:"container"`
+	Command    string    `json:"command"`
+	StartTime  time.Time `json:"start_time"`
+	LastActive time.Time `json:"last_active"`
+}
+
+//pty在websocket连接建立后才登记，killedBy不为空表示连接建立前已经被管理员终止
+type terminalSessionEntry struct {
+	info     TerminalSessionInfo
+	pty      *TerminalSession
+	killedBy string
+}
+
+//超过终端并发数量上限，controller据此返回429
+var ErrTerminalSessionLimit = errors.New("终端数量超过上限")
+
+//登记会话，超过全局或单个用户的并发数量上限时返回ErrTerminalSessionLimit
+func (t *terminalSessions) Acquire(info *TerminalSessionInfo) (id string, err error) {
+	id, err = randomString()
+	if err != nil {
+		return "", err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if config.TerminalMaxSessions > 0 && len(t.sessions) >= config.TerminalMaxSessions {
+		return "", fmt.Errorf("%w，平台最多同时打开%d个终端", ErrTerminalSessionLimit, config.TerminalMaxSessions)
+	}
+	if config.TerminalMaxUserSessions > 0 {
+		count := 0
+		for _, entry := range t.sessions {
+			if entry.info.Username == info.Username {
+				count++
+			}
+		}
+		if count >= config.TerminalMaxUserSessions {
+			return "", fmt.Errorf("%w，每个用户最多同时打开%d个终端", ErrTerminalSessionLimit, config.TerminalMaxUserSessions)
+		}
+	}
+	if t.sessions == nil {
+		t.sessions = map[string]*terminalSessionEntry{}
+	}
+	info.ID = id
+	t.sessions[id] = &terminalSessionEntry{info: *info}
+	return id, nil
+}
+
+//websocket连接建立后关联pty，会话已经被终止时终止pty并返回false
+func (t *terminalSessions) Attach(id string, pty *TerminalSession) bool {
+	t.lock.Lock()
+	reason := "会话已被终止"
+	entry, ok := t.sessions[id]
+	if ok {
+		entry.pty = pty
+		if entry.killedBy != "" {
+			reason = killedMessage(entry.killedBy)
+			ok = false
+		}
+	}
+	t.lock.Unlock()
+	if !ok {
+		pty.Terminate(reason)
+	}
+	return ok
+}
+
+//会话结束时注销
+func (t *terminalSessions) Release(id string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.sessions, id)
+}
+
+//获取打开中的终端会话列表，按开始时间排序
+func (t *terminalSessions) List() []*TerminalSessionInfo {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	infos := make([]*TerminalSessionInfo, 0, len(t.sessions))
+	for _, entry := range t.sessions {
+		info := entry.info
+		info.LastActive = info.StartTime
+		if entry.pty != nil {
+			info.LastActive = entry.pty.LastActive()
+		}
+		infos = append(infos, &info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].StartTime.Before(infos[j].StartTime)
+	})
+	return infos
+}
+
+//管理员强制终止会话，operator为执行操作的管理员
+func (t *terminalSessions) Kill(id, operator string) error {
+	var pty *TerminalSession
+	t.lock.Lock()
+	entry, ok := t.sessions[id]
+	if ok {
+		entry.killedBy = operator
+		pty = entry.pty
+	}
+	t.lock.Unlock()
+	if !ok {
+		return errors.New("终端会话不存在或已经结束")
+	}
+	//连接建立前被终止时，由Attach终止pty
+	if pty != nil {
+		pty.Terminate(killedMessage(operator))
+	}
+	return nil
+}
+
+func killedMessage(operator string) string {
+	return fmt.Sprintf("会话已被管理员%s终止", operator)
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"errors"
+	"k8s-platform/dao"
+	"k8s-platform/model"
+	"k8s-platform/utils"
+	"time"
+)
+
+var Token token
+
+type token struct{}
+
+//定义TokenResp结构体，登录和刷新token时返回
+type TokenResp struct {
+	Username     string `json:"username"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+//签发access token和refresh token，token中写入用户当前的token版本
+func (t *token) Issue(username string) (resp *TokenResp, err error) {
+	user, err := dao.User.GetByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("用户" + username + "不存在")
+	}
+	accessToken, claims, err := utils.JWTToken.GenerateToken(username, utils.AccessToken, user.TokenVersion)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, _, err := utils.JWTToken.GenerateToken(username, utils.RefreshToken, user.TokenVersion)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResp{
+		Username:     username,
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    claims.ExpiresAt,
+	}, nil
+}
+
+//使用refresh token换取新的token，旧的refresh token会被注销，只能使用一次
+//直接写入黑名单，jti唯一索引冲突说明已经被使用过，并发刷新时只有一个请求能成功
+func (t *token) Refresh(refreshToken string) (resp *TokenResp, err error) {
+	claims, err := utils.JWTToken.ParseToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != utils.RefreshToken {
+		return nil, errors.New("token类型错误，请使用refresh token")
+	}
+	//用户被禁用或密码变更后不能再刷新token
+	if err = t.CheckUser(claims); err != nil {
+		return nil, err
+	}
+	err = t.Revoke(claims)
+	if errors.Is(err, dao.ErrDuplicate) {
+		return nil, errors.New("TokenRevoked")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.Issue(claims.Username)
+}
+
+//注销token，将token的jti加入黑名单，已经注销过时返回dao.ErrDuplicate
+func (t *token) Revoke(claims *utils.CustomClaims) (err error) {
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	return dao.TokenBlacklist.Add(&model.TokenBlacklist{
+		Jti:       claims.Id,
+		Username:  claims.Username,
+		ExpiresAt: &expiresAt,
+	})
+}
+
+//退出登录，注销当前的access token，传入refresh token时一并注销
+func (t *token) Logout(claims *utils.CustomClaims, refreshToken string) (err error) {
+	if err = t.Revoke(claims); err != nil {
+		return err
+	}
+	if refreshToken == "" {
+		return nil
+	}
+	refreshClaims, err := utils.JWTToken.ParseToken(refreshToken)
+	if err != nil {
+		//refresh token已过期或不合法时无需注销
+		return nil
+	}
+	if refreshClaims.Username != claims.Username || refreshClaims.TokenType != utils.RefreshToken {
+		return errors.New("refresh token与当前用户不匹配")
+	}
+	//refresh token已经使用或注销过时无需再注销
+	if err = t.Revoke(refreshClaims); err != nil && !errors.Is(err, dao.ErrDuplicate) {
+		return err
+	}
+	return nil
+}
+
+//校验token对应的用户是否仍然有效，每次请求和刷新token时调用
+func (t *token) CheckUser(claims *utils.CustomClaims) (err error) {
+	user, err := dao.User.GetByUsername(claims.Username)
+	if err != nil {
+		return err
+	}
+	return checkTokenUser(user, claims)
+}
+
+//用户不存在、已被禁用，或者禁用、密码变更后签发的token版本已过时，token均失效
+func checkTokenUser(user *model.User, claims *utils.CustomClaims) error {
+	if user == nil || user.Disabled {
+		return errors.New("用户不存在或已被禁用")
+	}
+	if user.TokenVersion != claims.Version {
+		return errors.New("token已失效，请重新登录")
+	}
+	return nil
+}
+
+//判断token是否已注销
+func (t *token) IsRevoked(jti string) (revoked bool, err error) {
+	return dao.TokenBlacklist.Exists(jti)
+}
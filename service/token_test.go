@@ -0,0 +1,175 @@
+package service
+
+import (
+	"errors"
+	"k8s-platform/config"
+	"k8s-platform/dao"
+	"k8s-platform/model"
+	"k8s-platform/utils"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCheckTokenUser(t *testing.T) {
+	claims := &utils.CustomClaims{Username: "dev", Version: 1}
+	cases := []struct {
+		name  string
+		user  *model.User
+		valid bool
+	}{
+		{"有效", &model.User{Username: "dev", TokenVersion: 1}, true},
+		{"用户不存在", nil, false},
+		{"已禁用", &model.User{Username: "dev", TokenVersion: 1, Disabled: true}, false},
+		{"禁用或密码变更后版本已过时", &model.User{Username: "dev", TokenVersion: 2}, false},
+	}
+	for _, c := range cases {
+		err := checkTokenUser(c.user, claims)
+		if (err == nil) != c.valid {
+			t.Errorf("%s：期望有效为%v，实际返回%v", c.name, c.valid, err)
+		}
+	}
+}
+
+//初始化HS256签名密钥
+func setupTestJWT(t *testing.T) {
+	config.JWTKeys = `[{"kid":"test","alg":"HS256","secret":"test-secret"}]`
+	config.JWTActiveKid = "test"
+	if err := utils.JWTToken.Init(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//refresh token只能使用一次，注销后的token不能再使用
+func TestRefreshRevokesOldToken(t *testing.T) {
+	setupTestDB(t)
+	setupTestJWT(t)
+	if err := User.CreateUser("dev", "dev-password"); err != nil {
+		t.Fatal(err)
+	}
+	first, err := Token.Issue("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//access token不能用于刷新
+	if _, err = Token.Refresh(first.Token); err == nil {
+		t.Fatal("access token不能用于刷新")
+	}
+	second, err := Token.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("刷新token失败，%v", err)
+	}
+	if _, err = Token.Refresh(first.RefreshToken); err == nil || err.Error() != "TokenRevoked" {
+		t.Fatalf("已使用的refresh token应该被拒绝，%v", err)
+	}
+
+	//退出登录后access token和refresh token都失效
+	claims, err := utils.JWTToken.ParseToken(second.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Token.Logout(claims, second.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := Token.IsRevoked(claims.Id); err != nil || !revoked {
+		t.Fatalf("退出登录后access token应该被注销，%v", err)
+	}
+	if _, err = Token.Refresh(second.RefreshToken); err == nil {
+		t.Fatal("退出登录后refresh token应该被拒绝")
+	}
+}
+
+//同一个refresh token并发刷新时只有一个请求能换到新的token
+func TestRefreshConcurrentReuse(t *testing.T) {
+	setupTestFileDB(t)
+	setupTestJWT(t)
+	if err := User.CreateUser("dev", "dev-password"); err != nil {
+		t.Fatal(err)
+	}
+	first, err := Token.Issue("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		wg        sync.WaitGroup
+		succeeded int32
+	)
+	start := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if _, err := Token.Refresh(first.RefreshToken); err == nil {
+				atomic.AddInt32(&succeeded, 1)
+			} else if err.Error() != "TokenRevoked" {
+				t.Errorf("重复使用的refresh token应该返回TokenRevoked，%v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	if succeeded != 1 {
+		t.Fatalf("并发刷新成功%d次，期望1次", succeeded)
+	}
+	//不依赖调度顺序：同一个jti只能写入一次黑名单
+	claims, err := utils.JWTToken.ParseToken(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Token.Revoke(claims); !errors.Is(err, dao.ErrDuplicate) {
+		t.Fatalf("重复注销同一个jti应该返回dao.ErrDuplicate，%v", err)
+	}
+}
+
+//禁用用户、重置密码后已签发的token立即失效，重新启用后需要重新登录
+func TestTokenInvalidatedByUserChange(t *testing.T) {
+	setupTestDB(t)
+	setupTestJWT(t)
+	if err := User.CreateUser("dev", "dev-password"); err != nil {
+		t.Fatal(err)
+	}
+	check := func(resp *TokenResp) error {
+		claims, err := utils.JWTToken.ParseToken(resp.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Token.CheckUser(claims)
+	}
+	resp, err := Token.Issue("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = check(resp); err != nil {
+		t.Fatalf("新签发的token应该有效，%v", err)
+	}
+	if err = User.SetDisabled("dev", true); err != nil {
+		t.Fatal(err)
+	}
+	if err = check(resp); err == nil {
+		t.Fatal("禁用用户后token应该失效")
+	}
+	if _, err = Token.Refresh(resp.RefreshToken); err == nil {
+		t.Fatal("禁用用户后refresh token应该失效")
+	}
+	if err = User.SetDisabled("dev", false); err != nil {
+		t.Fatal(err)
+	}
+	if err = check(resp); err == nil {
+		t.Fatal("重新启用后禁用前签发的token仍然无效")
+	}
+
+	resp, err = Token.Issue("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = User.ResetPassword("dev", "new-password"); err != nil {
+		t.Fatal(err)
+	}
+	if err = check(resp); err == nil {
+		t.Fatal("重置密码后token应该失效")
+	}
+	if _, err = Token.Refresh(resp.RefreshToken); err == nil {
+		t.Fatal("重置密码后refresh token应该失效")
+	}
+}
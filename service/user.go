@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"k8s-platform/config"
+	"k8s-platform/dao"
+	"k8s-platform/model"
+
+	"github.com/wonderivan/logger"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var User user
+
+type user struct{}
+
+//密码最小长度
+const minPasswordLen = 8
+
+//用户来源
+const (
+	SourceLocal = "local"
+	SourceOIDC  = "oidc"
+	SourceLDAP  = "ldap"
+)
+
+//GroupRole定义外部身份源的用户组与平台角色的对应关系
+//Cluster为空表示所有集群，Namespace为空表示集群内所有namespace
+type GroupRole struct {
+	Group     string `json:"group"`
+	Role      string `json:"role"`
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+}
+
+//用户表为空时，根据config.AdminUser和config.AdminPwd创建初始管理员
+func (u *user) InitAdmin() {
+	count, err := dao.User.Count()
+	if err != nil {
+		panic(err.Error())
+	}
+	if count > 0 {
+		return
+	}
+	if config.AdminPwd == "" {
+		panic("用户表为空，请配置admin_pwd以创建初始管理员")
+	}
+	if err = u.CreateUser(config.AdminUser, config.AdminPwd); err != nil {
+		panic(err.Error())
+	}
+	//初始管理员绑定所有集群的admin角色
+	err = dao.RoleBinding.Add(&model.RoleBinding{
+		Username: config.AdminUser,
+		Role:     RoleAdmin,
+	})
+	if err != nil {
+		panic(err.Error())
+	}
+	logger.Info("创建初始管理员成功，用户名：%s", config.AdminUser)
+}
+
+//获取用户列表，支持过滤、分页
+func (u *user) GetUsers(filterName string, page, limit int) (data *dao.UserResp, err error) {
+	return dao.User.GetList(filterName, page, limit)
+}
+
+//创建用户，密码使用bcrypt哈希后入库
+func (u *user) CreateUser(username, password string) (err error) {
+	if username == "" {
+		return errors.New("用户名不能为空")
+	}
+	exist, err := dao.User.GetByUsername(username)
+	if err != nil {
+		return err
+	}
+	if exist != nil {
+		return errors.New("用户" + username + "已存在")
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	err = dao.User.Add(&model.User{
+		Username: username,
+		Password: hash,
+		Source:   SourceLocal,
+	})
+	//并发创建同名用户时，上面的查询都查不到，由唯一索引保证只有一个能创建成功
+	if errors.Is(err, dao.ErrDuplicate) {
+		return errors.New("用户" + username + "已存在")
+	}
+	return err
+}
+
+//外部身份源登录成功后同步用户，用户不存在时自动创建，并根据用户组重新生成角色绑定
+func (u *user) SyncExternal(username, source string, groups []string, groupRoles []*GroupRole) (err error) {
+	if username == "" {
+		return errors.New("用户名不能为空")
+	}
+	user, err := dao.User.GetByUsername(username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		//外部用户没有本地密码，无法通过用户名密码登录
+		err = dao.User.Add(&model.User{Username: username, Source: source})
+		//并发首次登录时用户已经被其他请求创建，重新读取后按已存在的用户校验
+		if errors.Is(err, dao.ErrDuplicate) {
+			user, err = dao.User.GetByUsername(username)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if user != nil && user.Source != source {
+		return errors.New("用户" + username + "已存在，来源为" + user.Source)
+	}
+	if user != nil && user.Disabled {
+		return errUserDisabled
+	}
+	var bindings []*model.RoleBinding
+	for _, gr := range groupRoles {
+		if _, ok := roleRules[gr.Role]; !ok || !contains(groups, gr.Group) {
+			continue
+		}
+		bindings = append(bindings, &model.RoleBinding{
+			Username:  username,
+			Role:      gr.Role,
+			Cluster:   gr.Cluster,
+			Namespace: gr.Namespace,
+			Source:    source,
+		})
+	}
+	return dao.RoleBinding.ReplaceBySource(username, source, bindings)
+}
+
+//启用或禁用用户，禁用后无法登录，已签发的token立即失效
+func (u *user) SetDisabled(username string, disabled bool) (err error) {
+	if _, err = u.getUser(username); err != nil {
+		return err
+	}
+	return dao.User.UpdateDisabled(username, disabled)
+}
+
+//管理员重置用户密码，已签发的token立即失效
+func (u *user) ResetPassword(username, password string) (err error) {
+	user, err := u.getUser(username)
+	if err != nil {
+		return err
+	}
+	if !isLocalUser(user) {
+		return errors.New("外部身份源用户不支持重置密码")
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return dao.User.UpdatePassword(username, hash)
+}
+
+//用户修改自己的密码，需要校验旧密码，修改后需要重新登录
+func (u *user) ChangePassword(username, oldPassword, newPassword string) (err error) {
+	user, err := u.getUser(username)
+	if err != nil {
+		return err
+	}
+	if !isLocalUser(user) {
+		return errors.New("外部身份源用户不支持修改密码")
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword)) != nil {
+		return errors.New("旧密码错误")
+	}
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	return dao.User.UpdatePassword(username, hash)
+}
+
+//Source为空的用户是新增来源字段之前创建的本地用户
+func isLocalUser(user *model.User) bool {
+	return user.Source == "" || user.Source == SourceLocal
+}
+
+//获取用户，不存在时返回错误
+func (u *user) getUser(username string) (user *model.User, err error) {
+	user, err = dao.User.GetByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("用户" + username + "不存在")
+	}
+	return user, nil
+}
+
+//校验密码长度并生成bcrypt哈希
+func hashPassword(password string) (hash string, err error) {
+	if len(password) < minPasswordLen {
+		return "", errors.New("密码长度不能小于8位")
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Error(errors.New("密码加密失败，" + err.Error()))
+		return "", errors.New("密码加密失败，" + err.Error())
+	}
+	return string(b), nil
+}
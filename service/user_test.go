@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+	"k8s-platform/dao"
+	"k8s-platform/model"
+	"sync"
+	"testing"
+)
+
+//用户名有唯一索引，重复写入返回dao.ErrDuplicate
+func TestUserUniqueUsername(t *testing.T) {
+	setupTestDB(t)
+	if err := User.CreateUser("dev", "dev-password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.User.Add(&model.User{Username: "dev", Source: SourceLocal}); !errors.Is(err, dao.ErrDuplicate) {
+		t.Fatalf("重复的用户名应该返回dao.ErrDuplicate，%v", err)
+	}
+	if err := User.CreateUser("dev", "dev-password"); err == nil || err.Error() != "用户dev已存在" {
+		t.Fatalf("重复创建用户应该返回已存在，%v", err)
+	}
+}
+
+//外部用户并发首次登录时都能成功，只创建一个用户
+func TestSyncExternalConcurrentFirstLogin(t *testing.T) {
+	setupTestFileDB(t)
+	groupRoles := []*GroupRole{{Group: "dev", Role: RoleAdmin}}
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if err := User.SyncExternal("alice", SourceOIDC, []string{"dev"}, groupRoles); err != nil {
+				t.Errorf("并发首次登录失败，%v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	users, err := dao.User.GetList("alice", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users.Total != 1 {
+		t.Fatalf("创建了%d个用户，期望1个", users.Total)
+	}
+}
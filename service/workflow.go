@@ -1,8 +1,15 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"k8s-platform/config"
 	"k8s-platform/dao"
 	"k8s-platform/model"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
 )
 
 /**
@@ -13,9 +20,12 @@ type workflow struct{}
 
 var Workflow workflow
 
-//获取列表分页查询
-func (w *workflow) GetList(namespace string, page, limit int) (data *dao.WorkflowResp, err error) {
-	data, err = dao.Workflow.GetList(namespace, page, limit)
+//获取列表分页查询，namespace为空时查询所有namespace，namespaces不为nil时只返回其中namespace的workflow
+func (w *workflow) GetList(cluster, namespace string, namespaces []string, page, limit int) (data *dao.WorkflowResp, err error) {
+	if cluster == "" {
+		cluster = config.DefaultCluster
+	}
+	data, err = dao.Workflow.GetList(cluster, namespace, namespaces, page, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -34,6 +44,7 @@ func (w *workflow) GetById(id int) (data *model.Workflow, err error) {
 //定义WorkflowCreate结构体，用于创建workflow需要的参数属性的定义
 type WorkflowCreate struct {
 	Name          string                 `json:"name"`
+	Cluster       string                 `json:"cluster"`
 	Namespace     string                 `json:"namespace"`
 	Replicas      int32                  `json:"replicas"`
 	Image         string                 `json:"image"`
@@ -59,67 +70,167 @@ func getServiceName(workflowName string) (ingressName string) {
 	return workflowName + "-svc"
 }
 
-//封装创建workflow对应的k8s资源
-//小写开头的函数，作用域只在当前包中，不支持跨包调用
-func createWorkflowRes(data *WorkflowCreate) (err error) {
-	//声明service类型
-	var serviceType string
-	//组装DeployCreate类型的数据
-	dc := &DeployCreate{
-		Name:          data.Name,
-		Namespace:     data.Namespace,
-		Replicas:      data.Replicas,
-		Image:         data.Image,
-		Label:         data.Label,
-		Cpu:           data.Cpu,
-		Memory:        data.Memory,
-		ContainerPort: data.ContainerPort,
-		HealthCheck:   data.HealthCheck,
-		HealthPath:    data.HealthPath,
-	}
-	//创建deployemnt
-	err = Deployment.CreateDeployment(dc)
-	if err != nil {
-		return err
+//workflow的状态
+const (
+	WorkflowStatusSucceeded    = "succeeded"
+	WorkflowStatusFailed       = "failed"
+	WorkflowStatusDeleteFailed = "delete_failed"
+)
+
+//workflow每一步的操作和结果
+const (
+	WorkflowActionCreate   = "create"
+	WorkflowActionRollback = "rollback"
+	WorkflowActionDelete   = "delete"
+	WorkflowStepSuccess    = "success"
+	WorkflowStepFailed     = "failed"
+)
+
+//workflowRes定义workflow对应的一个k8s资源
+type workflowRes struct {
+	kind string
+	name string
+}
+
+//workflow对应的k8s资源，按创建顺序排列，只有ingress类型的workflow才有ingress资源
+func workflowResources(workflow *model.Workflow) []*workflowRes {
+	resources := []*workflowRes{
+		{kind: "Deployment", name: workflow.Deployment},
+		{kind: "Service", name: workflow.Service},
 	}
-	//判断service类型
-	if data.Type != "Ingress" {
-		serviceType = data.Type
-	} else {
-		serviceType = "ClusterIP"
-	}
-	//组装ServiceCreate类型的数据
-	sc := &ServiceCreate{
-		Name:          getServiceName(data.Name),
-		Namespace:     data.Namespace,
-		Type:          serviceType,
-		ContainerPort: data.ContainerPort,
-		Port:          data.Port,
-		NodePort:      data.NodePort,
-		Label:         data.Label,
-	}
-	err = Service.CreateService(sc)
-	if err != nil {
-		return err
+	if workflow.Type == "Ingress" {
+		resources = append(resources, &workflowRes{kind: "Ingress", name: workflow.Ingress})
 	}
-	//组装IngressCreate类型的数据，创建ingress，只有ingress类型的workflow才有ingress资源，所以这里做了一层判断
-	if data.Type == "Ingress" {
-		ic := &IngressCreate{
-			Name:      getIngressName(data.Name),
+	return resources
+}
+
+//创建workflow中的一个k8s资源
+func createWorkflowRes(client *kubernetes.Clientset, res *workflowRes, data *WorkflowCreate) (err error) {
+	switch res.kind {
+	case "Deployment":
+		//组装DeployCreate类型的数据
+		return Deployment.CreateDeployment(client, &DeployCreate{
+			Name:          res.name,
+			Namespace:     data.Namespace,
+			Replicas:      data.Replicas,
+			Image:         data.Image,
+			Label:         data.Label,
+			Cpu:           data.Cpu,
+			Memory:        data.Memory,
+			ContainerPort: data.ContainerPort,
+			HealthCheck:   data.HealthCheck,
+			HealthPath:    data.HealthPath,
+		})
+	case "Service":
+		//判断service类型，ingress类型的workflow使用ClusterIP
+		serviceType := data.Type
+		if data.Type == "Ingress" {
+			serviceType = "ClusterIP"
+		}
+		//组装ServiceCreate类型的数据
+		return Service.CreateService(client, &ServiceCreate{
+			Name:          res.name,
+			Namespace:     data.Namespace,
+			Type:          serviceType,
+			ContainerPort: data.ContainerPort,
+			Port:          data.Port,
+			NodePort:      data.NodePort,
+			Label:         data.Label,
+		})
+	case "Ingress":
+		//组装IngressCreate类型的数据
+		return Ingress.CreateIngress(client, &IngressCreate{
+			Name:      res.name,
 			Namespace: data.Namespace,
 			Label:     data.Label,
 			Hosts:     data.Hosts,
+		})
+	}
+	return fmt.Errorf("不支持的资源类型%s", res.kind)
+}
+
+//删除workflow中的一个k8s资源，资源已经不存在时视为删除成功
+func delWorkflowRes(client *kubernetes.Clientset, res *workflowRes, namespace string) (err error) {
+	switch res.kind {
+	case "Deployment":
+		err = Deployment.DeleteDeployment(client, res.name, namespace)
+	case "Service":
+		err = Service.DeleteService(client, res.name, namespace)
+	case "Ingress":
+		err = Ingress.DeleteIngress(client, res.name, namespace)
+	default:
+		err = fmt.Errorf("不支持的资源类型%s", res.kind)
+	}
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+//记录一步操作的结果
+func workflowStep(action string, res *workflowRes, err error) *model.WorkflowStep {
+	step := &model.WorkflowStep{
+		Action: action,
+		Kind:   res.kind,
+		Name:   res.name,
+		Status: WorkflowStepSuccess,
+	}
+	if err != nil {
+		step.Status = WorkflowStepFailed
+		step.Message = err.Error()
+	}
+	return step
+}
+
+//根据步骤记录获取workflow创建的、还没有被回滚或删除的资源，按创建顺序排列
+//记录步骤之前创建的workflow没有步骤，只有全部创建成功才会入库，返回所有资源
+func createdWorkflowRes(workflow *model.Workflow) (resources []*workflowRes) {
+	if len(workflow.Steps) == 0 {
+		return workflowResources(workflow)
+	}
+	for _, step := range workflow.Steps {
+		if step.Status != WorkflowStepSuccess {
+			continue
 		}
-		err = Ingress.CreateIngress(ic)
+		switch step.Action {
+		case WorkflowActionCreate:
+			resources = append(resources, &workflowRes{kind: step.Kind, name: step.Name})
+		case WorkflowActionRollback, WorkflowActionDelete:
+			for i, res := range resources {
+				if res.kind == step.Kind && res.name == step.Name {
+					resources = append(resources[:i], resources[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return resources
+}
+
+//按相反的顺序删除已经创建的资源，返回回滚步骤和回滚失败的资源
+func rollbackWorkflowRes(client *kubernetes.Clientset, created []*workflowRes, namespace string) (steps []*model.WorkflowStep, failed []string) {
+	for i := len(created) - 1; i >= 0; i-- {
+		err := delWorkflowRes(client, created[i], namespace)
+		steps = append(steps, workflowStep(WorkflowActionRollback, created[i], err))
 		if err != nil {
-			return err
+			failed = append(failed, created[i].kind+"/"+created[i].name)
 		}
 	}
-	return nil
+	return steps, failed
 }
 
 //创建workflow
+//依次创建deployment、service、ingress，任意一步失败时删除已经创建的资源
+//k8s资源全部创建成功后才写入数据库，失败的workflow也会写入数据库，状态为failed，便于查看每一步的结果
 func (w *workflow) CreateWorkflow(data *WorkflowCreate) (err error) {
+	//未指定集群时使用默认集群，并记录到workflow数据中
+	if data.Cluster == "" {
+		data.Cluster = config.DefaultCluster
+	}
+	client, err := K8s.GetClient(data.Cluster)
+	if err != nil {
+		return err
+	}
 	//若workflow不是ingress类型，传入空字符串即可
 	var ingressName string
 	if data.Type == "Ingress" {
@@ -130,64 +241,89 @@ func (w *workflow) CreateWorkflow(data *WorkflowCreate) (err error) {
 	//组装mysql中workflow的单条数据
 	workflow := &model.Workflow{
 		Name:       data.Name,
+		Cluster:    data.Cluster,
 		Namespace:  data.Namespace,
 		Replicas:   data.Replicas,
 		Deployment: data.Name,
 		Service:    getServiceName(data.Name),
 		Ingress:    ingressName,
 		Type:       data.Type,
-	}
-	//调用dao层执行数据库的添加操作
-	err = dao.Workflow.Add(workflow)
-	if err != nil {
-		return err
+		Status:     WorkflowStatusSucceeded,
 	}
 	//创建k8s资源
-	err = createWorkflowRes(data)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-//封装删除workflow对应的k8s资源
-func delWorkflowRes(workflow *model.Workflow) (err error) {
-	//删除deployment
-	err = Deployment.DeleteDeployment(workflow.Name, workflow.Namespace)
-	if err != nil {
-		return err
+	var created []*workflowRes
+	for _, res := range workflowResources(workflow) {
+		err = createWorkflowRes(client, res, data)
+		workflow.Steps = append(workflow.Steps, workflowStep(WorkflowActionCreate, res, err))
+		if err != nil {
+			break
+		}
+		created = append(created, res)
 	}
-	//删除service
-	err = Service.DeleteService(getServiceName(workflow.Name), workflow.Namespace)
-	if err != nil {
+	if err == nil {
+		//调用dao层执行数据库的添加操作，写入失败时回滚k8s资源
+		if err = dao.Workflow.Add(workflow); err == nil {
+			return nil
+		}
+		if _, failed := rollbackWorkflowRes(client, created, workflow.Namespace); len(failed) > 0 {
+			return fmt.Errorf("%s，回滚失败的资源：%s", err.Error(), strings.Join(failed, ","))
+		}
 		return err
 	}
-	//删除ingress，这里多了一层判断，因为只有type为ingress的workflow才有ingress资源
-	if workflow.Type == "Ingress" {
-		err = Ingress.DeleteIngress(getIngressName(workflow.Name), workflow.Namespace)
-		if err != nil {
-			return err
-		}
+	steps, failed := rollbackWorkflowRes(client, created, workflow.Namespace)
+	workflow.Steps = append(workflow.Steps, steps...)
+	workflow.Status = WorkflowStatusFailed
+	if len(failed) > 0 {
+		err = fmt.Errorf("%s，回滚失败的资源：%s", err.Error(), strings.Join(failed, ","))
+	} else if len(created) > 0 {
+		err = fmt.Errorf("%s，已回滚已创建的资源", err.Error())
 	}
-	return nil
+	//记录失败的workflow，写入失败不影响返回创建失败的原因
+	dao.Workflow.Add(workflow)
+	return err
 }
 
 //删除workflow
+//只删除workflow创建成功且没有被回滚、删除的k8s资源，同名资源可能是workflow创建失败的原因，不能删除
+//删除所有k8s资源后才删除数据库数据，有资源删除失败时保留数据，状态为delete_failed，可以重试删除
 func (w *workflow) DelById(id int) (err error) {
 	//获取workflow数据
 	workflow, err := dao.Workflow.GetById(id)
 	if err != nil {
 		return err
 	}
-	//删除k8s资源
-	err = delWorkflowRes(workflow)
-	if err != nil {
-		return nil
+	if workflow.ID == 0 {
+		return errors.New("Workflow不存在")
 	}
-	//删除数据库数据
-	err = dao.Workflow.DelById(id)
+	//创建失败的workflow已经回滚，回滚失败的资源在步骤中可以查到，需要手动处理，这里只删除数据库数据
+	if workflow.Status == WorkflowStatusFailed {
+		return dao.Workflow.DelById(id)
+	}
+	//获取workflow所在集群的clientSet
+	client, err := K8s.GetClient(workflow.Cluster)
 	if err != nil {
 		return err
 	}
-	return nil
+	//删除k8s资源，某个资源删除失败时继续删除其他资源，重试时只剩下失败的资源
+	var (
+		steps  []*model.WorkflowStep
+		failed []string
+		delErr error
+	)
+	for _, res := range createdWorkflowRes(workflow) {
+		err = delWorkflowRes(client, res, workflow.Namespace)
+		steps = append(steps, workflowStep(WorkflowActionDelete, res, err))
+		if err != nil {
+			failed = append(failed, res.kind+"/"+res.name)
+			if delErr == nil {
+				delErr = err
+			}
+		}
+	}
+	if delErr != nil {
+		dao.Workflow.UpdateStatus(workflow.ID, WorkflowStatusDeleteFailed, steps)
+		return fmt.Errorf("%s，删除失败的资源：%s", delErr.Error(), strings.Join(failed, ","))
+	}
+	//删除数据库数据
+	return dao.Workflow.DelById(id)
 }
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"k8s-platform/dao"
+	"k8s-platform/db"
+	"k8s-platform/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func resNames(resources []*workflowRes) string {
+	var names []string
+	for _, res := range resources {
+		names = append(names, res.kind+"/"+res.name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestCreatedWorkflowRes(t *testing.T) {
+	step := func(action, kind, status string) *model.WorkflowStep {
+		return &model.WorkflowStep{Action: action, Kind: kind, Name: strings.ToLower(kind), Status: status}
+	}
+	workflow := &model.Workflow{Deployment: "deployment", Service: "service", Ingress: "ingress", Type: "Ingress"}
+	cases := []struct {
+		name  string
+		steps []*model.WorkflowStep
+		want  string
+	}{
+		//记录步骤之前创建的workflow
+		{"legacy", nil, "Deployment/deployment,Service/service,Ingress/ingress"},
+		{"succeeded", []*model.WorkflowStep{
+			step(WorkflowActionCreate, "Deployment", WorkflowStepSuccess),
+			step(WorkflowActionCreate, "Service", WorkflowStepSuccess),
+			step(WorkflowActionCreate, "Ingress", WorkflowStepSuccess),
+		}, "Deployment/deployment,Service/service,Ingress/ingress"},
+		//service已存在导致创建失败，不能删除已存在的service
+		{"create failed", []*model.WorkflowStep{
+			step(WorkflowActionCreate, "Deployment", WorkflowStepSuccess),
+			step(WorkflowActionCreate, "Service", WorkflowStepFailed),
+			step(WorkflowActionRollback, "Deployment", WorkflowStepFailed),
+		}, "Deployment/deployment"},
+		{"rolled back", []*model.WorkflowStep{
+			step(WorkflowActionCreate, "Deployment", WorkflowStepSuccess),
+			step(WorkflowActionCreate, "Service", WorkflowStepFailed),
+			step(WorkflowActionRollback, "Deployment", WorkflowStepSuccess),
+		}, ""},
+		//重试删除时只剩下上次删除失败的资源
+		{"delete retry", []*model.WorkflowStep{
+			step(WorkflowActionCreate, "Deployment", WorkflowStepSuccess),
+			step(WorkflowActionCreate, "Service", WorkflowStepSuccess),
+			step(WorkflowActionCreate, "Ingress", WorkflowStepSuccess),
+			step(WorkflowActionDelete, "Deployment", WorkflowStepSuccess),
+			step(WorkflowActionDelete, "Service", WorkflowStepFailed),
+			step(WorkflowActionDelete, "Ingress", WorkflowStepSuccess),
+		}, "Service/service"},
+	}
+	for _, c := range cases {
+		workflow.Steps = c.steps
+		if got := resNames(createdWorkflowRes(workflow)); got != c.want {
+			t.Errorf("%s: 需要删除的资源为%q，期望%q", c.name, got, c.want)
+		}
+	}
+}
+
+//模拟的apiserver，记录创建和删除请求，failPaths中的创建请求返回409，其他请求返回403
+//requests返回指定method的请求路径
+func newWorkflowTestServer(t *testing.T, failPaths ...string) (srv *httptest.Server, requests func(method string) []string) {
+	var (
+		lock     sync.Mutex
+		recorded = map[string][]string{}
+	)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		status := map[string]interface{}{"kind": "Status", "apiVersion": "v1", "status": "Success", "code": 200}
+		switch r.Method {
+		case http.MethodPost:
+			lock.Lock()
+			recorded[r.Method] = append(recorded[r.Method], r.URL.Path)
+			lock.Unlock()
+			if contains(failPaths, r.URL.Path) {
+				w.WriteHeader(http.StatusConflict)
+				status["status"], status["reason"], status["code"] = "Failure", "AlreadyExists", 409
+				status["message"] = "already exists"
+				break
+			}
+			//创建成功时原样返回请求的对象
+			w.WriteHeader(http.StatusCreated)
+			io.Copy(w, r.Body)
+			return
+		case http.MethodDelete:
+			lock.Lock()
+			recorded[r.Method] = append(recorded[r.Method], r.URL.Path)
+			lock.Unlock()
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			status["status"], status["reason"], status["code"] = "Failure", "Forbidden", 403
+		}
+		json.NewEncoder(w).Encode(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func(method string) []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string{}, recorded[method]...)
+	}
+}
+
+func TestWorkflowDelById(t *testing.T) {
+	setupTestDB(t)
+	srv, requests := newWorkflowTestServer(t)
+	if err := K8s.Register("workflow-test", &rest.Config{Host: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { K8s.Unregister("workflow-test") })
+	deleted := func() []string { return requests(http.MethodDelete) }
+
+	//创建失败的workflow已经回滚，只删除数据库数据
+	failed := &model.Workflow{
+		Name: "app", Cluster: "workflow-test", Namespace: "default", Deployment: "app", Service: "app-svc",
+		Type: "ClusterIP", Status: WorkflowStatusFailed,
+		Steps: []*model.WorkflowStep{
+			{Action: WorkflowActionCreate, Kind: "Deployment", Name: "app", Status: WorkflowStepSuccess},
+			{Action: WorkflowActionCreate, Kind: "Service", Name: "app-svc", Status: WorkflowStepFailed},
+			{Action: WorkflowActionRollback, Kind: "Deployment", Name: "app", Status: WorkflowStepSuccess},
+		},
+	}
+	if err := dao.Workflow.Add(failed); err != nil {
+		t.Fatal(err)
+	}
+	if err := Workflow.DelById(int(failed.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if paths := deleted(); len(paths) != 0 {
+		t.Fatalf("删除失败的workflow时不应该删除k8s资源，%v", paths)
+	}
+	if data, _ := dao.Workflow.GetById(int(failed.ID)); data.ID != 0 {
+		t.Fatal("workflow数据没有删除")
+	}
+
+	//创建成功的workflow删除步骤中创建的资源
+	succeeded := &model.Workflow{
+		Name: "web", Cluster: "workflow-test", Namespace: "default", Deployment: "web", Service: "web-svc",
+		Type: "ClusterIP", Status: WorkflowStatusSucceeded,
+		Steps: []*model.WorkflowStep{
+			{Action: WorkflowActionCreate, Kind: "Deployment", Name: "web", Status: WorkflowStepSuccess},
+			{Action: WorkflowActionCreate, Kind: "Service", Name: "web-svc", Status: WorkflowStepSuccess},
+		},
+	}
+	if err := dao.Workflow.Add(succeeded); err != nil {
+		t.Fatal(err)
+	}
+	if err := Workflow.DelById(int(succeeded.ID)); err != nil {
+		t.Fatal(err)
+	}
+	want := "/apis/apps/v1/namespaces/default/deployments/web,/api/v1/namespaces/default/services/web-svc"
+	if got := strings.Join(deleted(), ","); got != want {
+		t.Fatalf("删除的资源为%s，期望%s", got, want)
+	}
+}
+
+//ingress类型的workflow，创建service失败时回滚已创建的deployment，并保存失败的workflow和每一步的结果
+func TestCreateWorkflowRollback(t *testing.T) {
+	setupTestDB(t)
+	srv, requests := newWorkflowTestServer(t, "/api/v1/namespaces/default/services")
+	if err := K8s.Register("workflow-test", &rest.Config{Host: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { K8s.Unregister("workflow-test") })
+
+	err := Workflow.CreateWorkflow(&WorkflowCreate{
+		Name: "web", Cluster: "workflow-test", Namespace: "default", Replicas: 1, Image: "nginx",
+		Label: map[string]string{"app": "web"}, Cpu: "1", Memory: "1Gi", ContainerPort: 80,
+		Type: "Ingress", Port: 80,
+	})
+	if err == nil || !strings.Contains(err.Error(), "已回滚") {
+		t.Fatalf("创建service失败时应该返回错误并回滚，%v", err)
+	}
+	//ingress不会再创建，只回滚已经创建的deployment
+	wantCreated := "/apis/apps/v1/namespaces/default/deployments,/api/v1/namespaces/default/services"
+	if got := strings.Join(requests(http.MethodPost), ","); got != wantCreated {
+		t.Fatalf("创建的资源为%s，期望%s", got, wantCreated)
+	}
+	wantDeleted := "/apis/apps/v1/namespaces/default/deployments/web"
+	if got := strings.Join(requests(http.MethodDelete), ","); got != wantDeleted {
+		t.Fatalf("回滚删除的资源为%s，期望%s", got, wantDeleted)
+	}
+
+	data, err := dao.Workflow.GetList("workflow-test", "default", nil, 0, 0)
+	if err != nil || len(data.Items) != 1 {
+		t.Fatalf("应该保存失败的workflow，%v", err)
+	}
+	workflow, err := dao.Workflow.GetById(int(data.Items[0].ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workflow.Status != WorkflowStatusFailed {
+		t.Fatalf("workflow状态为%s，期望%s", workflow.Status, WorkflowStatusFailed)
+	}
+	var steps []string
+	for _, step := range workflow.Steps {
+		steps = append(steps, step.Action+":"+step.Kind+":"+step.Status)
+	}
+	wantSteps := "create:Deployment:success,create:Service:failed,rollback:Deployment:success"
+	if got := strings.Join(steps, ","); got != wantSteps {
+		t.Fatalf("保存的步骤为%s，期望%s", got, wantSteps)
+	}
+}
+
+//k8s资源全部创建成功但写入数据库失败时，回滚所有资源，不留下没有记录的资源
+func TestCreateWorkflowRollbackOnDBError(t *testing.T) {
+	setupTestDB(t)
+	srv, requests := newWorkflowTestServer(t)
+	if err := K8s.Register("workflow-test", &rest.Config{Host: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { K8s.Unregister("workflow-test") })
+	if err := db.GORM.Migrator().DropTable(&model.WorkflowStep{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Workflow.CreateWorkflow(&WorkflowCreate{
+		Name: "web", Cluster: "workflow-test", Namespace: "default", Replicas: 1, Image: "nginx",
+		Label: map[string]string{"app": "web"}, Cpu: "1", Memory: "1Gi", ContainerPort: 80,
+		Type: "ClusterIP", Port: 80,
+	})
+	if err == nil {
+		t.Fatal("写入数据库失败时应该返回错误")
+	}
+	want := "/api/v1/namespaces/default/services/web-svc,/apis/apps/v1/namespaces/default/deployments/web"
+	if got := strings.Join(requests(http.MethodDelete), ","); got != want {
+		t.Fatalf("回滚删除的资源为%s，期望%s", got, want)
+	}
+}
+
+//Total为满足条件的总数而不是当前页的数量，facets按namespace统计，namespaces限制可见的namespace
+func TestWorkflowGetList(t *testing.T) {
+	setupTestDB(t)
+	for _, namespace := range []string{"dev", "dev", "dev", "test", "prod"} {
+		if err := dao.Workflow.Add(&model.Workflow{Name: "web", Cluster: "workflow-test", Namespace: namespace}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dao.Workflow.Add(&model.Workflow{Name: "web", Cluster: "other", Namespace: "dev"}); err != nil {
+		t.Fatal(err)
+	}
+	facets := func(data *dao.WorkflowResp) string {
+		var s []string
+		for _, facet := range data.Facets {
+			s = append(s, fmt.Sprintf("%s=%d", facet.Namespace, facet.Total))
+		}
+		return strings.Join(s, ",")
+	}
+	cases := []struct {
+		name       string
+		namespace  string
+		namespaces []string
+		items      int
+		total      int
+		facets     string
+	}{
+		{"单个namespace", "dev", nil, 2, 3, "dev=3"},
+		{"所有namespace", "", nil, 2, 5, "dev=3,prod=1,test=1"},
+		{"有权限的namespace", "", []string{"dev", "test"}, 2, 4, "dev=3,test=1"},
+		{"没有workflow的namespace", "", []string{"staging"}, 0, 0, ""},
+	}
+	for _, c := range cases {
+		data, err := Workflow.GetList("workflow-test", c.namespace, c.namespaces, 1, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data.Items) != c.items || data.Total != c.total || facets(data) != c.facets {
+			t.Errorf("%s：返回%d条，total为%d，facets为%q，期望%d条，total为%d，facets为%q",
+				c.name, len(data.Items), data.Total, facets(data), c.items, c.total, c.facets)
+		}
+	}
+}
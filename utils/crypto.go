@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"k8s-platform/config"
+)
+
+type aesCrypto struct{}
+
+var AESCrypto aesCrypto
+
+//使用AES-GCM加密，返回base64编码的"随机数+密文"
+func (*aesCrypto) Encrypt(plaintext []byte) (ciphertext string, err error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.New("生成随机数失败，" + err.Error())
+	}
+	//Seal会把密文追加到nonce之后，解密时从头部取出nonce
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+//解密Encrypt方法生成的密文
+func (*aesCrypto) Decrypt(ciphertext string) (plaintext []byte, err error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, errors.New("密文base64解码失败，" + err.Error())
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("密文长度不合法")
+	}
+	nonce, data := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err = gcm.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, errors.New("解密失败，" + err.Error())
+	}
+	return plaintext, nil
+}
+
+//根据服务端密钥生成AES-GCM实例，密钥长度必须为16、24或32字节
+func newGCM() (cipher.AEAD, error) {
+	block, err := aes.NewCipher([]byte(config.EncryptKey))
+	if err != nil {
+		return nil, errors.New("创建AES实例失败，" + err.Error())
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.New("创建GCM实例失败，" + err.Error())
+	}
+	return gcm, nil
+}
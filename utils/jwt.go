@@ -1,35 +1,201 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"k8s-platform/config"
+	"os"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 
 	"github.com/wonderivan/logger"
 )
 
-type jwtToken struct{}
+type jwtToken struct {
+	//key为kid，签发时使用config.JWTActiveKid对应的密钥，校验时根据token头部的kid选择密钥
+	keys map[string]*jwtKey
+}
 
 var JWTToken jwtToken
 
-// token中包含的自定义信息以及jwt签名信息
+//token类型，access用于访问接口，refresh只能用于换取新的token
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+)
+
+// token中包含的自定义信息以及jwt签名信息，不包含密码等敏感信息
+// StandardClaims中的Id为token的唯一标识(jti)，用于注销时加入黑名单
+// Version为签发时用户的token版本，用户被禁用或密码变更后版本加1，旧token失效
 type CustomClaims struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username  string `json:"username"`
+	TokenType string `json:"token_type"`
+	Version   int    `json:"ver"`
 	jwt.StandardClaims
 }
 
-// 加解密因子
-const (
-	SECRET = "adoodevops"
-)
+//KeyConfig定义config.JWTKeys中单个密钥的配置
+//HS256使用Secret，RS256和ES256使用PEM格式的密钥文件
+//只配置PublicKey的密钥只能用于校验，适用于密钥轮换后仍需校验旧token的场景
+type KeyConfig struct {
+	Kid        string `json:"kid"`
+	Alg        string `json:"alg"`
+	Secret     string `json:"secret"`
+	PrivateKey string `json:"private_key"`
+	PublicKey  string `json:"public_key"`
+}
+
+type jwtKey struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+//加载config.JWTKeys中的密钥，需要在config.Init之后调用
+func (j *jwtToken) Init() (err error) {
+	var keyConfigs []*KeyConfig
+	if err = json.Unmarshal([]byte(config.JWTKeys), &keyConfigs); err != nil {
+		return errors.New("解析jwt_keys失败，" + err.Error())
+	}
+	j.keys = map[string]*jwtKey{}
+	for _, kc := range keyConfigs {
+		key, err := loadKey(kc)
+		if err != nil {
+			return fmt.Errorf("加载jwt密钥%s失败，%s", kc.Kid, err.Error())
+		}
+		j.keys[kc.Kid] = key
+	}
+	active, ok := j.keys[config.JWTActiveKid]
+	if !ok {
+		return errors.New("jwt_active_kid对应的密钥不存在：" + config.JWTActiveKid)
+	}
+	if active.signKey == nil {
+		return errors.New("jwt_active_kid对应的密钥没有配置私钥，无法签发token")
+	}
+	return nil
+}
+
+//根据配置加载签名和校验密钥
+func loadKey(kc *KeyConfig) (key *jwtKey, err error) {
+	if kc.Kid == "" {
+		return nil, errors.New("kid不能为空")
+	}
+	readPEM := func(path string) ([]byte, error) {
+		if path == "" {
+			return nil, nil
+		}
+		return os.ReadFile(path)
+	}
+	privatePEM, err := readPEM(kc.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	publicPEM, err := readPEM(kc.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	key = &jwtKey{}
+	switch kc.Alg {
+	case "HS256":
+		if kc.Secret == "" {
+			return nil, errors.New("HS256密钥的secret不能为空")
+		}
+		key.method = jwt.SigningMethodHS256
+		key.signKey = []byte(kc.Secret)
+		key.verifyKey = []byte(kc.Secret)
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+		if privatePEM != nil {
+			privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = privateKey
+			key.verifyKey = &privateKey.PublicKey
+		}
+		if publicPEM != nil {
+			if key.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(publicPEM); err != nil {
+				return nil, err
+			}
+		}
+	case "ES256":
+		key.method = jwt.SigningMethodES256
+		if privatePEM != nil {
+			privateKey, err := jwt.ParseECPrivateKeyFromPEM(privatePEM)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = privateKey
+			key.verifyKey = &privateKey.PublicKey
+		}
+		if publicPEM != nil {
+			if key.verifyKey, err = jwt.ParseECPublicKeyFromPEM(publicPEM); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, errors.New("不支持的签名算法：" + kc.Alg)
+	}
+	if key.verifyKey == nil {
+		return nil, errors.New("没有配置密钥")
+	}
+	return key, nil
+}
+
+// 生成token，tokenType为AccessToken或RefreshToken，有效期分别为config.JWTExpire和config.JWTRefreshExpire
+func (j *jwtToken) GenerateToken(username, tokenType string, version int) (tokenString string, claims *CustomClaims, err error) {
+	key, ok := j.keys[config.JWTActiveKid]
+	if !ok {
+		return "", nil, errors.New("生成token失败，签名密钥未初始化")
+	}
+	expire := config.JWTExpire
+	if tokenType == RefreshToken {
+		expire = config.JWTRefreshExpire
+	}
+	jti, err := newTokenId()
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	claims = &CustomClaims{
+		Username:  username,
+		TokenType: tokenType,
+		Version:   version,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(expire).Unix(),
+		},
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	//kid写入token头部，校验时据此选择密钥，实现密钥轮换
+	token.Header["kid"] = config.JWTActiveKid
+	tokenString, err = token.SignedString(key.signKey)
+	if err != nil {
+		logger.Error("生成token失败，" + err.Error())
+		return "", nil, errors.New("生成token失败，" + err.Error())
+	}
+	return tokenString, claims, nil
+}
 
 // 解析token
-func (*jwtToken) ParseToken(tokenString string) (claim *CustomClaims, err error) {
+func (j *jwtToken) ParseToken(tokenString string) (claim *CustomClaims, err error) {
 	//使用jwt.ParseWithClaims方法解析token，这个token是前端传给我们的，获得一个*Token类型的对象
 	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		logger.Error("[]byte(SECRET):%d", []byte(SECRET))
-		return []byte(SECRET), nil
+		kid, _ := token.Header["kid"].(string)
+		key, ok := j.keys[kid]
+		if !ok {
+			return nil, errors.New("未知的kid：" + kid)
+		}
+		//签名算法必须与密钥配置一致，防止算法混淆攻击
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, errors.New("签名算法不匹配：" + token.Method.Alg())
+		}
+		return key.verifyKey, nil
 	})
 	if err != nil {
 		logger.Error("parse token failed", err)
@@ -45,6 +211,7 @@ func (*jwtToken) ParseToken(tokenString string) (claim *CustomClaims, err error)
 				return nil, errors.New("TokenInvalid")
 			}
 		}
+		return nil, errors.New("TokenInvalid")
 	}
 	//转换成*CustomClaims类型并返回
 	if claims, ok := token.Claims.(*CustomClaims); ok && token.Valid {
@@ -52,3 +219,12 @@ func (*jwtToken) ParseToken(tokenString string) (claim *CustomClaims, err error)
 	}
 	return nil, errors.New("解析Token失败")
 }
+
+//生成随机的token唯一标识
+func newTokenId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.New("生成token id失败，" + err.Error())
+	}
+	return hex.EncodeToString(b), nil
+}
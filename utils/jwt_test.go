@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"k8s-platform/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+//生成RSA私钥和公钥文件，返回文件路径
+func writeRSAKey(t *testing.T, name string) (privatePath, publicPath string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	privatePath = filepath.Join(dir, name+".pem")
+	publicPath = filepath.Join(dir, name+".pub.pem")
+	private := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicDer, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer})
+	if err = os.WriteFile(privatePath, private, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(publicPath, public, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return privatePath, publicPath
+}
+
+func initKeys(t *testing.T, activeKid string, keys ...*KeyConfig) {
+	b, err := json.Marshal(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.JWTKeys = string(b)
+	config.JWTActiveKid = activeKid
+	if err = JWTToken.Init(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//密钥轮换：新token使用新的kid签发，旧token在旧公钥保留期间仍然有效，移除旧公钥后失效
+func TestKeyRotation(t *testing.T) {
+	private1, public1 := writeRSAKey(t, "k1")
+	private2, _ := writeRSAKey(t, "k2")
+
+	initKeys(t, "k1", &KeyConfig{Kid: "k1", Alg: "RS256", PrivateKey: private1})
+	oldToken, _, err := JWTToken.GenerateToken("dev", AccessToken, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//轮换到k2，k1只保留公钥用于校验
+	initKeys(t, "k2",
+		&KeyConfig{Kid: "k1", Alg: "RS256", PublicKey: public1},
+		&KeyConfig{Kid: "k2", Alg: "RS256", PrivateKey: private2},
+	)
+	newToken, _, err := JWTToken.GenerateToken("dev", AccessToken, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := jwt.Parse(newToken, nil)
+	if parsed == nil || parsed.Header["kid"] != "k2" {
+		t.Fatalf("新token应该使用k2签发")
+	}
+	for name, token := range map[string]string{"旧token": oldToken, "新token": newToken} {
+		claims, err := JWTToken.ParseToken(token)
+		if err != nil || claims.Username != "dev" {
+			t.Fatalf("%s校验失败，%v", name, err)
+		}
+	}
+
+	//移除k1后旧token失效
+	initKeys(t, "k2", &KeyConfig{Kid: "k2", Alg: "RS256", PrivateKey: private2})
+	if _, err = JWTToken.ParseToken(oldToken); err == nil {
+		t.Fatal("移除k1后旧token应该失效")
+	}
+	if _, err = JWTToken.ParseToken(newToken); err != nil {
+		t.Fatalf("新token校验失败，%v", err)
+	}
+}
+
+//只有公钥的密钥不能作为签发密钥
+func TestActiveKeyWithoutPrivateKey(t *testing.T) {
+	_, public1 := writeRSAKey(t, "k1")
+	b, _ := json.Marshal([]*KeyConfig{{Kid: "k1", Alg: "RS256", PublicKey: public1}})
+	config.JWTKeys = string(b)
+	config.JWTActiveKid = "k1"
+	if err := JWTToken.Init(); err == nil {
+		t.Fatal("没有私钥的密钥不能作为jwt_active_kid")
+	}
+}
+
+//使用RS256公钥作为HS256密钥伪造的token必须被拒绝
+func TestAlgorithmConfusion(t *testing.T) {
+	private1, public1 := writeRSAKey(t, "k1")
+	initKeys(t, "k1", &KeyConfig{Kid: "k1", Alg: "RS256", PrivateKey: private1})
+	publicPEM, err := os.ReadFile(public1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &CustomClaims{Username: "admin", TokenType: AccessToken})
+	forged.Header["kid"] = "k1"
+	token, err := forged.SignedString(publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = JWTToken.ParseToken(token); err == nil {
+		t.Fatal("算法不匹配的token应该被拒绝")
+	}
+	//未知kid
+	forged.Header["kid"] = "unknown"
+	token, _ = forged.SignedString(publicPEM)
+	if _, err = JWTToken.ParseToken(token); err == nil || !strings.Contains(err.Error(), "Token") {
+		t.Fatalf("未知kid的token应该被拒绝，%v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+)
+
+type rawWriterKey struct{}
+
+//gin的ResponseWriter没有实现Unwrap，http.NewResponseController无法通过它设置写入超时
+//KeepRawWriter在gin之前把原始的ResponseWriter保存到请求的context中，流式接口通过RawWriter获取
+func KeepRawWriter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), rawWriterKey{}, w)))
+	})
+}
+
+//获取请求对应的原始ResponseWriter，只用于设置写入超时，写入仍然使用gin的ResponseWriter，没有保存时返回w
+func RawWriter(r *http.Request, w http.ResponseWriter) http.ResponseWriter {
+	if raw, ok := r.Context().Value(rawWriterKey{}).(http.ResponseWriter); ok {
+		return raw
+	}
+	return w
+}